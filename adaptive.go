@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// literalBits is the width of the literal that follows the NYT code when a
+// new symbol first appears; it holds any code point up to U+10FFFF
+const literalBits = 21
+
+// adaptiveNode is a node of an adaptive Huffman tree. Nodes are referred to
+// by index, with -1 meaning none.
+type adaptiveNode struct {
+	weight              int
+	parent, left, right int
+	symbol              rune
+	leaf                bool
+	rank                int // position in adaptiveTree.order
+}
+
+// adaptiveTree is an FGK adaptive Huffman tree. Encoder and decoder update
+// identical trees after every symbol, so no table is ever transmitted.
+// Symbols not yet seen are sent as the code of the NYT ("not yet
+// transmitted") leaf followed by a fixed-width literal, after which the NYT
+// leaf splits to make room for the new symbol.
+type adaptiveTree struct {
+	nodes  []adaptiveNode
+	order  []int // nodes by rank; weights never increase along it, root first
+	leaves map[rune]int
+	nyt    int
+}
+
+func newAdaptiveTree() *adaptiveTree {
+	t := &adaptiveTree{leaves: make(map[rune]int)}
+	t.nyt = t.newNode(-1, true, 0)
+	return t
+}
+
+// newNode adds a node with the lowest rank
+func (t *adaptiveTree) newNode(parent int, leaf bool, symbol rune) int {
+	t.nodes = append(t.nodes, adaptiveNode{parent: parent, left: -1, right: -1, leaf: leaf, symbol: symbol, rank: len(t.order)})
+	t.order = append(t.order, len(t.nodes)-1)
+	return len(t.nodes) - 1
+}
+
+// code appends the current code of node to dst
+func (t *adaptiveTree) code(dst []byte, node int) []byte {
+	start := len(dst)
+	for ; t.nodes[node].parent >= 0; node = t.nodes[node].parent {
+		if t.nodes[t.nodes[node].parent].right == node {
+			dst = append(dst, '1')
+		} else {
+			dst = append(dst, '0')
+		}
+	}
+	for i, j := start, len(dst)-1; i < j; i, j = i+1, j-1 {
+		dst[i], dst[j] = dst[j], dst[i]
+	}
+	return dst
+}
+
+// update records one occurrence of symbol, splitting the NYT leaf if the
+// symbol is new
+func (t *adaptiveTree) update(symbol rune) {
+	node, ok := t.leaves[symbol]
+	if !ok {
+		parent := t.nyt
+		node = t.newNode(parent, true, symbol)
+		t.nyt = t.newNode(parent, true, 0)
+		t.nodes[parent].leaf = false
+		t.nodes[parent].left, t.nodes[parent].right = t.nyt, node
+		t.leaves[symbol] = node
+	}
+
+	for {
+		// Swap with the highest-ranked node of equal weight, keeping the
+		// sibling property once the weight is incremented
+		rank := t.nodes[node].rank
+		leader := rank
+		for leader > 0 && t.nodes[t.order[leader-1]].weight == t.nodes[node].weight {
+			leader--
+		}
+		if other := t.order[leader]; other != node && other != t.nodes[node].parent {
+			t.swap(node, other)
+		}
+		t.nodes[node].weight++
+		if t.nodes[node].parent < 0 {
+			return
+		}
+		node = t.nodes[node].parent
+	}
+}
+
+// swap exchanges the positions and ranks of two subtrees
+func (t *adaptiveTree) swap(a, b int) {
+	na, nb := &t.nodes[a], &t.nodes[b]
+	pa, pb := na.parent, nb.parent
+	if pa == pb {
+		p := &t.nodes[pa]
+		p.left, p.right = p.right, p.left
+	} else {
+		t.replaceChild(pa, a, b)
+		t.replaceChild(pb, b, a)
+		na.parent, nb.parent = pb, pa
+	}
+	t.order[na.rank], t.order[nb.rank] = b, a
+	na.rank, nb.rank = nb.rank, na.rank
+}
+
+func (t *adaptiveTree) replaceChild(parent, old, new int) {
+	if t.nodes[parent].left == old {
+		t.nodes[parent].left = new
+	} else {
+		t.nodes[parent].right = new
+	}
+}
+
+// AdaptiveEncode encodes text in a single pass with adaptive Huffman
+// coding, returning the packed payload and its bit count. No code table is
+// needed to decode it.
+func AdaptiveEncode(text string) ([]byte, int, error) {
+	if !utf8.ValidString(text) {
+		return nil, 0, errors.New("input is not valid UTF-8")
+	}
+	t := newAdaptiveTree()
+	var bits []byte
+	for _, char := range text {
+		if node, ok := t.leaves[char]; ok {
+			bits = t.code(bits, node)
+		} else {
+			bits = t.code(bits, t.nyt)
+			for i := literalBits - 1; i >= 0; i-- {
+				bits = append(bits, '0'+byte(char>>i&1))
+			}
+		}
+		t.update(char)
+	}
+	payload, bitCount := PackBits(string(bits))
+	return payload, bitCount, nil
+}
+
+// AdaptiveDecode decodes bitCount bits of a payload from AdaptiveEncode
+func AdaptiveDecode(data []byte, bitCount int) (string, error) {
+	if bitCount > len(data)*8 {
+		return "", fmt.Errorf("bit count %d exceeds the %d bits of data", bitCount, len(data)*8)
+	}
+	bit := func(i int) int { return int(data[i/8]>>(7-i%8)) & 1 }
+
+	t := newAdaptiveTree()
+	var out []byte
+	for i := 0; i < bitCount; {
+		node := t.order[0]
+		for !t.nodes[node].leaf {
+			if i == bitCount {
+				return "", decodeErrorAt(i, errTruncatedCode)
+			}
+			if bit(i) == 0 {
+				node = t.nodes[node].left
+			} else {
+				node = t.nodes[node].right
+			}
+			i++
+		}
+
+		char := t.nodes[node].symbol
+		if node == t.nyt {
+			if i+literalBits > bitCount {
+				return "", decodeErrorAt(bitCount, errTruncatedCode)
+			}
+			char = 0
+			for j := 0; j < literalBits; j++ {
+				char = char<<1 | rune(bit(i))
+				i++
+			}
+			if !utf8.ValidRune(char) {
+				return "", fmt.Errorf("invalid literal %#x at offset %d", char, i-literalBits)
+			}
+			if _, seen := t.leaves[char]; seen {
+				return "", fmt.Errorf("literal %q at offset %d was already transmitted", char, i-literalBits)
+			}
+		}
+		out = utf8.AppendRune(out, char)
+		t.update(char)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAdaptiveRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"single symbol", "aaaaaaa"},
+		{"sentence", "the quick brown fox jumps over the lazy dog"},
+		{"new symbol halfway", strings.Repeat("ab", 50) + "Z" + strings.Repeat("ab", 50)},
+		{"new symbols late", strings.Repeat("x", 200) + "日本語🙂"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, bitCount, err := AdaptiveEncode(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := AdaptiveDecode(payload, bitCount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.text {
+				t.Errorf("AdaptiveDecode = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestAdaptiveEscapeCost(t *testing.T) {
+	// A symbol first seen mid-stream costs an escape code and a literal,
+	// and only the first time
+	base := strings.Repeat("ab", 50)
+	_, withOne, err := AdaptiveEncode(base + "Z" + base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, withTwo, err := AdaptiveEncode(base + "Z" + base + "Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withTwo-withOne >= literalBits {
+		t.Errorf("second occurrence cost %d bits, want less than a %d-bit literal", withTwo-withOne, literalBits)
+	}
+}
+
+func TestAdaptiveDecodeErrors(t *testing.T) {
+	payload, bitCount, err := AdaptiveEncode("ab") // ends with a literal
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AdaptiveDecode(payload, bitCount-3); !errors.Is(err, errTruncatedCode) {
+		t.Errorf("truncated payload: error %v, want errTruncatedCode", err)
+	}
+	if _, err := AdaptiveDecode(payload, len(payload)*8+1); err == nil {
+		t.Error("bit count past the data: no error")
+	}
+	if _, _, err := AdaptiveEncode("\xff"); err == nil {
+		t.Error("AdaptiveEncode accepted invalid UTF-8")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"unicode/utf8"
+)
+
+// EstimateCompressedBits predicts the payload size in bits of text with the
+// given frequency table, without encoding it
+func EstimateCompressedBits(frequency map[rune]int) int {
+	bits := 0
+	for char, length := range CodeLengths(BuildHuffmanTree(frequency)) {
+		bits += frequency[char] * length
+	}
+	return bits
+}
+
+// HeaderComparison reports the .huff file size for a frequency table under
+// each header representation; the payload is the same either way
+type HeaderComparison struct {
+	PayloadBytes         int
+	TreeHeaderBytes      int
+	CanonicalHeaderBytes int
+}
+
+// TreeTotal returns the file size with a serialized tree header
+func (c HeaderComparison) TreeTotal() int {
+	return c.TreeHeaderBytes + c.PayloadBytes
+}
+
+// CanonicalTotal returns the file size with a canonical code-length header
+func (c HeaderComparison) CanonicalTotal() int {
+	return c.CanonicalHeaderBytes + c.PayloadBytes
+}
+
+// CompareHeaders computes the header and payload sizes a .huff file would
+// have for text with the given frequencies, so callers can pick the
+// smaller header representation
+func CompareHeaders(frequency map[rune]int) HeaderComparison {
+	header := &HuffHeader{
+		Version:  versionFor(0),
+		Tree:     BuildHuffmanTree(frequency),
+		BitCount: uint64(EstimateCompressedBits(frequency)),
+	}
+	for char, freq := range frequency {
+		header.OriginalSize += uint64(freq * utf8.RuneLen(char))
+		header.SymbolCount += uint64(freq)
+	}
+	c := HeaderComparison{
+		PayloadBytes:    int(header.PayloadSize()),
+		TreeHeaderBytes: header.Size(),
+	}
+	header.Flags = FlagCanonical
+	c.CanonicalHeaderBytes = header.Size()
+	return c
+}
+
+// FrequencyHistogram returns the symbols of a frequency table from most to
+// least frequent, breaking ties by symbol
+func FrequencyHistogram(frequency map[rune]int) []SymbolFreq {
+	return SortSymbols(frequency, ByFrequencyDesc)
+}
+
+// FrequencySkew returns the Gini coefficient of a frequency table's counts:
+// 0 when every symbol is equally frequent, approaching 1 as a few symbols
+// dominate. Huffman coding gains more the higher it is. Only symbols
+// present in the table are considered.
+func FrequencySkew(frequency map[rune]int) float64 {
+	counts := make([]int, 0, len(frequency))
+	total := 0
+	for _, count := range frequency {
+		counts = append(counts, count)
+		total += count
+	}
+	if len(counts) < 2 || total == 0 {
+		return 0
+	}
+	sort.Ints(counts)
+	weighted := 0.0
+	for i, count := range counts {
+		weighted += float64(i+1) * float64(count)
+	}
+	n := float64(len(counts))
+	return 2*weighted/(n*float64(total)) - (n+1)/n
+}
+
+// CompareTrees returns the payload size in bits of text coded with each of
+// two trees, for weighing a custom, prior-based or length-limited tree
+// against the optimal one. It fails if either tree lacks a symbol of text.
+func CompareTrees(text string, a, b *HuffmanNode) (bitsA, bitsB int, err error) {
+	frequency := BuildFrequencyTable(text)
+	lengthsA, lengthsB := CodeLengths(a), CodeLengths(b)
+	for char, count := range frequency {
+		lengthA, okA := lengthsA[char]
+		lengthB, okB := lengthsB[char]
+		if !okA || !okB {
+			tree := "first"
+			if okA {
+				tree = "second"
+			}
+			return 0, 0, fmt.Errorf("symbol %q is not in the %s tree", char, tree)
+		}
+		bitsA += count * lengthA
+		bitsB += count * lengthB
+	}
+	return bitsA, bitsB, nil
+}
+
+// PerSymbolSavings returns, for each symbol of a frequency table, how many
+// bits its Huffman code saves over a fixed-length code of just enough bits
+// for the alphabet, weighted by the symbol's count. Frequent symbols save
+// bits; rare ones usually cost some. The values sum to the total saving.
+func PerSymbolSavings(frequency map[rune]int) map[rune]int {
+	lengths := CodeLengths(BuildHuffmanTree(frequency))
+	fixed := max(bits.Len(uint(max(len(lengths)-1, 0))), 1)
+	savings := make(map[rune]int, len(lengths))
+	for char, length := range lengths {
+		savings[char] = frequency[char] * (fixed - length)
+	}
+	return savings
+}
+
+// OccurrenceLengths returns the code length of every rune of text in
+// order, so a viewer can show which parts of a text cost the most bits.
+// The lengths sum to the payload bit count. It fails if text holds a
+// symbol missing from codes.
+func OccurrenceLengths(text string, codes map[rune]string) ([]int, error) {
+	lengths := make([]int, 0, utf8.RuneCountInString(text))
+	for _, char := range text {
+		code, ok := codes[char]
+		if !ok {
+			return nil, fmt.Errorf("symbol %q is not in the code table", char)
+		}
+		lengths = append(lengths, len(code))
+	}
+	return lengths, nil
+}
+
+// Stats summarizes how a container compresses its text
+type Stats struct {
+	OriginalSize   int     `json:"original_size"`   // bytes of text
+	CompressedSize int     `json:"compressed_size"` // bytes of header and payload
+	Ratio          float64 `json:"ratio"`           // original size over compressed size
+	// Entropy is the Shannon entropy of the text's symbols, in bits per
+	// symbol: the smallest average code length any symbol code can reach
+	Entropy float64 `json:"entropy"`
+	// AverageCodeLength is the payload bits per symbol of text; with
+	// FlagRLE it counts the symbols of the expanded text
+	AverageCodeLength float64 `json:"average_code_length"`
+	Symbols           int     `json:"symbols"`
+	DistinctSymbols   int     `json:"distinct_symbols"`
+}
+
+// ComputeStats returns the statistics of text coded in the container
+// described by h. Symbols are bytes if h has FlagBytes and runes otherwise.
+func ComputeStats(text string, h *HuffHeader) Stats {
+	frequency := BuildFrequencyTable(text)
+	if h.Flags&FlagBytes != 0 {
+		frequency = byteFrequencyTable(text)
+	}
+	s := Stats{
+		OriginalSize:    len(text),
+		CompressedSize:  h.Size() + int(h.PayloadSize()),
+		Symbols:         int(symbolCount(text, h.Flags)),
+		DistinctSymbols: len(frequency),
+	}
+	if s.CompressedSize > 0 {
+		s.Ratio = float64(s.OriginalSize) / float64(s.CompressedSize)
+	}
+	if s.Symbols > 0 {
+		for _, count := range frequency {
+			p := float64(count) / float64(s.Symbols)
+			s.Entropy -= p * math.Log2(p)
+		}
+		s.AverageCodeLength = float64(h.BitCount) / float64(s.Symbols)
+	}
+	return s
+}
+
+// WriteJSON writes the statistics to w as a single JSON object on one line
+func (s Stats) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
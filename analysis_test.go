@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEstimateCompressedBits(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"single symbol", "zzzzzz"},
+		{"sentence", "the quick brown fox jumps over the lazy dog"},
+		{"skewed", strings.Repeat("a", 100) + strings.Repeat("b", 10) + "c"},
+		{"unicode", "αβγαβγααα日本"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frequency := BuildFrequencyTable(tt.text)
+			want := len(Encode(tt.text, BuildCodes(BuildHuffmanTree(frequency))))
+			if got := EstimateCompressedBits(frequency); got != want {
+				t.Errorf("EstimateCompressedBits = %d, encoded %d bits", got, want)
+			}
+		})
+	}
+}
+
+func TestCompareHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"single symbol", "zzzzzz"},
+		{"sentence", "the quick brown fox jumps over the lazy dog"},
+		{"unicode", "αβγαβγααα日本"},
+		{"large alphabet", largeAlphabetText(300)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := CompareHeaders(BuildFrequencyTable(tt.text))
+			tree := encodeContainer(t, tt.text, EncodeOptions{})
+			canonical := encodeContainer(t, tt.text, EncodeOptions{Compact: true})
+			if c.TreeTotal() != len(tree) {
+				t.Errorf("TreeTotal = %d, tree container is %d bytes", c.TreeTotal(), len(tree))
+			}
+			if c.CanonicalTotal() != len(canonical) {
+				t.Errorf("CanonicalTotal = %d, canonical container is %d bytes", c.CanonicalTotal(), len(canonical))
+			}
+			if c.TreeHeaderBytes != headerSize(t, tree) || c.CanonicalHeaderBytes != headerSize(t, canonical) {
+				t.Errorf("header sizes %d and %d, want %d and %d",
+					c.TreeHeaderBytes, c.CanonicalHeaderBytes, headerSize(t, tree), headerSize(t, canonical))
+			}
+		})
+	}
+}
+
+func TestFrequencySkew(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency map[rune]int
+		want      float64
+	}{
+		{"empty", nil, 0},
+		{"single symbol", map[rune]int{'a': 5}, 0},
+		{"uniform", map[rune]int{'a': 3, 'b': 3, 'c': 3, 'd': 3}, 0},
+		{"one of two", map[rune]int{'a': 0, 'b': 10}, 0.5},
+		{"one of four", map[rune]int{'a': 0, 'b': 0, 'c': 0, 'd': 12}, 0.75},
+		{"linear", map[rune]int{'a': 1, 'b': 2, 'c': 3}, 2.0 / 9},
+		{"all zero", map[rune]int{'a': 0, 'b': 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FrequencySkew(tt.frequency); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("FrequencySkew = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if flat, skewed := FrequencySkew(BuildFrequencyTable("abcdefgh")), FrequencySkew(BuildFrequencyTable("aaaaaaaaaaaaaabcdefgh")); flat >= skewed {
+		t.Errorf("skew of a flat text %v, of a skewed one %v", flat, skewed)
+	}
+}
+
+func TestFrequencyHistogram(t *testing.T) {
+	frequency := map[rune]int{'c': 2, 'a': 5, 'd': 2, 'b': 1, 'e': 5, 'é': 2}
+	want := []SymbolFreq{{'a', 5}, {'e', 5}, {'c', 2}, {'d', 2}, {'é', 2}, {'b', 1}}
+	for i := 0; i < 10; i++ {
+		if got := FrequencyHistogram(frequency); !slices.Equal(got, want) {
+			t.Fatalf("FrequencyHistogram = %v, want %v", got, want)
+		}
+	}
+	if got := FrequencyHistogram(nil); len(got) != 0 {
+		t.Errorf("FrequencyHistogram(nil) = %v", got)
+	}
+}
+
+func TestCompareTrees(t *testing.T) {
+	text := "aaaaaaaabbbbccd"
+	optimal := BuildHuffmanTree(BuildFrequencyTable(text))
+	flat := treeFromSpec(t, map[rune]int{'a': 2, 'b': 2, 'c': 2, 'd': 2})
+	// The optimal tree codes a in 1 bit, b in 2, and c and d in 3
+	bitsA, bitsB, err := CompareTrees(text, optimal, flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 8*1 + 4*2 + 2*3 + 1*3; bitsA != want {
+		t.Errorf("optimal tree: %d bits, want %d", bitsA, want)
+	}
+	if want := 15 * 2; bitsB != want {
+		t.Errorf("flat tree: %d bits, want %d", bitsB, want)
+	}
+	if bitsA != len(Encode(text, BuildCodes(optimal))) {
+		t.Errorf("optimal tree: %d bits, encoded %d", bitsA, len(Encode(text, BuildCodes(optimal))))
+	}
+
+	missing := treeFromSpec(t, map[rune]int{'a': 1, 'b': 1})
+	for _, tt := range []struct {
+		name string
+		a, b *HuffmanNode
+	}{
+		{"first", missing, optimal},
+		{"second", optimal, missing},
+		{"nil", nil, optimal},
+	} {
+		if _, _, err := CompareTrees(text, tt.a, tt.b); err == nil {
+			t.Errorf("%s tree lacks symbols: no error", tt.name)
+		}
+	}
+	if bitsA, bitsB, err := CompareTrees("", nil, nil); bitsA != 0 || bitsB != 0 || err != nil {
+		t.Errorf("empty text: %d, %d, %v", bitsA, bitsB, err)
+	}
+}
+
+func TestPerSymbolSavings(t *testing.T) {
+	// The worked example of testdata/english.txt: a gets a 1-bit code and
+	// the rest 3-bit codes, the same as the fixed length for five symbols
+	frequency := map[rune]int{'a': 15, 'b': 7, 'c': 6, 'd': 6, 'e': 5}
+	want := map[rune]int{'a': 30, 'b': 0, 'c': 0, 'd': 0, 'e': 0}
+	if got := PerSymbolSavings(frequency); !maps.Equal(got, want) {
+		t.Errorf("PerSymbolSavings = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"single symbol", "zzzzzz"},
+		{"sentence", "the quick brown fox jumps over the lazy dog"},
+		{"skewed", strings.Repeat("a", 100) + strings.Repeat("b", 10) + "cd"},
+		{"large alphabet", largeAlphabetText(300)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frequency := BuildFrequencyTable(tt.text)
+			savings := PerSymbolSavings(frequency)
+			if len(savings) != len(frequency) {
+				t.Errorf("%d savings for %d symbols", len(savings), len(frequency))
+			}
+			total := 0
+			for _, s := range savings {
+				total += s
+			}
+			fixed := 1
+			for 1<<fixed < len(frequency) {
+				fixed++
+			}
+			if want := fixed*len([]rune(tt.text)) - EstimateCompressedBits(frequency); total != want {
+				t.Errorf("savings sum to %d, want %d", total, want)
+			}
+		})
+	}
+}
+
+func TestOccurrenceLengths(t *testing.T) {
+	codes := map[rune]string{'a': "0", 'b': "10", '日': "11"}
+	got, err := OccurrenceLengths("ab日a", codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 2, 2, 1}; !slices.Equal(got, want) {
+		t.Errorf("OccurrenceLengths = %v, want %v", got, want)
+	}
+	if _, err := OccurrenceLengths("abc", codes); err == nil {
+		t.Error("OccurrenceLengths accepted a symbol missing from the codes")
+	}
+
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(tt.text)))
+			lengths, err := OccurrenceLengths(tt.text, codes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			total := 0
+			for _, length := range lengths {
+				total += length
+			}
+			if len(lengths) != len([]rune(tt.text)) || total != len(Encode(tt.text, codes)) {
+				t.Errorf("%d lengths summing to %d bits, want one per rune summing to the payload size", len(lengths), total)
+			}
+		})
+	}
+}
+
+func TestStatsWriteJSON(t *testing.T) {
+	text := strings.Repeat("aab", 100)
+	h, _, err := BuildHuffFile(text, EncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := ComputeStats(text, h)
+	if stats.Symbols != 300 || stats.DistinctSymbols != 2 || stats.AverageCodeLength != 1 {
+		t.Errorf("stats %+v, want 300 symbols of 2 kinds at 1 bit each", stats)
+	}
+	if want := -(2.0/3*math.Log2(2.0/3) + 1.0/3*math.Log2(1.0/3)); math.Abs(stats.Entropy-want) > 1e-9 {
+		t.Errorf("entropy %v, want %v", stats.Entropy, want)
+	}
+
+	var buf bytes.Buffer
+	if err := stats.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Errorf("WriteJSON wrote %q, want one line", line)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"original_size", "compressed_size", "ratio", "entropy", "average_code_length", "symbols", "distinct_symbols"}
+	for _, key := range keys {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("no %q field in %s", key, line)
+		}
+	}
+	if len(fields) != len(keys) {
+		t.Errorf("%d fields, want %d: %s", len(fields), len(keys), line)
+	}
+	var decoded Stats
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded != stats {
+		t.Errorf("decoded %+v, %v; want %+v", decoded, err, stats)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// A multi-block archive holds .huff containers back to back, each with its
+// own table, so blocks compressed separately can be joined without being
+// recompressed. Its layout is:
+//
+//	magic    "HUFM"
+//	version  1 byte
+//	count    uvarint, number of blocks
+//	blocks:
+//	  length   uvarint, length of the block
+//	  block    a complete .huff container
+//
+// It decodes to the concatenation of its blocks.
+const (
+	archiveMagic   = "HUFM"
+	archiveVersion = 1
+)
+
+// ErrNotArchive is returned when input does not start with an archive header
+var ErrNotArchive = errors.New("not a multi-block archive")
+
+// ConcatBlocks joins .huff containers, or existing archives, into one
+// archive that decodes to the concatenation of their contents. Each block
+// keeps its own table; nothing is decoded or recompressed, but every
+// block's header checksum is verified.
+func ConcatBlocks(blocks ...[]byte) ([]byte, error) {
+	var flat [][]byte
+	for i, block := range blocks {
+		if bytes.HasPrefix(block, []byte(archiveMagic)) {
+			inner, err := splitArchive(block)
+			if err != nil {
+				return nil, fmt.Errorf("block %d: %w", i, err)
+			}
+			flat = append(flat, inner...)
+			continue
+		}
+		if err := checkBlock(block); err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		flat = append(flat, block)
+	}
+
+	archive := append([]byte(archiveMagic), archiveVersion)
+	archive = binary.AppendUvarint(archive, uint64(len(flat)))
+	for _, block := range flat {
+		archive = binary.AppendUvarint(archive, uint64(len(block)))
+		archive = append(archive, block...)
+	}
+	return archive, nil
+}
+
+// checkBlock verifies that block is exactly one .huff container
+func checkBlock(block []byte) error {
+	h, err := ReadHuffHeader(bytes.NewReader(block))
+	if err != nil {
+		return err
+	}
+	if want := uint64(h.Size()) + h.PayloadSize(); uint64(len(block)) != want {
+		return fmt.Errorf("container is %d bytes, header says %d", len(block), want)
+	}
+	return nil
+}
+
+// splitArchive returns the containers of an archive without decoding them
+func splitArchive(archive []byte) ([][]byte, error) {
+	r := bytes.NewReader(archive)
+	magic := make([]byte, len(archiveMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic[:len(archiveMagic)]) != archiveMagic {
+		return nil, ErrNotArchive
+	}
+	if version := magic[len(archiveMagic)]; version != archiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", version)
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	// Every block takes at least one byte, which bounds a corrupt count
+	if count > uint64(r.Len()) {
+		return nil, fmt.Errorf("block count %d exceeds the remaining %d bytes", count, r.Len())
+	}
+	blocks := make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, unexpectedEOF(err))
+		}
+		if length > uint64(r.Len()) {
+			return nil, fmt.Errorf("block %d: %w", i, io.ErrUnexpectedEOF)
+		}
+		start := len(archive) - r.Len()
+		blocks = append(blocks, archive[start:start+int(length)])
+		r.Seek(int64(length), io.SeekCurrent)
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("unexpected data after the last block")
+	}
+	return blocks, nil
+}
+
+// DecodeBlocks decodes every block of an archive, verifying each against
+// its checksum
+func DecodeBlocks(archive []byte) ([][]byte, error) {
+	blocks, err := splitArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	decoded := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		_, text, err := ReadHuffFile(bytes.NewReader(block))
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		decoded[i] = []byte(text)
+	}
+	return decoded, nil
+}
+
+// ReadBlocks reads an archive from r one block at a time, so archives
+// larger than memory can be decoded. It calls fn with the index of each
+// block and a Decoder for its contents, which fn may read as far as it
+// wants: the rest of the block is then skipped using its stored length,
+// by seeking if r is an io.Seeker. A block read to the end is verified
+// against its checksum, a mismatch being returned by the Decoder's Read
+// in place of io.EOF as usual. An error from fn stops the walk and is
+// returned.
+func ReadBlocks(r io.Reader, fn func(i int, block *Decoder) error) error {
+	magic := make([]byte, len(archiveMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic[:len(archiveMagic)]) != archiveMagic {
+		return ErrNotArchive
+	}
+	if version := magic[len(archiveMagic)]; version != archiveVersion {
+		return fmt.Errorf("unsupported archive version %d", version)
+	}
+	br := &byteReader{r: r}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	for i := uint64(0); i < count; i++ {
+		length, err := binary.ReadUvarint(br)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", i, unexpectedEOF(err))
+		}
+		block := &io.LimitedReader{R: r, N: int64(length)}
+		d, err := NewContainerDecoder(block)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+		if err := fn(int(i), d); err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+		if err := skipBytes(r, block.N); err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		if err != nil {
+			return err
+		}
+		return errors.New("unexpected data after the last block")
+	}
+	return nil
+}
+
+// skipBytes discards the next n bytes of r, seeking past them if it can
+func skipBytes(r io.Reader, n int64) error {
+	if n == 0 {
+		return nil
+	}
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekCurrent)
+		return err
+	}
+	if _, err := io.CopyN(io.Discard, r, n); err != nil {
+		return unexpectedEOF(err)
+	}
+	return nil
+}
+
+// ArchiveFiles compresses the files at paths with opts into an archive
+// holding one block per file, in the order of paths. Up to workers files
+// are read and compressed at once; the blocks are placed by input
+// position, so the archive is the same whatever order they finish in, and
+// the same as with one worker. If any file fails, the error of the first
+// failing path in input order is returned.
+func ArchiveFiles(paths []string, opts EncodeOptions, workers int) ([]byte, error) {
+	workers = max(1, min(workers, len(paths)))
+	blocks := make([][]byte, len(paths))
+	errs := make([]error, len(paths))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				blocks[i], errs[i] = compressFile(paths[i], opts)
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", paths[i], err)
+		}
+	}
+	return ConcatBlocks(blocks...)
+}
+
+// compressFile reads the file at path and returns it as a .huff container
+func compressFile(path string, opts EncodeOptions) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	header, payload, err := BuildHuffFile(string(data), opts)
+	if err != nil {
+		return nil, err
+	}
+	return append(header.appendTo(nil), payload...), nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConcatBlocksRoundTrip(t *testing.T) {
+	texts := []string{"the first block, with its own table", "ünïcödé in the second", "", "zzzzzzzz"}
+	var blocks [][]byte
+	for _, text := range texts {
+		blocks = append(blocks, encodeContainer(t, text, EncodeOptions{}))
+	}
+	archive, err := ConcatBlocks(blocks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeBlocks(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(texts) {
+		t.Fatalf("%d blocks, want %d", len(decoded), len(texts))
+	}
+	var joined, want []byte
+	for i, block := range decoded {
+		if string(block) != texts[i] {
+			t.Errorf("block %d = %q, want %q", i, block, texts[i])
+		}
+		joined = append(joined, block...)
+		want = append(want, texts[i]...)
+	}
+	if !bytes.Equal(joined, want) {
+		t.Errorf("joined blocks %q, want %q", joined, want)
+	}
+
+	// Archives are flattened into their blocks
+	nested, err := ConcatBlocks(archive, encodeContainer(t, "appended", EncodeOptions{Compact: true}), archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = DecodeBlocks(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2*len(texts)+1 || string(decoded[len(texts)]) != "appended" {
+		t.Errorf("nested archive decodes to %q", decoded)
+	}
+}
+
+func TestConcatBlocksErrors(t *testing.T) {
+	block := encodeContainer(t, "a valid block", EncodeOptions{})
+	if _, err := ConcatBlocks(block, []byte("not a container")); err == nil {
+		t.Error("ConcatBlocks accepted a block that is not a container")
+	}
+	if _, err := ConcatBlocks(append(bytes.Clone(block), 0)); err == nil {
+		t.Error("ConcatBlocks accepted a block with trailing data")
+	}
+	archive, err := ConcatBlocks(block, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeBlocks(block); err != ErrNotArchive {
+		t.Errorf("container: error %v, want ErrNotArchive", err)
+	}
+	for n := len(archiveMagic); n < len(archive); n++ {
+		if _, err := DecodeBlocks(archive[:n]); err == nil {
+			t.Errorf("%d of %d bytes: no error", n, len(archive))
+		}
+	}
+	if _, err := DecodeBlocks(append(bytes.Clone(archive), 0)); err == nil {
+		t.Error("no error for data after the last block")
+	}
+}
+
+func TestArchiveMixedBitOrders(t *testing.T) {
+	first, second := "packed most significant bit first", "packed least significant bit first"
+	msb := encodeContainer(t, first, EncodeOptions{})
+	lsb := encodeContainer(t, second, EncodeOptions{LSBFirst: true})
+	for _, tt := range []struct {
+		data []byte
+		lsb  bool
+	}{{msb, false}, {lsb, true}} {
+		h, err := ReadHuffHeader(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := h.Flags&FlagLSBFirst != 0; got != tt.lsb {
+			t.Fatalf("FlagLSBFirst = %v, want %v", got, tt.lsb)
+		}
+	}
+	for _, blocks := range [][][]byte{{msb, lsb}, {lsb, msb}} {
+		archive, err := ConcatBlocks(blocks...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeBlocks(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var streamed []string
+		err = ReadBlocks(bytes.NewReader(archive), func(_ int, block *Decoder) error {
+			text, err := io.ReadAll(block)
+			streamed = append(streamed, string(text))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, block := range blocks {
+			_, want, err := ReadHuffFile(bytes.NewReader(block))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(decoded[i]) != want || streamed[i] != want {
+				t.Errorf("block %d: DecodeBlocks %q, ReadBlocks %q; want %q", i, decoded[i], streamed[i], want)
+			}
+		}
+	}
+}
+
+func TestReadBlocks(t *testing.T) {
+	texts := []string{
+		strings.Repeat("the first of three blocks ", 200),
+		strings.Repeat("ünïcödé in the second, packed least significant bit first ", 100),
+		strings.Repeat("and a compact third ", 300),
+	}
+	var blocks [][]byte
+	for i, opts := range []EncodeOptions{{}, {LSBFirst: true}, {Compact: true}} {
+		blocks = append(blocks, encodeContainer(t, texts[i], opts))
+	}
+	archive, err := ConcatBlocks(blocks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ends[i] is the archive offset just past block i
+	var ends []int
+	end := len(archiveMagic) + 1 + len(binary.AppendUvarint(nil, uint64(len(blocks))))
+	for _, block := range blocks {
+		end += len(binary.AppendUvarint(nil, uint64(len(block)))) + len(block)
+		ends = append(ends, end)
+	}
+
+	readers := []struct {
+		name string
+		wrap func(*bytes.Reader) io.Reader
+	}{
+		{"seeker", func(r *bytes.Reader) io.Reader { return r }},
+		{"plain reader", func(r *bytes.Reader) io.Reader { return struct{ io.Reader }{r} }},
+	}
+	reads := []struct {
+		name   string
+		prefix int // bytes of each block to read, or -1 for all of them
+	}{
+		{"whole blocks", -1},
+		{"prefixes", 10},
+		{"unread", 0},
+	}
+	for _, rt := range readers {
+		for _, read := range reads {
+			prefix := read.prefix
+			t.Run(rt.name+"/"+read.name, func(t *testing.T) {
+				r := bytes.NewReader(archive)
+				var visited []int
+				err := ReadBlocks(rt.wrap(r), func(i int, block *Decoder) error {
+					visited = append(visited, i)
+					// Only the current block has been read from the archive
+					if pos := len(archive) - r.Len(); pos > ends[i] {
+						t.Errorf("block %d: read %d bytes of the archive, past the block's end at %d", i, pos, ends[i])
+					}
+					var text []byte
+					var err error
+					if prefix < 0 {
+						text, err = io.ReadAll(block)
+					} else {
+						text = make([]byte, prefix)
+						_, err = io.ReadFull(block, text)
+					}
+					if err != nil {
+						return err
+					}
+					if want := texts[i][:len(text)]; string(text) != want || prefix < 0 && len(text) != len(texts[i]) {
+						t.Errorf("block %d = %q, want %q", i, text, want)
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(visited) != len(blocks) || visited[0] != 0 || visited[2] != 2 {
+					t.Errorf("visited blocks %v, want 0 to %d", visited, len(blocks)-1)
+				}
+			})
+		}
+	}
+
+	t.Run("stop", func(t *testing.T) {
+		errStop := errors.New("stop")
+		var visited int
+		err := ReadBlocks(bytes.NewReader(archive), func(i int, _ *Decoder) error {
+			visited++
+			if i == 1 {
+				return errStop
+			}
+			return nil
+		})
+		if !errors.Is(err, errStop) || visited != 2 {
+			t.Errorf("error %v after %d blocks, want the callback's error after 2", err, visited)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		err := ReadBlocks(bytes.NewReader(archive[:ends[1]+10]), func(int, *Decoder) error { return nil })
+		if err == nil {
+			t.Error("no error for an archive cut inside its last block")
+		}
+	})
+	t.Run("not an archive", func(t *testing.T) {
+		if err := ReadBlocks(bytes.NewReader(blocks[0]), nil); err != ErrNotArchive {
+			t.Errorf("error %v, want ErrNotArchive", err)
+		}
+	})
+}
+
+func TestArchiveFilesConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	var paths, texts []string
+	for i := 0; i < 20; i++ {
+		// Sizes vary so the workers finish out of order
+		text := strings.Repeat(fmt.Sprintf("file %d of the archive ", i), 1+(i*37)%50)
+		path := filepath.Join(dir, fmt.Sprintf("f%02d.txt", i))
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths, texts = append(paths, path), append(texts, text)
+	}
+
+	for _, opts := range []EncodeOptions{{}, {Compact: true}} {
+		t.Run(modeName(opts), func(t *testing.T) {
+			sequential, err := ArchiveFiles(paths, opts, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := DecodeBlocks(sequential)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, block := range decoded {
+				if string(block) != texts[i] {
+					t.Errorf("block %d = %q, want %q", i, block, texts[i])
+				}
+			}
+			for _, workers := range []int{0, 2, 4, len(paths), 100} {
+				for run := 0; run < 3; run++ {
+					concurrent, err := ArchiveFiles(paths, opts, workers)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(concurrent, sequential) {
+						t.Fatalf("%d workers, run %d: archive differs from the sequential one", workers, run)
+					}
+				}
+			}
+		})
+	}
+
+	missing := slices.Clone(paths)
+	missing[5] = filepath.Join(dir, "missing5.txt")
+	missing[12] = filepath.Join(dir, "missing12.txt")
+	_, err := ArchiveFiles(missing, EncodeOptions{}, 8)
+	if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "missing5.txt") {
+		t.Errorf("error %v, want the first missing file", err)
+	}
+
+	empty, err := ArchiveFiles(nil, EncodeOptions{}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks, err := DecodeBlocks(empty); err != nil || len(blocks) != 0 {
+		t.Errorf("archive of no files = %d blocks, %v", len(blocks), err)
+	}
+}
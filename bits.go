@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+)
+
+// PackBits packs a string of '0' and '1' characters into bytes, most
+// significant bit first, padding the last byte with zeros. It returns the
+// packed bytes and the number of meaningful bits.
+func PackBits(encoded string) ([]byte, int) {
+	packed := make([]byte, (len(encoded)+7)/8)
+	for i := 0; i < len(encoded); i++ {
+		if encoded[i] == '1' {
+			packed[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return packed, len(encoded)
+}
+
+// EncodeAppend Huffman-codes text straight into packed bits appended to
+// dst, starting on a fresh byte, and returns the extended slice and the
+// payload bit count. Reusing dst across calls avoids allocating once it
+// has grown large enough. On error dst is returned unextended.
+func EncodeAppend(dst []byte, text string, codes map[rune]string) ([]byte, int, error) {
+	start := len(dst)
+	var cur byte
+	var curBits uint
+	bitCount := 0
+	for _, char := range text {
+		code, ok := codes[char]
+		if !ok {
+			return dst[:start], 0, fmt.Errorf("symbol %q is not in the code table", char)
+		}
+		for i := 0; i < len(code); i++ {
+			cur = cur<<1 | (code[i] - '0')
+			curBits++
+			if curBits == 8 {
+				dst = append(dst, cur)
+				cur, curBits = 0, 0
+			}
+		}
+		bitCount += len(code)
+	}
+	if curBits > 0 {
+		dst = append(dst, cur<<(8-curBits))
+	}
+	return dst, bitCount, nil
+}
+
+// reverseBitOrder reverses the bits of every byte of data in place,
+// converting between most and least significant bit first packing
+func reverseBitOrder(data []byte) {
+	for i, b := range data {
+		data[i] = bits.Reverse8(b)
+	}
+}
+
+// lsbFirstReader reads a payload packed least significant bit first,
+// returning it packed most significant bit first
+type lsbFirstReader struct {
+	r io.Reader
+}
+
+func (r lsbFirstReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	reverseBitOrder(p[:n])
+	return n, err
+}
+
+// UnpackBits expands the first bitCount bits of packed data back into a
+// string of '0' and '1' characters
+func UnpackBits(data []byte, bitCount int) string {
+	var sb strings.Builder
+	sb.Grow(bitCount)
+	for i := 0; i < bitCount; i++ {
+		if data[i/8]&(0x80>>(i%8)) != 0 {
+			sb.WriteByte('1')
+		} else {
+			sb.WriteByte('0')
+		}
+	}
+	return sb.String()
+}
+
+// BitDump is the payload of a text in every form it passes through
+type BitDump struct {
+	Bits     string // codes as '0' and '1' characters
+	Packed   []byte // Bits packed most significant bit first
+	BitCount int
+}
+
+// DebugBits codes text both as a bit string and straight into packed
+// bytes, and checks that the two agree and that unpacking the bytes gives
+// back the bit string, which catches padding and off-by-one packing bugs.
+// A disagreement is returned as an error along with the dump.
+func DebugBits(text string, codes map[rune]string) (BitDump, error) {
+	encoded, err := encodeChecked(text, codes)
+	if err != nil {
+		return BitDump{}, err
+	}
+	packed, bitCount, err := EncodeAppend(nil, text, codes)
+	if err != nil {
+		return BitDump{}, err
+	}
+	dump := BitDump{Bits: encoded, Packed: packed, BitCount: bitCount}
+	if bitCount != len(encoded) {
+		return dump, fmt.Errorf("packed %d bits but the bit string has %d", bitCount, len(encoded))
+	}
+	if want, _ := PackBits(encoded); string(want) != string(packed) {
+		return dump, errors.New("packed bytes differ from the packed bit string")
+	}
+	if unpacked := UnpackBits(packed, bitCount); unpacked != encoded {
+		return dump, errors.New("unpacked bits differ from the bit string")
+	}
+	return dump, nil
+}
+
+// bitReader reads bits, most significant first, from an io.Reader
+type bitReader struct {
+	r         io.Reader
+	buf       []byte
+	pos, end  int // unread bytes are buf[pos:end]
+	cur       byte
+	curBits   uint // bits of cur not yet consumed
+	remaining int  // payload bits not yet consumed
+	consumed  int  // payload bits consumed so far
+	err       error
+}
+
+func newBitReader(r io.Reader, bitCount int) *bitReader {
+	return &bitReader{r: r, buf: make([]byte, 4096), remaining: bitCount}
+}
+
+// readBit returns the next bit, or io.EOF once bitCount bits have been read
+func (br *bitReader) readBit() (byte, error) {
+	if br.remaining == 0 {
+		return 0, io.EOF
+	}
+	if br.curBits == 0 {
+		if err := br.fill(); err != nil {
+			return 0, err
+		}
+		br.cur = br.buf[br.pos]
+		br.pos++
+		br.curBits = 8
+	}
+	br.curBits--
+	br.remaining--
+	br.consumed++
+	return (br.cur >> br.curBits) & 1, nil
+}
+
+// fill makes at least one unread byte available. Readers such as network
+// connections may return fewer bytes than requested, or none at all, so it
+// keeps reading until a byte arrives or the reader fails.
+func (br *bitReader) fill() error {
+	for br.pos == br.end {
+		// A footer read by r may have just revealed the payload length
+		if br.remaining == 0 {
+			return io.EOF
+		}
+		if br.err != nil {
+			if br.err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return br.err
+		}
+		n, err := br.r.Read(br.buf)
+		br.pos, br.end, br.err = 0, n, err
+	}
+	return nil
+}
+
+var (
+	// errInvalidCode is reported when the bits read match no code
+	errInvalidCode = errors.New("invalid code")
+	// errTruncatedCode is reported when the payload ends partway through a code
+	errTruncatedCode = errors.New("encoded data ends in the middle of a code")
+)
+
+// DecodeError reports where in a payload decoding failed. Err is the
+// underlying cause; for a truncated payload the offset is the end of the
+// data.
+type DecodeError struct {
+	BitOffset  int // offset of the bit at which decoding failed
+	ByteOffset int // offset of the byte holding that bit
+	Err        error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v at bit offset %d (byte %d)", e.Err, e.BitOffset, e.ByteOffset)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeErrorAt returns a DecodeError for err at bit offset bit
+func decodeErrorAt(bit int, err error) *DecodeError {
+	return &DecodeError{BitOffset: bit, ByteOffset: bit / 8, Err: err}
+}
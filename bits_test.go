@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPackUnpackBits(t *testing.T) {
+	for _, encoded := range []string{"", "1", "0101", "10000000", "101010101", "111111111111"} {
+		packed, bitCount := PackBits(encoded)
+		if len(packed) != (len(encoded)+7)/8 || bitCount != len(encoded) {
+			t.Errorf("PackBits(%q) = %d bytes, %d bits", encoded, len(packed), bitCount)
+		}
+		if got := UnpackBits(packed, bitCount); got != encoded {
+			t.Errorf("UnpackBits(PackBits(%q)) = %q", encoded, got)
+		}
+	}
+}
+
+func TestEncodeAppend(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			root := BuildHuffmanTree(BuildFrequencyTable(tt.text))
+			codes := BuildCodes(root)
+			prefix := []byte{0xde, 0xad}
+			dst, bitCount, err := EncodeAppend(bytes.Clone(prefix), tt.text, codes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dst[:len(prefix)], prefix) {
+				t.Fatal("EncodeAppend overwrote dst")
+			}
+			want, wantBits := PackBits(Encode(tt.text, codes))
+			if !bytes.Equal(dst[len(prefix):], want) || bitCount != wantBits {
+				t.Errorf("EncodeAppend differs from PackBits(Encode(...))")
+			}
+			decoded, err := DecodeBytes(dst[len(prefix):], bitCount, root)
+			if err != nil || decoded != tt.text {
+				t.Errorf("decoding the appended payload = %q, %v", decoded, err)
+			}
+		})
+	}
+}
+
+func TestEncodeAppendErrors(t *testing.T) {
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable("ab")))
+	dst := []byte{1, 2}
+	got, _, err := EncodeAppend(dst, "abc", codes)
+	if err == nil {
+		t.Fatal("EncodeAppend accepted a symbol missing from the codes")
+	}
+	if len(got) != len(dst) {
+		t.Errorf("dst extended to %d bytes on error", len(got))
+	}
+}
+
+func TestEncodeAppendReuseAllocs(t *testing.T) {
+	text := benchmarkText(4 << 10)
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+	dst, _, _ := EncodeAppend(nil, text, codes)
+	allocs := testing.AllocsPerRun(10, func() {
+		dst, _, _ = EncodeAppend(dst[:0], text, codes)
+	})
+	if allocs != 0 {
+		t.Errorf("EncodeAppend into a reused buffer allocated %v times", allocs)
+	}
+}
+
+func TestDebugBits(t *testing.T) {
+	codes := map[rune]string{'a': "0", 'b': "10", 'c': "11"}
+	dump, err := DebugBits("abc", codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dump.Bits != "01011" || !bytes.Equal(dump.Packed, []byte{0x58}) || dump.BitCount != 5 {
+		t.Errorf("DebugBits = %+v, want 01011 packed as 0x58", dump)
+	}
+
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(tt.text)))
+			dump, err := DebugBits(tt.text, codes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := Encode(tt.text, codes); dump.Bits != want || dump.BitCount != len(want) {
+				t.Errorf("dump of %d bits differs from Encode", dump.BitCount)
+			}
+		})
+	}
+
+	if _, err := DebugBits("abcd", codes); err == nil {
+		t.Error("DebugBits accepted a symbol missing from the codes")
+	}
+}
+
+func BenchmarkEncodeAppend(b *testing.B) {
+	text := benchmarkText(4 << 10)
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+	b.Run("allocating", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(text)))
+		for i := 0; i < b.N; i++ {
+			PackBits(Encode(text, codes))
+		}
+	})
+	b.Run("reused buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(text)))
+		var dst []byte
+		for i := 0; i < b.N; i++ {
+			var err error
+			if dst, _, err = EncodeAppend(dst[:0], text, codes); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
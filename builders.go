@@ -0,0 +1,99 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// heightNode pairs a subtree with its height for tie-breaking
+type heightNode struct {
+	node   *HuffmanNode
+	height int
+}
+
+// varianceHeap orders subtrees by frequency, preferring the shallower
+// subtree when frequencies tie
+type varianceHeap []heightNode
+
+func (h varianceHeap) Len() int { return len(h) }
+func (h varianceHeap) Less(i, j int) bool {
+	if h[i].node.frequency != h[j].node.frequency {
+		return h[i].node.frequency < h[j].node.frequency
+	}
+	return h[i].height < h[j].height
+}
+func (h varianceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *varianceHeap) Push(x interface{}) { *h = append(*h, x.(heightNode)) }
+func (h *varianceHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// BuildHuffmanTreeMinVariance builds an optimal Huffman tree that, among all
+// trees of equal total cost, has the smallest maximum code length and code
+// length variance. Ties between equal frequencies are broken by merging the
+// shallower subtrees first.
+func BuildHuffmanTreeMinVariance(frequency map[rune]int) *HuffmanNode {
+	pairs := positiveFreqs(SortedSymbolFreqs(frequency))
+	if len(pairs) == 0 {
+		return nil
+	}
+	h := &varianceHeap{}
+	for _, pair := range pairs {
+		heap.Push(h, heightNode{node: &HuffmanNode{character: pair.Symbol, frequency: pair.Freq}})
+	}
+
+	for h.Len() > 1 {
+		left := heap.Pop(h).(heightNode)
+		right := heap.Pop(h).(heightNode)
+		heap.Push(h, heightNode{
+			node: &HuffmanNode{
+				frequency: left.node.frequency + right.node.frequency,
+				left:      left.node,
+				right:     right.node,
+			},
+			height: max(left.height, right.height) + 1,
+		})
+	}
+
+	return heap.Pop(h).(heightNode).node
+}
+
+// BuildHuffmanTreeWithPrior builds a Huffman tree from observed counts plus
+// prior counts, which bias the code table toward expected future data and
+// give symbols absent from the sample a code of reasonable length. Every
+// symbol listed in prior is reserved a code, even with a count of zero.
+func BuildHuffmanTreeWithPrior(observed, prior map[rune]int) *HuffmanNode {
+	combined := make(map[rune]int, len(observed)+len(prior))
+	for char, freq := range observed {
+		combined[char] += freq
+	}
+	for char, freq := range prior {
+		combined[char] = max(combined[char]+freq, 1)
+	}
+	return BuildHuffmanTree(combined)
+}
+
+// BuildHuffmanTreeMinLength builds a Huffman tree in which no code is
+// shorter than minLength bits, for decoders that cannot handle short codes.
+// Shorter codes are lengthened to minLength and the tree is rebuilt
+// canonically; lengthening codes keeps the Kraft sum at most 1, so the
+// result is always a valid prefix code, though some bit patterns then
+// decode to nothing. Each occurrence of a lengthened symbol costs the
+// extra bits, so the payload grows by the sum of frequency times added
+// length over those symbols.
+func BuildHuffmanTreeMinLength(frequency map[rune]int, minLength int) (*HuffmanNode, error) {
+	if minLength < 0 || minLength > maxTreeDepth {
+		return nil, fmt.Errorf("invalid minimum code length %d", minLength)
+	}
+	lengths := CodeLengths(BuildHuffmanTree(frequency))
+	for char, length := range lengths {
+		if length < minLength {
+			lengths[char] = minLength
+		}
+	}
+	return CanonicalTree(lengths)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+// lengthStats returns the payload size in bits of root's codes for
+// frequency, their longest length and the variance of their lengths,
+// weighted by frequency
+func lengthStats(root *HuffmanNode, frequency map[rune]int) (cost, longest int, variance float64) {
+	lengths := CodeLengths(root)
+	total, sum := 0, 0
+	for char, freq := range frequency {
+		total += freq
+		sum += freq * lengths[char]
+		longest = max(longest, lengths[char])
+	}
+	mean := float64(sum) / float64(total)
+	for char, freq := range frequency {
+		d := float64(lengths[char]) - mean
+		variance += float64(freq) * d * d
+	}
+	return sum, longest, variance / float64(total)
+}
+
+func TestBuildHuffmanTreeMinVariance(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency map[rune]int
+		longest   int // of the min-variance tree
+	}{
+		{"textbook", map[rune]int{'a': 4, 'b': 2, 'c': 2, 'd': 1, 'e': 1}, 3},
+		{"all equal", map[rune]int{'a': 3, 'b': 3, 'c': 3, 'd': 3, 'e': 3, 'f': 3}, 3},
+		{"powers", map[rune]int{'a': 8, 'b': 4, 'c': 4, 'd': 2, 'e': 2, 'f': 1, 'g': 1}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := BuildHuffmanTree(tt.frequency)
+			minVar := BuildHuffmanTreeMinVariance(tt.frequency)
+			defCost, defLongest, defVariance := lengthStats(def, tt.frequency)
+			cost, longest, variance := lengthStats(minVar, tt.frequency)
+			if cost != defCost {
+				t.Fatalf("min-variance tree costs %d bits, default %d", cost, defCost)
+			}
+			if longest != tt.longest {
+				t.Errorf("longest code %d, want %d", longest, tt.longest)
+			}
+			if longest > defLongest {
+				t.Errorf("longest code %d, default builder %d", longest, defLongest)
+			}
+			if variance > defVariance+1e-9 {
+				t.Errorf("variance %.3f, default builder %.3f", variance, defVariance)
+			}
+		})
+	}
+}
+
+func TestBuildHuffmanTreeWithPrior(t *testing.T) {
+	observed := map[rune]int{'a': 10, 'b': 1, 'c': 1}
+	t.Run("prior changes lengths", func(t *testing.T) {
+		before := CodeLengths(BuildHuffmanTree(observed))
+		after := CodeLengths(BuildHuffmanTreeWithPrior(observed, map[rune]int{'c': 20}))
+		if before['c'] <= before['a'] {
+			t.Fatalf("without a prior c has length %d, a %d", before['c'], before['a'])
+		}
+		if after['c'] >= after['a'] {
+			t.Errorf("with a prior favouring c, c has length %d, a %d", after['c'], after['a'])
+		}
+	})
+	t.Run("unseen prior symbol", func(t *testing.T) {
+		for _, prior := range []map[rune]int{{'z': 5}, {'z': 0}} {
+			root := BuildHuffmanTreeWithPrior(observed, prior)
+			codes := BuildCodes(root)
+			if _, ok := codes['z']; !ok {
+				t.Errorf("prior %v: no code for z", prior)
+			}
+			for char := range observed {
+				if _, ok := codes[char]; !ok {
+					t.Errorf("prior %v: no code for observed %q", prior, char)
+				}
+			}
+			if got := Decode(Encode("zabz", codes), root); got != "zabz" {
+				t.Errorf("prior %v: Decode = %q", prior, got)
+			}
+		}
+	})
+	t.Run("nil prior", func(t *testing.T) {
+		got := CodeLengths(BuildHuffmanTreeWithPrior(observed, nil))
+		if want := CodeLengths(BuildHuffmanTree(observed)); !maps.Equal(got, want) {
+			t.Errorf("lengths %v, want %v", got, want)
+		}
+	})
+}
+
+func TestBuildHuffmanTreeMinLength(t *testing.T) {
+	frequency := map[rune]int{'a': 100, 'b': 20, 'c': 5, 'd': 1}
+	for minLength := 0; minLength <= 6; minLength++ {
+		root, err := BuildHuffmanTreeMinLength(frequency, minLength)
+		if err != nil {
+			t.Fatalf("min length %d: %v", minLength, err)
+		}
+		codes := BuildCodes(root)
+		if len(codes) != len(frequency) || !IsPrefixCode(codes) {
+			t.Fatalf("min length %d: codes %v", minLength, codes)
+		}
+		optimal := CodeLengths(BuildHuffmanTree(frequency))
+		for char, code := range codes {
+			if want := max(optimal[char], minLength); len(code) != want {
+				t.Errorf("min length %d: %q has length %d, want %d", minLength, char, len(code), want)
+			}
+		}
+		if got := Decode(Encode("abcdcba", codes), root); got != "abcdcba" {
+			t.Errorf("min length %d: Decode = %q", minLength, got)
+		}
+	}
+	for _, minLength := range []int{-1, maxTreeDepth + 1} {
+		if _, err := BuildHuffmanTreeMinLength(frequency, minLength); err == nil {
+			t.Errorf("min length %d: no error", minLength)
+		}
+	}
+}
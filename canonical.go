@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// CanonicalCodes assigns canonical Huffman codes for the given code lengths:
+// symbols are ordered by code length and then by code point, and each gets
+// the next binary value, extended with zeros when the length grows. It
+// fails if the lengths cannot form a prefix code.
+func CanonicalCodes(lengths map[rune]int) (map[rune]string, error) {
+	return CanonicalCodesOrdered(lengths)
+}
+
+// orderedCodes gives each symbol, in order, the next binary value extended
+// with zeros to its code length. The symbols must be ordered by code
+// length; it fails if the lengths cannot form a prefix code.
+func orderedCodes[T comparable](symbols []T, lengths map[T]int) (map[T]string, error) {
+	codes := make(map[T]string, len(symbols))
+	var code []byte
+	for i, char := range symbols {
+		for len(code) < lengths[char] {
+			code = append(code, '0')
+		}
+		codes[char] = string(code)
+
+		// Increment the code; carrying out of the top bit means the code
+		// space is exhausted
+		j := len(code) - 1
+		for ; j >= 0 && code[j] == '1'; j-- {
+			code[j] = '0'
+		}
+		if j < 0 {
+			if i != len(symbols)-1 {
+				return nil, errors.New("code lengths oversubscribe the code space")
+			}
+			break
+		}
+		code[j] = '1'
+	}
+	return codes, nil
+}
+
+// CanonicalTree builds the decoding tree for the canonical codes with the
+// given code lengths
+func CanonicalTree(lengths map[rune]int) (*HuffmanNode, error) {
+	codes, err := CanonicalCodes(lengths)
+	if err != nil {
+		return nil, err
+	}
+	return TreeFromCodes(codes)
+}
+
+// IsCanonical reports whether the codes of a tree are the canonical codes
+// for its code lengths, so that storing only the lengths, as a compact
+// header does, preserves the exact codes
+func IsCanonical(root *HuffmanNode) bool {
+	canonical, err := CanonicalCodes(CodeLengths(root))
+	if err != nil {
+		return false
+	}
+	codes := BuildCodes(root)
+	for char, code := range codes {
+		if canonical[char] != code {
+			return false
+		}
+	}
+	return len(codes) == len(canonical)
+}
+
+// repeatFlag marks a code length byte that is followed by a repeat count
+const repeatFlag = 0x80
+
+// maxCompactLength is the longest code AppendCodeLengths can store
+const maxCompactLength = repeatFlag - 1
+
+// AppendCodeLengths appends a compact encoding of the code lengths to dst.
+// Lengths must be between 1 and maxCompactLength.
+// Symbols are stored in code point order as gaps from the previous symbol,
+// so dense or clustered alphabets cost about a byte per symbol, and the
+// lengths are run-length encoded in the style of DEFLATE's code-length
+// codes: a length byte with the high bit set is followed by a repeat count.
+//
+//	count    uvarint, number of symbols
+//	gaps     count uvarints, each symbol minus the previous symbol minus 1
+//	lengths  runs covering count symbols: length, or length|0x80 and a
+//	         uvarint repeat count
+func AppendCodeLengths(dst []byte, lengths map[rune]int) []byte {
+	symbols := make([]rune, 0, len(lengths))
+	for char := range lengths {
+		symbols = append(symbols, char)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+
+	dst = binary.AppendUvarint(dst, uint64(len(symbols)))
+	prev := int64(-1)
+	for _, char := range symbols {
+		dst = binary.AppendUvarint(dst, uint64(int64(char)-prev-1))
+		prev = int64(char)
+	}
+	for i := 0; i < len(symbols); {
+		length := lengths[symbols[i]]
+		run := 1
+		for i+run < len(symbols) && lengths[symbols[i+run]] == length {
+			run++
+		}
+		if run == 1 {
+			dst = append(dst, byte(length))
+		} else {
+			dst = append(dst, byte(length)|repeatFlag)
+			dst = binary.AppendUvarint(dst, uint64(run))
+		}
+		i += run
+	}
+	return dst
+}
+
+// ReadCodeLengths reads code lengths written by AppendCodeLengths
+func ReadCodeLengths(r io.ByteReader) (map[rune]int, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if count > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid symbol count %d", count)
+	}
+
+	symbols := make([]rune, 0, min(count, 1<<16))
+	prev := int64(-1)
+	for i := uint64(0); i < count; i++ {
+		gap, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		next := prev + 1 + int64(gap)
+		if gap > math.MaxInt32 || next > math.MaxInt32 {
+			return nil, fmt.Errorf("symbol out of range after %d", prev)
+		}
+		symbols = append(symbols, rune(next))
+		prev = next
+	}
+
+	lengths := make(map[rune]int, len(symbols))
+	for i := 0; i < len(symbols); {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		length, run := int(b&^repeatFlag), uint64(1)
+		if b&repeatFlag != 0 {
+			if run, err = binary.ReadUvarint(r); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+		if length == 0 {
+			return nil, errors.New("invalid code length 0")
+		}
+		if run == 0 || run > uint64(len(symbols)-i) {
+			return nil, fmt.Errorf("code length run of %d overruns the symbol list", run)
+		}
+		for ; run > 0; run-- {
+			lengths[symbols[i]] = length
+			i++
+		}
+	}
+	return lengths, nil
+}
+
+// FrequencyOrderedTree builds a tree with the given code lengths whose
+// codes are assigned like canonical codes, but with symbols of equal length
+// ordered from most to least frequent, and then by code point. Its header,
+// written with AppendOrderedCodeLengths, lists the most frequent symbols
+// first, so a decoder reusing the table can build its common codes first
+// and needs no sort to rebuild it.
+func FrequencyOrderedTree(lengths map[rune]int, frequency map[rune]int) (*HuffmanNode, error) {
+	symbols := make([]rune, 0, len(lengths))
+	for char, length := range lengths {
+		if length < 1 {
+			return nil, fmt.Errorf("symbol %q has invalid code length %d", char, length)
+		}
+		symbols = append(symbols, char)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		si, sj := symbols[i], symbols[j]
+		if lengths[si] != lengths[sj] {
+			return lengths[si] < lengths[sj]
+		}
+		if frequency[si] != frequency[sj] {
+			return frequency[si] > frequency[sj]
+		}
+		return si < sj
+	})
+	codes, err := orderedCodes(symbols, lengths)
+	if err != nil {
+		return nil, err
+	}
+	return TreeFromCodes(codes)
+}
+
+// AppendOrderedCodeLengths appends the code lengths of a tree built by
+// FrequencyOrderedTree, or any tree whose codes are assigned in order of
+// length, to dst. Symbols are stored in the order of their codes rather
+// than of their code points, in the style of JPEG's Huffman tables:
+//
+//	max      1 byte, the longest code length, at most maxCompactLength
+//	counts   max uvarints, the number of symbols of each length from 1
+//	symbols  a uvarint per symbol, in code order
+func AppendOrderedCodeLengths(dst []byte, root *HuffmanNode) []byte {
+	codes := BuildCodes(root)
+	symbols := make([]rune, 0, len(codes))
+	longest := 0
+	for char, code := range codes {
+		symbols = append(symbols, char)
+		longest = max(longest, len(code))
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		ci, cj := codes[symbols[i]], codes[symbols[j]]
+		if len(ci) != len(cj) {
+			return len(ci) < len(cj)
+		}
+		return ci < cj
+	})
+
+	counts := make([]int, longest+1)
+	for _, code := range codes {
+		counts[len(code)]++
+	}
+	dst = append(dst, byte(longest))
+	for _, count := range counts[1:] {
+		dst = binary.AppendUvarint(dst, uint64(count))
+	}
+	for _, char := range symbols {
+		dst = binary.AppendUvarint(dst, uint64(uint32(char)))
+	}
+	return dst
+}
+
+// ReadOrderedCodeLengths reads code lengths written by
+// AppendOrderedCodeLengths and rebuilds the tree, assigning codes in the
+// stored order without sorting the symbols
+func ReadOrderedCodeLengths(r io.ByteReader) (*HuffmanNode, error) {
+	longest, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if longest > maxCompactLength {
+		return nil, fmt.Errorf("invalid code length %d", longest)
+	}
+	lengths := make(map[rune]int)
+	var symbols []rune
+	counts := make([]uint64, longest+1)
+	total := uint64(0)
+	for length := 1; length <= int(longest); length++ {
+		if counts[length], err = binary.ReadUvarint(r); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		// A length cannot have more codes than it has values
+		if length < 32 && counts[length] > 1<<length || counts[length] > math.MaxInt32 {
+			return nil, fmt.Errorf("%d codes of length %d", counts[length], length)
+		}
+		if total += counts[length]; total > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid symbol count %d", total)
+		}
+	}
+	for length, count := range counts {
+		for ; count > 0; count-- {
+			sym, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			if sym > math.MaxUint32 {
+				return nil, fmt.Errorf("symbol %#x out of range", sym)
+			}
+			char := rune(uint32(sym))
+			if _, dup := lengths[char]; dup {
+				return nil, fmt.Errorf("symbol %q appears twice", char)
+			}
+			lengths[char] = length
+			symbols = append(symbols, char)
+		}
+	}
+	codes, err := orderedCodes(symbols, lengths)
+	if err != nil {
+		return nil, err
+	}
+	return TreeFromCodes(codes)
+}
+
+// DecodeCanonical decodes a payload produced by any canonical Huffman
+// encoder, given only each symbol's code length
+func DecodeCanonical(data []byte, bitCount int, lengths map[rune]int) (string, error) {
+	root, err := CanonicalTree(lengths)
+	if err != nil {
+		return "", err
+	}
+	return DecodeBytes(data, bitCount, root)
+}
+
+// OptimalCodeLengths computes optimal code lengths for a frequency table
+// without building a tree, using Moffat and Katajainen's in-place
+// algorithm over the sorted frequencies. It needs one int per symbol, so
+// it suits large alphabets where only lengths are wanted, e.g. for
+// CanonicalCodes. As with BuildHuffmanTree, symbols with a count of zero or
+// less get no length. When frequencies tie, the lengths may differ from
+// CodeLengths of BuildHuffmanTree, but the total coded size is the same.
+func OptimalCodeLengths(frequency map[rune]int) map[rune]int {
+	pairs := positiveFreqs(SortSymbols(frequency, ByFrequency))
+	a := make([]int, len(pairs))
+	for i, pair := range pairs {
+		a[i] = pair.Freq
+	}
+	minimumRedundancy(a)
+	lengths := make(map[rune]int, len(pairs))
+	for i, pair := range pairs {
+		lengths[pair.Symbol] = a[i]
+	}
+	return lengths
+}
+
+// minimumRedundancy replaces the nondecreasing frequencies in a with
+// their optimal code lengths. A single symbol gets length 1, matching
+// GenerateHuffmanCodes.
+func minimumRedundancy(a []int) {
+	n := len(a)
+	switch n {
+	case 0:
+		return
+	case 1:
+		a[0] = 1
+		return
+	}
+
+	// Phase one: build the tree in place, leaving each internal node's
+	// parent index in a
+	a[0] += a[1]
+	root, leaf := 0, 2
+	for next := 1; next < n-1; next++ {
+		if leaf >= n || a[root] < a[leaf] {
+			a[next] = a[root]
+			a[root] = next
+			root++
+		} else {
+			a[next] = a[leaf]
+			leaf++
+		}
+		if leaf >= n || (root < next && a[root] < a[leaf]) {
+			a[next] += a[root]
+			a[root] = next
+			root++
+		} else {
+			a[next] += a[leaf]
+			leaf++
+		}
+	}
+
+	// Phase two: convert parent indexes to internal node depths
+	a[n-2] = 0
+	for next := n - 3; next >= 0; next-- {
+		a[next] = a[a[next]] + 1
+	}
+
+	// Phase three: convert internal node depths to leaf depths
+	avail, used, depth := 1, 0, 0
+	root, next := n-2, n-1
+	for avail > 0 {
+		for root >= 0 && a[root] == depth {
+			used++
+			root--
+		}
+		for avail > used {
+			a[next] = depth
+			next--
+			avail--
+		}
+		avail, depth, used = 2*used, depth+1, 0
+	}
+}
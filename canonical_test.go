@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// largeAlphabetText returns text over n distinct CJK runes with skewed
+// counts
+func largeAlphabetText(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		sb.WriteString(strings.Repeat(string(rune(0x4e00+i*3)), 1+i%7))
+	}
+	return sb.String()
+}
+
+// treeFromSpec returns the canonical tree for a map from code point to code
+// length, so tests can state the shape of a tree instead of linking nodes
+// by hand
+func treeFromSpec(t *testing.T, spec map[rune]int) *HuffmanNode {
+	t.Helper()
+	root, err := CanonicalTree(spec)
+	if err != nil {
+		t.Fatalf("invalid tree spec %v: %v", spec, err)
+	}
+	return root
+}
+
+func TestTreeFromSpec(t *testing.T) {
+	specs := []map[rune]int{
+		{'a': 1},
+		{'a': 1, 'b': 1},
+		{'a': 1, 'b': 2, 'c': 3, 'd': 3},
+		{'x': 2, 'y': 2, 'z': 2, 'w': 2},
+	}
+	for _, spec := range specs {
+		root := treeFromSpec(t, spec)
+		if got := CodeLengths(root); !reflect.DeepEqual(got, spec) {
+			t.Errorf("CodeLengths = %v, want %v", got, spec)
+		}
+		if !IsCanonical(root) {
+			t.Errorf("tree for %v is not canonical", spec)
+		}
+	}
+}
+
+func TestIsCanonical(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes map[rune]string
+		want  bool
+	}{
+		{"canonical", map[rune]string{'a': "0", 'b': "10", 'c': "11"}, true},
+		{"single", map[rune]string{'a': "0"}, true},
+		{"mirrored", map[rune]string{'a': "1", 'b': "00", 'c': "01"}, false},
+		{"swapped within a length", map[rune]string{'a': "0", 'b': "11", 'c': "10"}, false},
+		{"shorter code last", map[rune]string{'a': "00", 'b': "01", 'c': "1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := TreeFromCodes(tt.codes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := IsCanonical(root); got != tt.want {
+				t.Errorf("IsCanonical = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeLengthsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		lengths map[rune]int
+	}{
+		{"empty", map[rune]int{}},
+		{"single", map[rune]int{'a': 1}},
+		{"runs", map[rune]int{'a': 2, 'b': 2, 'c': 2, 'd': 3, 'e': 3}},
+		{"sparse", map[rune]int{0: 1, 0x10ffff: 2, 0x4e00: 2}},
+		{"large alphabet", CodeLengths(BuildHuffmanTree(BuildFrequencyTable(largeAlphabetText(3000))))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := AppendCodeLengths(nil, tt.lengths)
+			got, err := ReadCodeLengths(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.lengths) {
+				t.Errorf("ReadCodeLengths = %v, want %v", got, tt.lengths)
+			}
+		})
+	}
+}
+
+func TestReadCodeLengthsInvalid(t *testing.T) {
+	valid := AppendCodeLengths(nil, map[rune]int{'a': 1, 'b': 2, 'c': 2})
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)-1]},
+		{"zero length", []byte{1, 'a', 0}},
+		{"run overruns", []byte{1, 'a', 1 | repeatFlag, 2}},
+		{"huge count", []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+	}
+	for _, tt := range tests {
+		if _, err := ReadCodeLengths(bytes.NewReader(tt.data)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestCanonicalCodes(t *testing.T) {
+	codes, err := CanonicalCodes(map[rune]int{'a': 2, 'b': 1, 'c': 3, 'd': 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[rune]string{'b': "0", 'a': "10", 'c': "110", 'd': "111"}
+	if !reflect.DeepEqual(codes, want) {
+		t.Errorf("CanonicalCodes = %v, want %v", codes, want)
+	}
+	if _, err := CanonicalCodes(map[rune]int{'a': 1, 'b': 1, 'c': 1}); err == nil {
+		t.Error("CanonicalCodes accepted oversubscribed lengths")
+	}
+}
+
+func TestCompactHeaderLargeAlphabet(t *testing.T) {
+	text := largeAlphabetText(5000)
+	tree := encodeContainer(t, text, EncodeOptions{})
+	compact := encodeContainer(t, text, EncodeOptions{Compact: true})
+	treeSize, compactSize := headerSize(t, tree), headerSize(t, compact)
+	t.Logf("header: %d bytes with a tree, %d compact", treeSize, compactSize)
+	if compactSize >= treeSize {
+		t.Errorf("compact header is %d bytes, tree header %d; want smaller", compactSize, treeSize)
+	}
+
+	root, text2, err := ReadHuffFile(bytes.NewReader(compact))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text2 != text {
+		t.Error("compact container decodes to different text")
+	}
+	if !IsCanonical(root) {
+		t.Error("compact header decoded to a tree that is not canonical")
+	}
+
+	// A truncated code-length table is reported, not misparsed
+	if _, err := ReadHuffHeader(bytes.NewReader(compact[:compactSize/2])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated compact header: error %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestOrderedCodeLengthsRoundTrip(t *testing.T) {
+	texts := append(roundTripTexts, struct{ name, text string }{"large alphabet", largeAlphabetText(2000)})
+	for _, tt := range texts {
+		t.Run(tt.name, func(t *testing.T) {
+			frequency := BuildFrequencyTable(tt.text)
+			root, err := FrequencyOrderedTree(CodeLengths(BuildHuffmanTree(frequency)), frequency)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadOrderedCodeLengths(bytes.NewReader(AppendOrderedCodeLengths(nil, root)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			codes := BuildCodes(root)
+			if !reflect.DeepEqual(BuildCodes(got), codes) {
+				t.Errorf("ReadOrderedCodeLengths rebuilt codes %v, want %v", BuildCodes(got), codes)
+			}
+
+			// Among codes of one length, more frequent symbols come first
+			for a, codeA := range codes {
+				for b, codeB := range codes {
+					if len(codeA) == len(codeB) && frequency[a] > frequency[b] && codeA > codeB {
+						t.Fatalf("%q is more frequent than %q but has the later code", a, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadOrderedCodeLengthsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"length too long", []byte{maxCompactLength + 1}},
+		{"truncated counts", []byte{2, 1}},
+		{"truncated symbols", []byte{2, 1, 2, 'a', 'b'}},
+		{"too many codes of a length", []byte{1, 3, 'a', 'b', 'c'}},
+		{"oversubscribed", []byte{2, 1, 3, 'a', 'b', 'c', 'd'}},
+		{"duplicate symbol", []byte{1, 2, 'a', 'a'}},
+		{"symbol out of range", []byte{1, 1, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, tt := range tests {
+		if _, err := ReadOrderedCodeLengths(bytes.NewReader(tt.data)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestDecodeCanonical(t *testing.T) {
+	// Canonical codes for these lengths: a 0, b 10, c 110, d 111
+	lengths := map[rune]int{'a': 1, 'b': 2, 'c': 3, 'd': 3}
+	tests := []struct {
+		name    string
+		lengths map[rune]int
+		bits    string
+		want    string
+		wantErr bool
+	}{
+		{"empty", lengths, "", "", false},
+		{"each symbol", lengths, "0" + "10" + "110" + "111", "abcd", false},
+		{"repeats", lengths, "111" + "111" + "0" + "0" + "10", "ddaab", false},
+		{"equal lengths", map[rune]int{'x': 2, 'y': 2, 'z': 2, 'w': 2}, "00" + "01" + "10" + "11", "wxyz", false},
+		{"single symbol", map[rune]int{'q': 1}, "000", "qqq", false},
+		{"truncated code", lengths, "0" + "11", "", true},
+		{"over-full lengths", map[rune]int{'a': 1, 'b': 1, 'c': 1}, "0", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, bitCount := PackBits(tt.bits)
+			got, err := DecodeCanonical(payload, bitCount, tt.lengths)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DecodeCanonical = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("DecodeCanonical = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptimalCodeLengths(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency map[rune]int
+		want      map[rune]int // nil where ties allow several optimal answers
+	}{
+		{"empty", nil, map[rune]int{}},
+		{"single symbol", map[rune]int{'a': 9}, map[rune]int{'a': 1}},
+		{"two symbols", map[rune]int{'a': 9, 'b': 1}, map[rune]int{'a': 1, 'b': 1}},
+		{"powers of two", map[rune]int{'a': 8, 'b': 4, 'c': 2, 'd': 1, 'e': 1}, map[rune]int{'a': 1, 'b': 2, 'c': 3, 'd': 4, 'e': 4}},
+		{"textbook", map[rune]int{'a': 15, 'b': 7, 'c': 6, 'd': 6, 'e': 5}, map[rune]int{'a': 1, 'b': 3, 'c': 3, 'd': 3, 'e': 3}},
+		{"uniform", map[rune]int{'a': 2, 'b': 2, 'c': 2, 'd': 2}, map[rune]int{'a': 2, 'b': 2, 'c': 2, 'd': 2}},
+		{"zero counts", map[rune]int{'a': 3, 'b': 0, 'c': 1, 'd': -2}, map[rune]int{'a': 1, 'c': 1}},
+		{"text", BuildFrequencyTable(benchmarkText(8 << 10)), nil},
+		{"large alphabet", BuildFrequencyTable(largeAlphabetText(500)), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := OptimalCodeLengths(tt.frequency)
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OptimalCodeLengths = %v, want %v", got, tt.want)
+			}
+			// Kraft: a full binary tree uses the whole code space
+			kraft := 0.0
+			cost, treeCost := 0, 0
+			tree := CodeLengths(BuildHuffmanTree(tt.frequency))
+			for char, length := range got {
+				kraft += 1 / float64(uint64(1)<<length)
+				cost += tt.frequency[char] * length
+				treeCost += tt.frequency[char] * tree[char]
+			}
+			if len(got) > 1 && kraft != 1 {
+				t.Errorf("Kraft sum %v, want 1", kraft)
+			}
+			if len(got) != len(tree) || cost != treeCost {
+				t.Errorf("%d lengths costing %d bits, tree builder %d costing %d", len(got), cost, len(tree), treeCost)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// escapeSymbol is the leaf of a capped tree that stands for every symbol
+// left out of the tree. It is above utf8.MaxRune, so no text symbol can
+// collide with it.
+const escapeSymbol = utf8.MaxRune + 1
+
+// BuildCappedTree builds a Huffman tree with at most maxSymbols leaves, for
+// decoders with fixed-size tables. If the alphabet is larger, only the
+// maxSymbols-1 most frequent symbols keep a leaf, and the last leaf is an
+// escape shared by the rest: EncodeCapped codes each of their occurrences
+// as the escape code followed by the symbol as a literalBits-bit literal.
+// The cost over an uncapped tree is therefore those literal bits, plus
+// whatever longer codes the kept symbols get, for every escaped occurrence;
+// a cap just under the alphabet size costs little when the dropped symbols
+// are rare.
+func BuildCappedTree(frequency map[rune]int, maxSymbols int) (*HuffmanNode, error) {
+	if maxSymbols < 1 {
+		return nil, fmt.Errorf("invalid symbol cap %d", maxSymbols)
+	}
+	histogram := positiveFreqs(FrequencyHistogram(frequency))
+	if len(histogram) <= maxSymbols {
+		return BuildHuffmanTree(frequency), nil
+	}
+	capped := make(map[rune]int, maxSymbols)
+	for _, pair := range histogram[:maxSymbols-1] {
+		capped[pair.Symbol] = pair.Freq
+	}
+	for _, pair := range histogram[maxSymbols-1:] {
+		capped[escapeSymbol] += pair.Freq
+	}
+	return BuildHuffmanTree(capped), nil
+}
+
+// EncodeCapped codes text with a tree from BuildCappedTree, escaping
+// symbols that have no leaf. It returns the packed payload and its bit
+// count, and fails only if text holds such a symbol and the tree has no
+// escape leaf.
+func EncodeCapped(text string, root *HuffmanNode) ([]byte, int, error) {
+	if !utf8.ValidString(text) {
+		return nil, 0, errors.New("input is not valid UTF-8")
+	}
+	codes := BuildCodes(root)
+	escape, canEscape := codes[escapeSymbol]
+	var sb strings.Builder
+	for _, char := range text {
+		if code, ok := codes[char]; ok {
+			sb.WriteString(code)
+			continue
+		}
+		if !canEscape {
+			return nil, 0, fmt.Errorf("symbol %q is not in the tree, which has no escape", char)
+		}
+		sb.WriteString(escape)
+		for i := literalBits - 1; i >= 0; i-- {
+			sb.WriteByte('0' + byte(char>>i&1))
+		}
+	}
+	payload, bitCount := PackBits(sb.String())
+	return payload, bitCount, nil
+}
+
+// DecodeCapped decodes bitCount bits of a payload from EncodeCapped
+func DecodeCapped(data []byte, bitCount int, root *HuffmanNode) (string, error) {
+	if bitCount > len(data)*8 {
+		return "", fmt.Errorf("bit count %d exceeds the %d bits of data", bitCount, len(data)*8)
+	}
+	if root == nil {
+		if bitCount > 0 {
+			return "", errors.New("cannot decode with an empty tree")
+		}
+		return "", nil
+	}
+	var out []byte
+	for i := 0; i < bitCount; {
+		var char rune
+		if root.left == nil && root.right == nil {
+			// A single-symbol tree: every code is one bit
+			char = root.character
+			i++
+		} else {
+			var err error
+			if char, i, err = walkFrom(data, bitCount, root, i); err != nil {
+				return "", err
+			}
+		}
+		if char == escapeSymbol {
+			if i+literalBits > bitCount {
+				return "", decodeErrorAt(bitCount, errTruncatedCode)
+			}
+			char = 0
+			for j := 0; j < literalBits; j++ {
+				char = char<<1 | rune(data[i/8]>>(7-i%8)&1)
+				i++
+			}
+			if !utf8.ValidRune(char) {
+				return "", fmt.Errorf("invalid literal %#x at offset %d", char, i-literalBits)
+			}
+		}
+		out = utf8.AppendRune(out, char)
+	}
+	return string(out), nil
+}
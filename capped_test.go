@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCappedRoundTrip(t *testing.T) {
+	text := strings.Repeat("aaaabbbccd", 20) + "xyzé日"
+	alphabet := len(BuildFrequencyTable(text))
+	tests := []struct {
+		name       string
+		maxSymbols int
+		escapes    bool
+	}{
+		{"uncapped", alphabet, false},
+		{"generous cap", alphabet + 10, false},
+		{"one dropped", alphabet - 1, true},
+		{"rare symbols dropped", 5, true},
+		{"escape only", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := BuildCappedTree(BuildFrequencyTable(text), tt.maxSymbols)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if leaves := TreeLeafCount(root); leaves > tt.maxSymbols {
+				t.Errorf("%d leaves over a cap of %d", leaves, tt.maxSymbols)
+			}
+			codes := BuildCodes(root)
+			if _, ok := codes[escapeSymbol]; ok != tt.escapes {
+				t.Errorf("escape leaf present = %v, want %v", ok, tt.escapes)
+			}
+			payload, bitCount, err := EncodeCapped(text, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeCapped(payload, bitCount, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != text {
+				t.Errorf("decoded %q, want %q", got, text)
+			}
+		})
+	}
+}
+
+func TestCappedEscapeCost(t *testing.T) {
+	text := "aaaabbbccdxyz"
+	root, err := BuildCappedTree(BuildFrequencyTable(text), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := BuildCodes(root)
+	escape := codes[escapeSymbol]
+	want := 0
+	for _, char := range text {
+		if code, ok := codes[char]; ok {
+			want += len(code)
+		} else {
+			want += len(escape) + literalBits
+		}
+	}
+	if _, bitCount, _ := EncodeCapped(text, root); bitCount != want {
+		t.Errorf("%d bits, want %d", bitCount, want)
+	}
+
+	// A lone escape leaf has a 1-bit code, so every symbol costs one bit
+	// more than its literal
+	root, err = BuildCappedTree(BuildFrequencyTable(text), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, bitCount, _ := EncodeCapped(text, root); bitCount != len(text)*(1+literalBits) {
+		t.Errorf("escape-only tree: %d bits, want %d", bitCount, len(text)*(1+literalBits))
+	}
+}
+
+func TestCappedErrors(t *testing.T) {
+	frequency := BuildFrequencyTable("aabc")
+	if _, err := BuildCappedTree(frequency, 0); err == nil {
+		t.Error("BuildCappedTree accepted a cap of 0")
+	}
+
+	root, err := BuildCappedTree(frequency, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := EncodeCapped("abcd", root); err == nil {
+		t.Error("EncodeCapped accepted a symbol that has no leaf and no escape")
+	}
+	if _, _, err := EncodeCapped("ab\xff", root); err == nil {
+		t.Error("EncodeCapped accepted invalid UTF-8")
+	}
+
+	root, err = BuildCappedTree(BuildFrequencyTable("aaaabbbccdxyz"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, bitCount, err := EncodeCapped("z", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeCapped(payload, bitCount-1, root); err == nil {
+		t.Error("DecodeCapped accepted a truncated literal")
+	}
+	if _, err := DecodeCapped(payload, len(payload)*8+1, root); err == nil {
+		t.Error("DecodeCapped accepted a bit count beyond the data")
+	}
+
+	// A surrogate is not a valid rune, so no encoder writes it as a literal
+	escape := BuildCodes(root)[escapeSymbol]
+	bits := escape
+	for i := literalBits - 1; i >= 0; i-- {
+		bits += string(rune('0' + 0xd800>>i&1))
+	}
+	payload, bitCount = PackBits(bits)
+	if _, err := DecodeCapped(payload, bitCount, root); err == nil {
+		t.Error("DecodeCapped accepted a surrogate literal")
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// encoderCheckpoint is the saved state of an Encoder
+type encoderCheckpoint struct {
+	InputOffset  int64       `json:"input_offset"`
+	OutputOffset int64       `json:"output_offset"`
+	BitCount     int         `json:"bit_count"`
+	Cur          byte        `json:"cur"`
+	CurBits      uint        `json:"cur_bits"`
+	Partial      []byte      `json:"partial"`
+	Checksum     uint32      `json:"checksum"`
+	Symbols      int64       `json:"symbols"`
+	Codes        []codeEntry `json:"codes"`
+	Padding      []Padding   `json:"padding,omitempty"`
+}
+
+// InputOffset returns the number of input bytes written to the Encoder
+func (e *Encoder) InputOffset() int64 {
+	return e.inputBytes
+}
+
+// SaveCheckpoint writes everything buffered to the underlying writer and
+// saves the Encoder's state to path, so an interrupted job can continue
+// with ResumeFromCheckpoint. The checkpoint records how much input has been
+// consumed and how much output written; to resume, truncate the output to
+// the saved output offset and feed the input from the saved input offset.
+func (e *Encoder) SaveCheckpoint(path string) error {
+	if e.err != nil {
+		return e.err
+	}
+	if err := e.writeBuffered(); err != nil {
+		return err
+	}
+	cp := encoderCheckpoint{
+		InputOffset:  e.inputBytes,
+		OutputOffset: e.outputBytes,
+		BitCount:     e.bitCount,
+		Cur:          e.cur,
+		CurBits:      e.curBits,
+		Partial:      e.partial,
+		Checksum:     e.crc,
+		Symbols:      e.symbols,
+		Codes:        sortedCodeEntries(e.codes),
+		Padding:      e.pads,
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data)
+}
+
+// errNoWriter is returned by an Encoder restored by ResumeFromCheckpoint
+// until it is given a writer with SetWriter
+var errNoWriter = errors.New("resumed Encoder has no writer; call SetWriter")
+
+// ResumeFromCheckpoint restores an Encoder saved by SaveCheckpoint. Before
+// use, it must be given the output, truncated to the saved output offset,
+// with SetWriter; writing the rest of the input to it then produces the
+// same bytes an uninterrupted run would have.
+func ResumeFromCheckpoint(path string) (*Encoder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp encoderCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	if cp.CurBits > 7 || len(cp.Partial) >= 4 {
+		return nil, errors.New("invalid encoder checkpoint")
+	}
+
+	codes := make(map[rune]string, len(cp.Codes))
+	for _, entry := range cp.Codes {
+		codes[entry.Rune] = entry.Code
+	}
+	e := NewEncoder(nil, codes)
+	e.err = errNoWriter
+	e.inputBytes = cp.InputOffset
+	e.outputBytes = cp.OutputOffset
+	e.bitCount = cp.BitCount
+	e.cur, e.curBits = cp.Cur, cp.CurBits
+	e.partial = cp.Partial
+	e.crc = cp.Checksum
+	e.symbols = cp.Symbols
+	e.pads = cp.Padding
+	return e, nil
+}
+
+// SetWriter makes the Encoder write its output to w, including anything
+// still buffered. It gives an Encoder restored by ResumeFromCheckpoint the
+// writer to continue on.
+func (e *Encoder) SetWriter(w io.Writer) {
+	e.w = w
+	if e.err == errNoWriter {
+		e.err = nil
+	}
+}
+
+// decoderCheckpoint is the saved state of a Decoder. Checkpoints are taken
+// between symbols, so no partly walked code needs saving; only the bit
+// position within the current input byte does.
+type decoderCheckpoint struct {
+	InputOffset  int64     `json:"input_offset"`
+	SkipBits     int       `json:"skip_bits"`
+	Consumed     int       `json:"consumed_bits"`
+	Remaining    int       `json:"remaining_bits"`
+	OutputOffset int64     `json:"output_offset"`
+	Pending      []byte    `json:"pending"`
+	Tree         []byte    `json:"tree"`
+	Bytes        bool      `json:"bytes"`
+	LSBFirst     bool      `json:"lsb_first"`
+	RLE          bool      `json:"rle"`
+	Last         rune      `json:"last"`
+	Started      bool      `json:"started"`
+	Repeat       int       `json:"repeat"`
+	Padding      []Padding `json:"padding,omitempty"`
+
+	// The container header fields needed to verify the output at the end,
+	// and the running checks, if the Decoder decodes a container
+	Header *decoderCheckpointHeader `json:"header,omitempty"`
+}
+
+type decoderCheckpointHeader struct {
+	Flags        uint32 `json:"flags"`
+	OriginalSize uint64 `json:"original_size"`
+	SymbolCount  uint64 `json:"symbol_count"`
+	Checksum     uint32 `json:"checksum"`
+	SHA256       []byte `json:"sha256,omitempty"`
+	BitCount     uint64 `json:"bit_count"`
+	CRC          uint32 `json:"crc"`
+	Size         uint64 `json:"size"`
+	Symbols      uint64 `json:"symbols"`
+}
+
+// OutputOffset returns the number of decoded bytes returned by Read
+func (d *Decoder) OutputOffset() int64 {
+	return d.outputBytes
+}
+
+// InputOffset returns the offset of the input byte holding the next unread
+// payload bit, counted from the start of the container for a container
+// decoder; it is where the input resumes from after SaveCheckpoint
+func (d *Decoder) InputOffset() int64 {
+	return d.base + int64(d.bits.consumed/8)
+}
+
+// SaveCheckpoint saves the Decoder's state to path, so an interrupted
+// decode can continue with ResumeDecoder. The checkpoint records the input
+// offset to resume reading from, which for a container decoder counts from
+// the start of the container, and the output offset: to resume, truncate
+// the output to the saved output offset and pass ResumeDecoder the input
+// from the saved input offset. FlagFooter containers cannot be
+// checkpointed, since their length is only known at the end.
+func (d *Decoder) SaveCheckpoint(path string) error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.header != nil && d.header.Flags&FlagFooter != 0 {
+		return errors.New("cannot checkpoint the decoder of a footer container")
+	}
+	cp := decoderCheckpoint{
+		InputOffset:  d.InputOffset(),
+		SkipBits:     d.bits.consumed % 8,
+		Consumed:     d.bits.consumed,
+		Remaining:    d.bits.remaining,
+		OutputOffset: d.outputBytes,
+		Pending:      d.pending,
+		Tree:         AppendTree(nil, d.root),
+		Bytes:        d.bytes,
+		LSBFirst:     d.lsb,
+		RLE:          d.rle,
+		Last:         d.last,
+		Started:      d.started,
+		Repeat:       d.repeat,
+		Padding:      d.pads,
+	}
+	if h := d.header; h != nil {
+		cp.Header = &decoderCheckpointHeader{
+			Flags:        h.Flags,
+			OriginalSize: h.OriginalSize,
+			SymbolCount:  h.SymbolCount,
+			Checksum:     h.Checksum,
+			SHA256:       h.SHA256,
+			BitCount:     h.BitCount,
+			CRC:          d.crc,
+			Size:         d.size,
+			Symbols:      d.symbols,
+		}
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data)
+}
+
+// ResumeDecoder restores a Decoder saved by SaveCheckpoint, reading the
+// rest of its input from r, which must start at the saved input offset.
+// Reading it to the end produces the rest of the output an uninterrupted
+// decode would have, and verifies a container's checksum as usual.
+func ResumeDecoder(path string, r io.Reader) (*Decoder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp decoderCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	if cp.SkipBits < 0 || cp.SkipBits > 7 || cp.Remaining < 0 || cp.Consumed < cp.SkipBits || len(cp.Pending) > utf8.UTFMax {
+		return nil, errors.New("invalid decoder checkpoint")
+	}
+	root, err := ReadTree(bytes.NewReader(cp.Tree))
+	if err != nil {
+		return nil, fmt.Errorf("invalid decoder checkpoint: %w", err)
+	}
+
+	if cp.LSBFirst {
+		r = lsbFirstReader{r}
+	}
+	d := NewDecoder(r, root, cp.SkipBits+cp.Remaining)
+	for i := 0; i < cp.SkipBits; i++ {
+		if _, err := d.bits.readBit(); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	d.bits.consumed = cp.Consumed
+	d.pending = append(d.scratch[:0], cp.Pending...)
+	d.bytes, d.lsb, d.rle = cp.Bytes, cp.LSBFirst, cp.RLE
+	d.last, d.started, d.repeat = cp.Last, cp.Started, cp.Repeat
+	d.outputBytes = cp.OutputOffset
+	d.pads = cp.Padding
+	d.base = cp.InputOffset - int64(cp.Consumed/8)
+	if h := cp.Header; h != nil {
+		tree := root
+		if h.Flags&FlagLeftOne != 0 {
+			tree = MirrorTree(root)
+		}
+		d.header = &HuffHeader{
+			Version:      versionFor(h.Flags),
+			Flags:        h.Flags,
+			OriginalSize: h.OriginalSize,
+			SymbolCount:  h.SymbolCount,
+			Checksum:     h.Checksum,
+			SHA256:       h.SHA256,
+			Tree:         tree,
+			BitCount:     h.BitCount,
+		}
+		d.crc, d.size, d.symbols = h.CRC, h.Size, h.Symbols
+	}
+	return d, nil
+}
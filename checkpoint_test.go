@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncoderCheckpoint(t *testing.T) {
+	text := strings.Repeat("checkpointed encoders resume byte for byte. ", 200) + "ünïcödé"
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+
+	var full bytes.Buffer
+	e := NewEncoder(&full, codes)
+	if _, err := e.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupt at several points, including inside a multi-byte rune
+	for _, cut := range []int{0, 1, 777, len(text) - 3, len(text)} {
+		path := filepath.Join(t.TempDir(), "encoder.json")
+		var out bytes.Buffer
+		e := NewEncoder(&out, codes)
+		if _, err := e.Write([]byte(text[:cut])); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.SaveCheckpoint(path); err != nil {
+			t.Fatal(err)
+		}
+		saved := out.Len()
+		// Output after the checkpoint is lost with the interrupted process
+		e.Write([]byte(strings.Repeat("lost ", 1000)))
+
+		out.Truncate(saved)
+		r, err := ResumeFromCheckpoint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Write([]byte("x")); err != errNoWriter {
+			t.Fatalf("Write before SetWriter: error %v, want errNoWriter", err)
+		}
+		r.SetWriter(&out)
+		if _, err := r.Write([]byte(text[r.InputOffset():])); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), full.Bytes()) {
+			t.Errorf("cut at %d: resumed output differs from an uninterrupted run", cut)
+		}
+		if r.Checksum() != crc32.ChecksumIEEE([]byte(text)) {
+			t.Errorf("cut at %d: resumed checksum %08x is not the text's", cut, r.Checksum())
+		}
+	}
+}
+
+func TestResumeFromCheckpointInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"missing.json": "",
+		"garbage.json": "not json",
+		"state.json":   `{"cur_bits": 9}`,
+	} {
+		path := filepath.Join(dir, name)
+		if content != "" {
+			if err := WriteFileAtomic(path, []byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := ResumeFromCheckpoint(path); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestDecoderCheckpoint(t *testing.T) {
+	text := strings.Repeat("checkpointed decoders resume mid-stream. ", 100) + "ünïcödé aaaaaaaaaaaa"
+	options := []struct {
+		name string
+		opts EncodeOptions
+	}{
+		{"default", EncodeOptions{}},
+		{"left one", EncodeOptions{LeftOne: true}},
+		{"bytes", EncodeOptions{Bytes: true}},
+		{"lsb first", EncodeOptions{LSBFirst: true}},
+		{"rle", EncodeOptions{RLE: true}},
+		{"sha256", EncodeOptions{SHA256: true}},
+	}
+	for _, tt := range options {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeContainer(t, text, tt.opts)
+			// Interrupt at several points, including inside a multi-byte rune
+			for _, cut := range []int{0, 1, 333, len(text) - 25, len(text)} {
+				path := filepath.Join(t.TempDir(), "decoder.json")
+				d, err := NewContainerDecoder(bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				out := make([]byte, cut)
+				if _, err := io.ReadFull(d, out); err != nil {
+					t.Fatal(err)
+				}
+				if err := d.SaveCheckpoint(path); err != nil {
+					t.Fatal(err)
+				}
+
+				r, err := ResumeDecoder(path, bytes.NewReader(data[d.InputOffset():]))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r.OutputOffset() != int64(cut) {
+					t.Errorf("cut at %d: resumed OutputOffset %d", cut, r.OutputOffset())
+				}
+				rest, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("cut at %d: %v", cut, err)
+				}
+				if string(out)+string(rest) != text {
+					t.Errorf("cut at %d: resumed output differs from an uninterrupted decode", cut)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderCheckpointRawPayload(t *testing.T) {
+	text := strings.Repeat("a raw payload resumes as well ", 50)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	path := filepath.Join(t.TempDir(), "decoder.json")
+
+	d := NewDecoder(bytes.NewReader(payload), root, bitCount)
+	out := make([]byte, 401)
+	if _, err := io.ReadFull(d, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveCheckpoint(path); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ResumeDecoder(path, bytes.NewReader(payload[d.InputOffset():]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out)+string(rest) != text {
+		t.Error("resumed output differs from an uninterrupted decode")
+	}
+}
+
+func TestDecoderCheckpointInvalid(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewContainerDecoder(bytes.NewReader(footerContainer(t, "footers have no length up front")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveCheckpoint(filepath.Join(dir, "footer.json")); err == nil {
+		t.Error("checkpointed the decoder of a footer container")
+	}
+
+	for name, content := range map[string]string{
+		"missing.json": "",
+		"garbage.json": "not json",
+		"skip.json":    `{"skip_bits": 8}`,
+		"tree.json":    `{"tree": "AQ=="}`,
+	} {
+		path := filepath.Join(dir, name)
+		if content != "" {
+			if err := WriteFileAtomic(path, []byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := ResumeDecoder(path, bytes.NewReader(nil)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
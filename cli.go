@@ -0,0 +1,772 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// commands maps CLI subcommands to their implementations. Running the
+// binary without a subcommand keeps the original input.txt demo.
+var commands = map[string]func(args []string){
+	"encode":   runEncode,
+	"decode":   runDecode,
+	"inspect":  runInspect,
+	"verify":   runVerify,
+	"selftest": runSelfTest,
+	"optimize": runOptimize,
+	"dump":     runDump,
+	"concat":   runConcat,
+	"archive":  runArchive,
+	"check":    runCheck,
+
+	"extract-table": runExtractTable,
+}
+
+// Exit codes of the CLI. Flag parsing errors also exit with exitUsage.
+const (
+	exitFailure  = 1 // any error not covered below
+	exitUsage    = 2 // invalid arguments
+	exitIO       = 3 // a file could not be read or written
+	exitFormat   = 4 // input is not a valid container, table or payload
+	exitChecksum = 5 // a header or payload checksum did not match
+)
+
+// exitCode returns the exit code for err, classified by its category
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var decodeErr *DecodeError
+	var symbolErr *UnexpectedSymbolError
+	switch {
+	case errors.Is(err, ErrHeaderChecksum), errors.Is(err, ErrPayloadChecksum):
+		return exitChecksum
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return exitIO
+	case errors.Is(err, ErrNotHuff), errors.Is(err, ErrInvalidHeader), errors.Is(err, ErrNotArchive),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, errNoTable), errors.Is(err, errFooterUnsupported),
+		errors.As(err, &decodeErr), errors.As(err, &symbolErr):
+		return exitFormat
+	}
+	return exitFailure
+}
+
+// fatalf logs a message to stderr and exits with the exit code for err
+func fatalf(err error, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	os.Exit(exitCode(err))
+}
+
+// readInput reads a file for the CLI, exiting if it cannot be read
+func readInput(filename string) string {
+	content, err := ReadFile(filename)
+	if err != nil {
+		fatalf(err, "Failed to read file: %v", err)
+	}
+	return content
+}
+
+// writeOutput writes a file for the CLI atomically with opts, exiting on
+// failure
+func writeOutput(filename, content string, opts AtomicOptions) {
+	if err := WriteFileAtomicOptions(filename, []byte(content), opts); err != nil {
+		fatalf(err, "Failed to write to file: %v", err)
+	}
+}
+
+// main runs a subcommand, or without one the original demo: it codes
+// input.txt, writing encoded.txt and decoded.txt
+func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
+	encodingFlag := flag.String("encoding", "auto", "input encoding: auto, utf-8, utf-16le or utf-16be")
+	ngramFlag := flag.Int("ngram", 0, "also report the payload size when coding n-byte symbols")
+	flag.Parse()
+
+	// Read the input text from input.txt, transcoding it to UTF-8
+	raw := []byte(readInput("input.txt"))
+	encoding, forced, err := ParseTextEncoding(*encodingFlag)
+	if err != nil {
+		log.Printf("Invalid -encoding: %v", err)
+		os.Exit(exitUsage)
+	}
+	if !forced {
+		encoding, _ = DetectEncoding(raw)
+	}
+	inputText, hasBOM, err := DecodeText(raw, encoding)
+	if err != nil {
+		fatalf(err, "Failed to decode input as %v: %v", encoding, err)
+	}
+
+	// Build frequency table and Huffman Tree
+	frequency := BuildFrequencyTable(inputText)
+	huffmanTree := BuildHuffmanTree(frequency)
+
+	// Generate Huffman Codes
+	codes := make(map[rune]string)
+	GenerateHuffmanCodes(huffmanTree, "", codes)
+
+	// Encode the input text
+	encoded := Encode(inputText, codes)
+	// Write the encoded text to encoded.txt
+	writeOutput("encoded.txt", encoded, AtomicOptions{})
+
+	// Decode the encoded text
+	decoded := Decode(encoded, huffmanTree)
+	// Write the decoded text to decoded.txt in the original encoding
+	writeOutput("decoded.txt", string(EncodeText(decoded, encoding, hasBOM)), AtomicOptions{})
+
+	if *ngramFlag > 1 {
+		runeBits, ngramBits, err := CompareNGramBits(inputText, *ngramFlag)
+		if err != nil {
+			fatalf(err, "Failed to build %d-gram coding: %v", *ngramFlag, err)
+		}
+		verdict := "did not help"
+		if ngramBits < runeBits {
+			verdict = "helped"
+		}
+		fmt.Fprintf(os.Stderr, "%d-gram symbols: %d bits vs %d bits per rune (%s)\n", *ngramFlag, ngramBits, runeBits, verdict)
+	}
+
+	fmt.Fprintln(os.Stderr, "Encoding and decoding complete. Check encoded.txt and decoded.txt files.")
+}
+
+// runEncode implements "huffman encode in.txt out.huff", and "huffman
+// encode -inplace in.txt", which writes in.txt.huff and only then removes
+// in.txt, once the container has been read back and decodes to it
+func runEncode(args []string) {
+	fs := flag.NewFlagSet("encode", flag.ExitOnError)
+	output := modeFlag(fs)
+	var opts EncodeOptions
+	fs.BoolVar(&opts.LeftOne, "left-one", false, "assign 1 to left branches and 0 to right branches")
+	fs.BoolVar(&opts.Compact, "compact", false, "store canonical code lengths instead of the tree")
+	fs.BoolVar(&opts.FrequencyOrder, "freq-order", false, "store the code lengths most frequent symbol first; implies -compact")
+	fs.BoolVar(&opts.Fast, "fast", false, "code ASCII text with a static English table instead of scanning it")
+	fs.BoolVar(&opts.LSBFirst, "lsb-first", false, "pack payload bits least significant bit first")
+	fs.IntVar(&opts.MinCodeLength, "min-length", 0, "lengthen shorter codes to this many bits")
+	fs.BoolVar(&opts.RLE, "rle", false, "collapse runs of repeated symbols before coding")
+	fs.BoolVar(&opts.SHA256, "sha256", false, "also store a SHA-256 of the input, for decode -verify-sha")
+	fs.Float64Var(&opts.MinRatio, "min-ratio", 0, "store the input uncompressed unless it compresses by at least this ratio (e.g. 1.5)")
+	freqFile := fs.String("freq", "", "build the tree from the frequency table in this JSON or dump file instead of scanning the input")
+	indexInterval := fs.Int("index", 0, "also write an index for DecodeRange to out.huff.idx, with an entry every `n` input bytes")
+	statsJSON := fs.String("stats-json", "", "write compression statistics as JSON to this `file`, or to stdout for -")
+	debugBits := fs.Bool("debug-bits", false, "print the payload as a bit string, packed bytes and bit count to stderr")
+	sparse := fs.Bool("sparse", false, "experimental: code the gaps between symbols other than the most frequent one (other flags are ignored)")
+	stream := fs.Bool("stream", false, "compress in two streaming passes without loading the input (other flags are ignored)")
+	noHeader := fs.Bool("no-header", false, "write only the bit count and payload; the decoder needs the code table")
+	table := fs.String("table", "", "with -no-header, encode with the code table in this JSON file")
+	inplace := fs.Bool("inplace", false, "write in.txt.huff and remove in.txt once the output is verified to decode back to it")
+	writeTable := fs.String("write-table", "", "with -no-header, save the code table built from the input to this JSON file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: huffman encode [flags] in.txt out.huff")
+		fmt.Fprintln(fs.Output(), "       huffman encode -inplace [flags] in.txt")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	paths := fs.Args()
+	if *inplace && len(paths) == 1 {
+		paths = append(paths, paths[0]+".huff")
+	}
+	if len(paths) != 2 || (*inplace && fs.NArg() != 1) {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if *inplace && (*stream || *sparse || *noHeader) {
+		log.Print("-inplace cannot be combined with -stream, -sparse or -no-header")
+		os.Exit(exitUsage)
+	}
+	in, out := paths[0], paths[1]
+
+	if *stream {
+		if err := CompressFileStreaming(in, out, *output); err != nil {
+			fatalf(err, "Failed to encode %s: %v", in, err)
+		}
+		return
+	}
+	text := readInput(in)
+	if *sparse {
+		encodeSparseFile(text, in, out, *output)
+		return
+	}
+	if *freqFile != "" {
+		opts.Frequency = readFrequencyFile(*freqFile)
+	}
+	if *noHeader {
+		var codes map[rune]string
+		switch {
+		case *table != "":
+			codes = readCodesFile(*table)
+		case *writeTable != "":
+			codes = BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+			data, err := MarshalCodes(codes)
+			if err != nil {
+				fatalf(err, "Failed to encode code table: %v", err)
+			}
+			writeOutput(*writeTable, string(data), *output)
+		default:
+			log.Print("-no-header needs -table or -write-table")
+			os.Exit(exitUsage)
+		}
+		data, err := EncodeHeaderless(text, codes)
+		if err != nil {
+			fatalf(err, "Failed to encode %s: %v", in, err)
+		}
+		writeOutput(out, string(data), *output)
+		return
+	}
+	header, payload, err := BuildHuffFile(text, opts)
+	if errors.Is(err, ErrNotStatic) {
+		log.Printf("%s: %v; using an optimal table instead", in, err)
+		opts.Fast = false
+		header, payload, err = BuildHuffFile(text, opts)
+	}
+	if err != nil {
+		fatalf(err, "Failed to encode %s: %v", in, err)
+	}
+	headerBytes := header.appendTo(nil)
+	writeOutput(out, string(headerBytes)+string(payload), *output)
+	if *indexInterval > 0 {
+		writeIndexFile(out+indexSuffix, text, header, *indexInterval, *output)
+	}
+	if *statsJSON != "" {
+		writeStatsJSON(*statsJSON, ComputeStats(text, header), *output)
+	}
+	if *inplace {
+		if err := removeVerifiedSource(in, out, text); err != nil {
+			fatalf(err, "Failed to encode %s in place: %v", in, err)
+		}
+	}
+	if *debugBits {
+		printDebugBits(text, header)
+	}
+	if header.Flags&FlagStored != 0 {
+		fmt.Fprintf(os.Stderr, "%s: stored uncompressed; coding it would not reach a ratio of %g\n", in, opts.MinRatio)
+	}
+
+	if opts.Compact || opts.FrequencyOrder {
+		treeHeader := *header
+		treeHeader.Flags &^= FlagCanonical | FlagFreqOrder
+		fmt.Fprintf(os.Stderr, "header: %d bytes (%d bytes with a serialized tree)\n", len(headerBytes), treeHeader.Size())
+	}
+	if opts.RLE {
+		total := len(headerBytes) + len(payload)
+		fmt.Fprintf(os.Stderr, "run-length + Huffman: %d -> %d bytes (%.1f%% of the original)\n", len(text), total, 100*float64(total)/float64(max(len(text), 1)))
+	}
+}
+
+// writeStatsJSON writes stats as JSON to path, or to stdout if path is "-"
+func writeStatsJSON(path string, stats Stats, opts AtomicOptions) {
+	if path == "-" {
+		if err := stats.WriteJSON(os.Stdout); err != nil {
+			fatalf(err, "Failed to write statistics: %v", err)
+		}
+		return
+	}
+	var buf bytes.Buffer
+	if err := stats.WriteJSON(&buf); err != nil {
+		fatalf(err, "Failed to write statistics: %v", err)
+	}
+	writeOutput(path, buf.String(), opts)
+}
+
+// removeVerifiedSource removes the input file in once the container out
+// has been read back from disk and decodes to text, its contents. If it
+// does not, in is kept and an error returned.
+func removeVerifiedSource(in, out, text string) error {
+	f, err := os.Open(out)
+	if err != nil {
+		return fmt.Errorf("verifying %s, keeping %s: %w", out, in, err)
+	}
+	_, decoded, err := ReadHuffFile(f)
+	f.Close()
+	if err == nil && decoded != text {
+		err = ErrPayloadChecksum
+	}
+	if err != nil {
+		return fmt.Errorf("verifying %s, keeping %s: %w", out, in, err)
+	}
+	return os.Remove(in)
+}
+
+// writeIndexFile writes the index of text coded in the container described
+// by h to path
+func writeIndexFile(path, text string, h *HuffHeader, interval int, opts AtomicOptions) {
+	entries, err := BuildIndex(text, h, interval)
+	if err != nil {
+		fatalf(err, "Failed to index %s: %v", path, err)
+	}
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, entries); err != nil {
+		fatalf(err, "Failed to index %s: %v", path, err)
+	}
+	writeOutput(path, buf.String(), opts)
+}
+
+// encodeSparseFile writes text to out as a sparse file and reports its size
+// against a standard container
+func encodeSparseFile(text, in, out string, opts AtomicOptions) {
+	data, err := EncodeSparse(text)
+	if err != nil {
+		fatalf(err, "Failed to encode %s: %v", in, err)
+	}
+	writeOutput(out, string(data), opts)
+	var standard bytes.Buffer
+	if err := WriteHuffFile(&standard, text); err != nil {
+		fatalf(err, "Failed to encode %s: %v", in, err)
+	}
+	mode := "gap coding"
+	if data[len(sparseMagic)] == sparseStandard {
+		mode = "standard coding, as gap coding is larger"
+	}
+	fmt.Fprintf(os.Stderr, "sparse: %d bytes vs %d bytes standard (ratio %.2f, %s)\n", len(data), standard.Len(), float64(standard.Len())/float64(len(data)), mode)
+}
+
+// printDebugBits writes the payload of a rune-coded container to stderr as
+// a bit string, packed bytes and bit count, after checking they agree
+func printDebugBits(text string, h *HuffHeader) {
+	if h.Flags&(FlagBytes|FlagRLE) != 0 {
+		log.Print("-debug-bits only applies to rune-coded containers without -rle")
+		return
+	}
+	dump, err := DebugBits(text, BuildCodes(h.DecodingTree()))
+	fmt.Fprintf(os.Stderr, "bits:      %s\n", dump.Bits)
+	fmt.Fprintf(os.Stderr, "packed:    % x\n", dump.Packed)
+	fmt.Fprintf(os.Stderr, "bit count: %d\n", dump.BitCount)
+	if err != nil {
+		fatalf(err, "Bit parity check failed: %v", err)
+	}
+}
+
+// runDecode implements "huffman decode in.huff out.txt". The output is
+// streamed to a temporary file that is only renamed into place once the
+// checksum has been verified, so a failed decode never leaves a truncated
+// file behind.
+func runDecode(args []string) {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	output := modeFlag(fs)
+	table := fs.String("table", "", "decode a header-less payload with the code table in this JSON file")
+	partialOK := fs.Bool("partial-ok", false, "decode a truncated file up to its last complete symbol")
+	verifySHA := fs.Bool("verify-sha", false, "check the output against the SHA-256 stored by encode -sha256")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: huffman decode [flags] in.huff out.txt")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if *verifySHA && (*table != "" || *partialOK) {
+		log.Print("-verify-sha cannot be combined with -table or -partial-ok")
+		os.Exit(exitUsage)
+	}
+	if *table != "" {
+		text, err := DecodeHeaderless([]byte(readInput(fs.Arg(0))), readCodesFile(*table))
+		if err != nil {
+			fatalf(err, "Failed to decode %s: %v", fs.Arg(0), err)
+		}
+		writeOutput(fs.Arg(1), text, *output)
+		return
+	}
+	if *partialOK {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fatalf(err, "Failed to read file: %v", err)
+		}
+		defer f.Close()
+		_, text, discarded, err := ReadHuffFilePartial(f)
+		if err != nil {
+			fatalf(err, "Failed to decode %s: %v", fs.Arg(0), err)
+		}
+		writeOutput(fs.Arg(1), text, *output)
+		if discarded > 0 {
+			log.Printf("%s is truncated: discarded %d trailing bits", fs.Arg(0), discarded)
+		}
+		return
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fatalf(err, "Failed to read file: %v", err)
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(archiveMagic))
+	if string(magic) == sparseMagic {
+		if *verifySHA {
+			fatalf(errNoSHA256, "Failed to decode %s: -verify-sha needs a .huff container, not a sparse file", fs.Arg(0))
+		}
+		data, err := io.ReadAll(br)
+		if err != nil {
+			fatalf(err, "Failed to read file: %v", err)
+		}
+		text, err := DecodeSparse(data)
+		if err != nil {
+			fatalf(err, "Failed to decode %s: %v", fs.Arg(0), err)
+		}
+		writeOutput(fs.Arg(1), text, *output)
+		return
+	}
+	if string(magic) == archiveMagic {
+		if *verifySHA {
+			fatalf(errNoSHA256, "Failed to decode %s: -verify-sha needs a .huff container, not an archive", fs.Arg(0))
+		}
+		err := writeFileAtomicFunc(fs.Arg(1), *output, func(w io.Writer) error {
+			return ReadBlocks(br, func(_ int, block *Decoder) error {
+				_, err := io.Copy(w, block)
+				return err
+			})
+		})
+		if err != nil {
+			fatalf(err, "Failed to decode %s: %v", fs.Arg(0), err)
+		}
+		return
+	}
+	d, err := NewContainerDecoder(br)
+	if errors.Is(err, ErrNotHuff) {
+		fatalf(err, "Failed to decode %s: %v (%v; pass it with -table)", fs.Arg(0), err, errNoTable)
+	}
+	if err != nil {
+		fatalf(err, "Failed to decode %s: %v", fs.Arg(0), err)
+	}
+	if *verifySHA && d.Header().Flags&FlagSHA256 == 0 {
+		fatalf(errNoSHA256, "Failed to decode %s: %v", fs.Arg(0), errNoSHA256)
+	}
+	err = writeFileAtomicFunc(fs.Arg(1), *output, func(w io.Writer) error {
+		if !*verifySHA {
+			_, err := io.Copy(w, d)
+			return err
+		}
+		sum := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(w, sum), d); err != nil {
+			return err
+		}
+		return d.Header().VerifySHA256(sum.Sum(nil))
+	})
+	if err != nil {
+		fatalf(err, "Failed to decode %s: %v", fs.Arg(0), err)
+	}
+}
+
+// modeFlag registers -mode, the octal permission mode of created output
+// files, and -tmpdir, the directory their temporary files are written in,
+// returning the options they set once the flags are parsed
+func modeFlag(fs *flag.FlagSet) *AtomicOptions {
+	opts := &AtomicOptions{Perm: 0644}
+	fs.StringVar(&opts.TempDir, "tmpdir", "", "write temporary output files in this `dir` instead of next to the output")
+	fs.Func("mode", "permission `bits` of output files, in octal (default 0644)", func(s string) error {
+		mode, err := strconv.ParseUint(s, 8, 32)
+		if err != nil || mode > 0777 {
+			return fmt.Errorf("invalid mode %q", s)
+		}
+		opts.Perm = os.FileMode(mode)
+		return nil
+	})
+	return opts
+}
+
+// readCodesFile reads a code table saved by MarshalCodes
+func readCodesFile(path string) map[rune]string {
+	codes, err := UnmarshalCodes([]byte(readInput(path)))
+	if err != nil {
+		fatalf(err, "Failed to read code table %s: %v", path, err)
+	}
+	return codes
+}
+
+// readFrequencyFile reads a frequency table written by "huffman dump",
+// either as JSON or as text
+func readFrequencyFile(path string) map[rune]int {
+	data := readInput(path)
+	var frequency map[rune]int
+	var err error
+	if strings.HasPrefix(strings.TrimSpace(data), "[") {
+		frequency, err = UnmarshalFrequencies([]byte(data))
+	} else {
+		frequency, err = ReadFrequencyDump(strings.NewReader(data))
+	}
+	if err != nil {
+		fatalf(err, "Failed to read frequency table %s: %v", path, err)
+	}
+	return frequency
+}
+
+// runInspect implements "huffman inspect foo.huff", printing the container
+// header without decoding the payload
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), "usage: huffman inspect foo.huff") }
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fatalf(err, "Failed to read file: %v", err)
+	}
+	defer f.Close()
+	h, err := ReadHuffHeader(f)
+	if err != nil {
+		fatalf(err, "Failed to inspect %s: %v", fs.Arg(0), err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		fatalf(err, "Failed to read file: %v", err)
+	}
+
+	fmt.Printf("magic:            %s\n", huffMagic)
+	fmt.Printf("version:          %d\n", h.Version)
+	fmt.Printf("flags:            %#02x\n", h.Flags)
+	fmt.Printf("original size:    %d bytes\n", h.OriginalSize)
+	fmt.Printf("header size:      %d bytes\n", h.Size())
+	fmt.Printf("compressed size:  %d bytes (%d payload bits, %d bytes total)\n", h.PayloadSize(), h.BitCount, info.Size())
+	fmt.Printf("symbols:          %d\n", h.SymbolCount)
+	fmt.Printf("distinct symbols: %d\n", h.DistinctSymbols())
+	fmt.Printf("checksum:         %08x (CRC-32)\n", h.Checksum)
+	if h.Flags&FlagSHA256 != 0 {
+		fmt.Printf("sha256:           %x\n", h.SHA256)
+	}
+}
+
+// runVerify implements "huffman verify [-quick] foo.huff". A quick verify
+// only checks the header checksum; a full verify also decodes the payload
+// and checks it against the checksum of the original.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	quick := fs.Bool("quick", false, "only check the header checksum")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: huffman verify [-quick] foo.huff")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fatalf(err, "Failed to read file: %v", err)
+	}
+	defer f.Close()
+	if *quick {
+		_, err = ReadHuffHeader(f)
+	} else {
+		_, _, err = ReadHuffFile(f)
+	}
+	if err != nil {
+		fatalf(err, "%s: %v", fs.Arg(0), err)
+	}
+	fmt.Fprintf(os.Stderr, "%s: OK\n", fs.Arg(0))
+}
+
+// runCheck implements "huffman check [-full] dir", checking every .huff
+// file under dir and printing OK or FAIL with the reason for each, then a
+// summary. It exits non-zero if any file fails.
+func runCheck(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	full := fs.Bool("full", false, "also decode each payload and check it against its checksum")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: huffman check [-full] dir")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	var ok, failed int
+	err := filepath.WalkDir(fs.Arg(0), func(path string, entry os.DirEntry, err error) error {
+		if err == nil && (entry.IsDir() || filepath.Ext(path) != ".huff") {
+			return nil
+		}
+		if err == nil {
+			err = CheckFile(path, *full)
+		}
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", path, err)
+			failed++
+		} else {
+			fmt.Printf("OK   %s\n", path)
+			ok++
+		}
+		return nil
+	})
+	if err != nil {
+		fatalf(err, "Failed to check %s: %v", fs.Arg(0), err)
+	}
+	fmt.Printf("%d files: %d OK, %d failed\n", ok+failed, ok, failed)
+	if failed > 0 {
+		os.Exit(exitFailure)
+	}
+}
+
+// runSelfTest implements "huffman selftest", round-tripping a built-in
+// battery of inputs in memory and exiting non-zero if any case fails
+func runSelfTest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), "usage: huffman selftest") }
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if !runSelfTestCases(os.Stdout) {
+		os.Exit(exitFailure)
+	}
+}
+
+// runOptimize implements "huffman optimize in.huff out.huff", recompressing
+// a container with an optimal table and reporting the size change
+func runOptimize(args []string) {
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	output := modeFlag(fs)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), "usage: huffman optimize in.huff out.huff") }
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	data := readInput(fs.Arg(0))
+	optimized, err := OptimizeHuffFile([]byte(data))
+	if err != nil {
+		fatalf(err, "Failed to optimize %s: %v", fs.Arg(0), err)
+	}
+	writeOutput(fs.Arg(1), string(optimized), *output)
+	fmt.Fprintf(os.Stderr, "%s: %d -> %d bytes (%+d)\n", fs.Arg(0), len(data), len(optimized), len(optimized)-len(data))
+}
+
+// runDump implements "huffman dump in.txt", listing each symbol with its
+// count and code in a stable order suitable for diffing
+func runDump(args []string) {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "write the frequency table as JSON, for encode -freq")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: huffman dump [-json] in.txt")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	frequency := BuildFrequencyTable(readInput(fs.Arg(0)))
+	if *asJSON {
+		data, err := MarshalFrequencies(frequency)
+		if err != nil {
+			fatalf(err, "Failed to write dump: %v", err)
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+	codes := BuildCodes(BuildHuffmanTree(frequency))
+	if err := WriteFrequencyDump(os.Stdout, frequency, codes); err != nil {
+		fatalf(err, "Failed to write dump: %v", err)
+	}
+}
+
+// runConcat implements "huffman concat out.huff in.huff...", joining
+// containers into a multi-block archive without recompressing them
+func runConcat(args []string) {
+	fs := flag.NewFlagSet("concat", flag.ExitOnError)
+	output := modeFlag(fs)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), "usage: huffman concat out.huff in.huff...") }
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	var blocks [][]byte
+	for _, name := range fs.Args()[1:] {
+		blocks = append(blocks, []byte(readInput(name)))
+	}
+	archive, err := ConcatBlocks(blocks...)
+	if err != nil {
+		fatalf(err, "Failed to concatenate: %v", err)
+	}
+	writeOutput(fs.Arg(0), string(archive), *output)
+}
+
+// runArchive implements "huffman archive out.huff in.txt...", compressing
+// each input into one block of an archive
+func runArchive(args []string) {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	output := modeFlag(fs)
+	workers := fs.Int("j", runtime.NumCPU(), "compress up to `n` files at once")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: huffman archive [-j n] out.huff in.txt...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 || *workers < 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	archive, err := ArchiveFiles(fs.Args()[1:], EncodeOptions{}, *workers)
+	if err != nil {
+		fatalf(err, "Failed to archive: %v", err)
+	}
+	writeOutput(fs.Arg(0), string(archive), *output)
+}
+
+// runExtractTable implements "huffman extract-table -o codes.json foo.huff",
+// writing the code table of a container as JSON without decoding its
+// payload. As with the other commands, flags come before the file name.
+// The table can be passed to "encode -no-header -table".
+func runExtractTable(args []string) {
+	fs := flag.NewFlagSet("extract-table", flag.ExitOnError)
+	output := modeFlag(fs)
+	out := fs.String("o", "", "write the table to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: huffman extract-table [-o codes.json] foo.huff")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	args = fs.Args()
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fatalf(err, "Failed to read file: %v", err)
+	}
+	defer f.Close()
+	h, err := ReadHuffHeader(f)
+	if err != nil {
+		fatalf(err, "Failed to read %s: %v", args[0], err)
+	}
+	data, err := MarshalCodes(BuildCodes(h.DecodingTree()))
+	if err != nil {
+		fatalf(err, "Failed to encode code table: %v", err)
+	}
+	if *out == "" {
+		fmt.Printf("%s\n", data)
+		return
+	}
+	writeOutput(*out, string(data), *output)
+}
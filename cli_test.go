@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// cliEnv is set in the environment of runCLI's child process, so the test
+// binary runs main with its arguments instead of the tests
+const cliEnv = "HUFFMAN_RUN_CLI"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(cliEnv) != "" {
+		os.Args[0] = "huffman"
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs the CLI with args in dir, returning its stdout, stderr and
+// exit code
+func runCLI(t *testing.T, dir string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), cliEnv+"=1")
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+// writeContainer writes text as a .huff container named name in dir and
+// returns its path
+func writeContainer(t *testing.T, dir, name, text string, opts EncodeOptions) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteHuffFileWithOptions(&buf, text, opts); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// corruptPayload returns container data with one payload bit flipped such
+// that it still decodes, but to text failing the payload checksum
+func corruptPayload(t *testing.T, data []byte) []byte {
+	t.Helper()
+	for i := headerSize(t, data) * 8; i < len(data)*8; i++ {
+		corrupt := bytes.Clone(data)
+		corrupt[i/8] ^= 0x80 >> (i % 8)
+		if _, _, err := ReadHuffFile(bytes.NewReader(corrupt)); errors.Is(err, ErrPayloadChecksum) {
+			return corrupt
+		}
+	}
+	t.Fatal("no payload bit flip fails only the payload checksum")
+	return nil
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	text := "inspect me, inspect me"
+	writeContainer(t, dir, "known.huff", text, EncodeOptions{SHA256: true})
+
+	stdout, stderr, code := runCLI(t, dir, "inspect", "known.huff")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	for _, want := range []string{
+		"magic:            HUFF\n",
+		"version:          2\n",
+		fmt.Sprintf("original size:    %d bytes\n", len(text)),
+		fmt.Sprintf("symbols:          %d\n", len(text)),
+		"distinct symbols: 10\n",
+		fmt.Sprintf("checksum:         %08x (CRC-32)\n", crc32.ChecksumIEEE([]byte(text))),
+		"sha256:           ",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("inspect output lacks %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestInspectInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "plain.txt"), []byte("just some text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		code int
+		msg  string
+	}{
+		{"not a container", []string{"inspect", "plain.txt"}, exitFormat, "not a .huff file"},
+		{"missing file", []string{"inspect", "missing.huff"}, exitIO, "no such file"},
+		{"no arguments", []string{"inspect"}, exitUsage, "usage:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, code := runCLI(t, dir, tt.args...)
+			if code != tt.code || !strings.Contains(stderr, tt.msg) {
+				t.Errorf("exit code %d, stderr %q; want %d and %q", code, stderr, tt.code, tt.msg)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("verify the header, then the payload ", 4)
+	path := writeContainer(t, dir, "good.huff", text, EncodeOptions{})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := headerSize(t, data)
+
+	corruptHeader := bytes.Clone(data)
+	corruptHeader[size-5] ^= 0xff // last byte of the header body
+	corruptPayload := corruptPayload(t, data)
+	for name, content := range map[string][]byte{"header.huff": corruptHeader, "payload.huff": corruptPayload} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		code int
+		msg  string
+	}{
+		{[]string{"verify", "-quick", "good.huff"}, 0, "OK"},
+		{[]string{"verify", "good.huff"}, 0, "OK"},
+		{[]string{"verify", "-quick", "header.huff"}, exitChecksum, ErrHeaderChecksum.Error()},
+		{[]string{"verify", "header.huff"}, exitChecksum, ErrHeaderChecksum.Error()},
+		// A quick verify does not look at the payload
+		{[]string{"verify", "-quick", "payload.huff"}, 0, "OK"},
+		{[]string{"verify", "payload.huff"}, exitChecksum, ErrPayloadChecksum.Error()},
+	}
+	for _, tt := range tests {
+		_, stderr, code := runCLI(t, dir, tt.args...)
+		if code != tt.code || !strings.Contains(stderr, tt.msg) {
+			t.Errorf("%v: exit code %d, stderr %q; want %d and %q", tt.args, code, stderr, tt.code, tt.msg)
+		}
+	}
+}
+
+func TestDecodeChecksumFailure(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("a failed decode leaves no output behind ", 4)
+	path := writeContainer(t, dir, "in.huff", text, EncodeOptions{})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, corruptPayload(t, data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stderr, code := runCLI(t, dir, "decode", "in.huff", "out.txt")
+	if code != exitChecksum || !strings.Contains(stderr, ErrPayloadChecksum.Error()) {
+		t.Errorf("exit code %d, stderr %q; want %d and a checksum error", code, stderr, exitChecksum)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files after a failed decode, want only in.huff", len(entries))
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("exit codes tell scripts what went wrong ", 4)
+	path := writeContainer(t, dir, "good.huff", text, EncodeOptions{})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string][]byte{
+		"in.txt":       []byte(text),
+		"plain.huff":   []byte("not a container"),
+		"payload.huff": corruptPayload(t, data),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"encode", []string{"encode", "in.txt", "out.huff"}, 0},
+		{"decode", []string{"decode", "good.huff", "out.txt"}, 0},
+		{"missing input", []string{"encode", "missing.txt", "out.huff"}, exitIO},
+		{"unwritable output", []string{"decode", "good.huff", filepath.Join("missing", "out.txt")}, exitIO},
+		{"not a container", []string{"decode", "plain.huff", "out.txt"}, exitFormat},
+		{"payload checksum", []string{"decode", "payload.huff", "out.txt"}, exitChecksum},
+		{"missing arguments", []string{"decode", "good.huff"}, exitUsage},
+		{"unknown flag", []string{"decode", "-bogus", "good.huff", "out.txt"}, exitUsage},
+		{"demo without input.txt", nil, exitIO},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, stderr, code := runCLI(t, dir, tt.args...); code != tt.code {
+				t.Errorf("exit code %d, want %d; stderr %q", code, tt.code, stderr)
+			}
+		})
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "input.txt"), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runCLI(t, dir, "-encoding", "latin-1"); code != exitUsage {
+		t.Errorf("demo with a bad -encoding: exit code %d, want %d; stderr %q", code, exitUsage, stderr)
+	}
+}
+
+func TestDecodeVerifySHA(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("decode -verify-sha recomputes the SHA-256 ", 4)
+	path := writeContainer(t, dir, "sha.huff", text, EncodeOptions{SHA256: true})
+	writeContainer(t, dir, "plain.huff", text, EncodeOptions{})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "wrong.huff"), withWrongSHA256(t, data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		code int
+		msg  string
+	}{
+		{[]string{"decode", "-verify-sha", "sha.huff", "out.txt"}, 0, ""},
+		{[]string{"decode", "-verify-sha", "wrong.huff", "out.txt"}, exitChecksum, "SHA-256 differs"},
+		// The CRC-32 still matches, so only -verify-sha notices
+		{[]string{"decode", "wrong.huff", "out.txt"}, 0, ""},
+		{[]string{"decode", "-verify-sha", "plain.huff", "out.txt"}, exitFailure, errNoSHA256.Error()},
+	}
+	for _, tt := range tests {
+		os.Remove(filepath.Join(dir, "out.txt"))
+		_, stderr, code := runCLI(t, dir, tt.args...)
+		if code != tt.code || !strings.Contains(stderr, tt.msg) {
+			t.Errorf("%v: exit code %d, stderr %q; want %d and %q", tt.args, code, stderr, tt.code, tt.msg)
+			continue
+		}
+		out, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+		if tt.code == 0 && string(out) != text {
+			t.Errorf("%v: output %q, want the original text", tt.args, out)
+		}
+		if tt.code != 0 && err == nil {
+			t.Errorf("%v: output written despite failing", tt.args)
+		}
+	}
+}
+
+func TestEncodeInplace(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("compressed in place, removed once verified ", 4)
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runCLI(t, dir, "encode", "-inplace", "in.txt"); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "in.txt.huff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := ReadHuffFile(bytes.NewReader(data)); err != nil || got != text {
+		t.Errorf("in.txt.huff decodes to %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "in.txt")); !os.IsNotExist(err) {
+		t.Errorf("in.txt survived a verified encode: %v", err)
+	}
+}
+
+func TestRemoveVerifiedSourceFailure(t *testing.T) {
+	text := strings.Repeat("a failed verification keeps the original ", 4)
+	good := encodeContainer(t, text, EncodeOptions{})
+	tests := []struct {
+		name string
+		out  []byte // nil for a missing output
+		want error
+	}{
+		{"missing output", nil, os.ErrNotExist},
+		{"corrupt payload", corruptPayload(t, good), ErrPayloadChecksum},
+		{"truncated output", good[:len(good)-3], io.ErrUnexpectedEOF},
+		{"other text", encodeContainer(t, text+"!", EncodeOptions{}), ErrPayloadChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			in, out := filepath.Join(dir, "in.txt"), filepath.Join(dir, "in.txt.huff")
+			if err := os.WriteFile(in, []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.out != nil {
+				if err := os.WriteFile(out, tt.out, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := removeVerifiedSource(in, out, text); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+			if data, err := os.ReadFile(in); err != nil || string(data) != text {
+				t.Errorf("original not kept intact: %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("check walks a directory of containers ", 4)
+	path := writeContainer(t, dir, "good.huff", text, EncodeOptions{})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corruptHeader := bytes.Clone(data)
+	corruptHeader[headerSize(t, data)-5] ^= 0xff
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string][]byte{
+		"bad.huff":         corruptHeader,
+		"sub/payload.huff": corruptPayload(t, data),
+		"notes.txt":        []byte("not a container, and not checked"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		code int
+		want []string
+	}{
+		{[]string{"check", "."}, exitFailure, []string{
+			"OK   good.huff\n",
+			"FAIL bad.huff: " + ErrHeaderChecksum.Error(),
+			// Only -full decodes the payload
+			"OK   " + filepath.Join("sub", "payload.huff") + "\n",
+			"3 files: 2 OK, 1 failed\n",
+		}},
+		{[]string{"check", "-full", "."}, exitFailure, []string{
+			"OK   good.huff\n",
+			"FAIL bad.huff: ",
+			"FAIL " + filepath.Join("sub", "payload.huff") + ": ",
+			"3 files: 1 OK, 2 failed\n",
+		}},
+		{[]string{"check", "-full", "sub"}, exitFailure, []string{"1 files: 0 OK, 1 failed\n"}},
+		{[]string{"check"}, exitUsage, nil},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runCLI(t, dir, tt.args...)
+		if code != tt.code {
+			t.Errorf("%v: exit code %d, want %d; stderr %q", tt.args, code, tt.code, stderr)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(stdout, want) {
+				t.Errorf("%v: output lacks %q:\n%s", tt.args, want, stdout)
+			}
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, "bad.huff")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if stdout, _, code := runCLI(t, dir, "check", "-full", "."); code != 0 || !strings.Contains(stdout, "1 files: 1 OK, 0 failed\n") {
+		t.Errorf("directory of good files: exit code %d, output %q", code, stdout)
+	}
+}
+
+func TestOutputMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permission bits")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("private notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		out  string
+		perm os.FileMode
+	}{
+		{[]string{"encode", "in.txt", "default.huff"}, "default.huff", 0644},
+		{[]string{"encode", "-mode", "600", "in.txt", "private.huff"}, "private.huff", 0600},
+		{[]string{"decode", "-mode", "0640", "private.huff", "out.txt"}, "out.txt", 0640},
+	}
+	for _, tt := range tests {
+		if _, stderr, code := runCLI(t, dir, tt.args...); code != 0 {
+			t.Fatalf("%v: exit code %d: %s", tt.args, code, stderr)
+		}
+		info, err := os.Stat(filepath.Join(dir, tt.out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != tt.perm {
+			t.Errorf("%v: mode = %v, want %v", tt.args, info.Mode().Perm(), tt.perm)
+		}
+	}
+	if _, _, code := runCLI(t, dir, "encode", "-mode", "999", "in.txt", "bad.huff"); code != exitUsage {
+		t.Errorf("invalid -mode: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestTempDirFlag(t *testing.T) {
+	dir, tmpDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("staged elsewhere"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runCLI(t, dir, "encode", "-tmpdir", tmpDir, "in.txt", "out.huff"); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.huff")); err != nil {
+		t.Error(err)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("%d temporary files left in the -tmpdir directory", len(entries))
+	}
+	if _, _, code := runCLI(t, dir, "encode", "-tmpdir", filepath.Join(dir, "missing"), "in.txt", "out2.huff"); code != exitIO {
+		t.Errorf("missing -tmpdir: exit code %d, want %d", code, exitIO)
+	}
+}
+
+func TestExtractTable(t *testing.T) {
+	dir := t.TempDir()
+	sample := "a sample whose table other files reuse"
+	message := "those files reuse a simple table"
+	if err := os.WriteFile(filepath.Join(dir, "message.txt"), []byte(message), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []EncodeOptions{{}, {Compact: true}, {FrequencyOrder: true}} {
+		mode := modeName(opts)
+		writeContainer(t, dir, "sample.huff", sample, opts)
+		if _, stderr, code := runCLI(t, dir, "extract-table", "-o", "codes.json", "sample.huff"); code != 0 {
+			t.Fatalf("%s: extract-table: exit code %d: %s", mode, code, stderr)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "codes.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes, err := UnmarshalCodes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := CodeLengths(BuildHuffmanTree(BuildFrequencyTable(sample))); !maps.Equal(CodeLengths(mustTreeFromCodes(t, codes)), want) {
+			t.Errorf("%s: extracted code lengths differ from the sample's", mode)
+		}
+		stdout, _, code := runCLI(t, dir, "extract-table", "sample.huff")
+		if code != 0 || stdout != string(data)+"\n" {
+			t.Errorf("%s: stdout %q, want the table", mode, stdout)
+		}
+
+		// Round trip through the external-table encode and decode
+		if _, stderr, code := runCLI(t, dir, "encode", "-no-header", "-table", "codes.json", "message.txt", "message.bin"); code != 0 {
+			t.Fatalf("%s: encode: exit code %d: %s", mode, code, stderr)
+		}
+		if _, stderr, code := runCLI(t, dir, "decode", "-table", "codes.json", "message.bin", "message.out"); code != 0 {
+			t.Fatalf("%s: decode: exit code %d: %s", mode, code, stderr)
+		}
+		if got, err := os.ReadFile(filepath.Join(dir, "message.out")); err != nil || string(got) != message {
+			t.Errorf("%s: round trip = %q, %v; want %q", mode, got, err, message)
+		}
+	}
+
+	// Flags follow the other commands and come before the file name
+	for _, args := range [][]string{{"extract-table"}, {"extract-table", "sample.huff", "-o", "codes.json"}} {
+		if _, _, code := runCLI(t, dir, args...); code != exitUsage {
+			t.Errorf("%q: exit code %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+// mustTreeFromCodes returns the decoding tree of a code table
+func mustTreeFromCodes(t *testing.T, codes map[rune]string) *HuffmanNode {
+	t.Helper()
+	root, err := TreeFromCodes(codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestEncodeFrequencyFile(t *testing.T) {
+	dir := t.TempDir()
+	corpus := strings.Repeat("a shared table built once from a larger corpus. ", 20)
+	text := "a shared table"
+	for name, data := range map[string]string{"corpus.txt": corpus, "in.txt": text, "other.txt": "a shared tableQ"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := CodeLengths(BuildHuffmanTree(BuildFrequencyTable(corpus)))
+
+	for _, format := range []string{"json", "dump"} {
+		t.Run(format, func(t *testing.T) {
+			args := []string{"dump", "corpus.txt"}
+			if format == "json" {
+				args = []string{"dump", "-json", "corpus.txt"}
+			}
+			stats, stderr, code := runCLI(t, dir, args...)
+			if code != 0 {
+				t.Fatalf("dump: exit code %d: %s", code, stderr)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "stats"), []byte(stats), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, stderr, code := runCLI(t, dir, "encode", "-freq", "stats", "in.txt", "out.huff"); code != 0 {
+				t.Fatalf("encode: exit code %d: %s", code, stderr)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "out.huff"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, got, err := ReadHuffFile(bytes.NewReader(data))
+			if err != nil || got != text {
+				t.Fatalf("out.huff decodes to %q, %v", got, err)
+			}
+			if lengths := CodeLengths(root); !maps.Equal(lengths, want) {
+				t.Errorf("code lengths %v, want those of the corpus %v", lengths, want)
+			}
+
+			if _, stderr, code := runCLI(t, dir, "encode", "-freq", "stats", "other.txt", "other.huff"); code == 0 {
+				t.Error("encoding a symbol absent from the frequency table succeeded")
+			} else if !strings.Contains(stderr, "Q") {
+				t.Errorf("error does not name the missing symbol: %s", stderr)
+			}
+		})
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad"), []byte("not a table\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, code := runCLI(t, dir, "encode", "-freq", "bad", "in.txt", "out.huff"); code == 0 {
+		t.Error("encode accepted an unreadable frequency table")
+	}
+}
+
+func TestEncodeStatsJSON(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("statistics as one line of JSON ", 30)
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runCLI(t, dir, "encode", "-stats-json", "-", "in.txt", "out.huff")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if _, stderr, code := runCLI(t, dir, "encode", "-stats-json", "stats.json", "in.txt", "out2.huff"); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	file, err := os.ReadFile(filepath.Join(dir, "stats.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "out.huff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ReadHuffHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ComputeStats(text, h)
+
+	for name, output := range map[string]string{"stdout": stdout, "file": string(file)} {
+		var stats Stats
+		if err := json.Unmarshal([]byte(output), &stats); err != nil {
+			t.Fatalf("%s: %v in %q", name, err, output)
+		}
+		if stats != want {
+			t.Errorf("%s: stats %+v, want %+v", name, stats, want)
+		}
+		if stats.CompressedSize != len(data) || stats.OriginalSize != len(text) {
+			t.Errorf("%s: sizes %d and %d, want %d and %d", name, stats.OriginalSize, stats.CompressedSize, len(text), len(data))
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// TreeFromCodes rebuilds a decoding tree from a code table, failing if the
+// table is not a valid prefix code
+func TreeFromCodes(codes map[rune]string) (*HuffmanNode, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	root := &HuffmanNode{}
+	leaves := make(map[*HuffmanNode]bool, len(codes))
+	for char, code := range codes {
+		if code == "" {
+			return nil, fmt.Errorf("symbol %q has an empty code", char)
+		}
+		node := root
+		for i := 0; i < len(code); i++ {
+			if leaves[node] {
+				return nil, fmt.Errorf("code for %q extends the code of %q", char, node.character)
+			}
+			child := &node.left
+			switch code[i] {
+			case '0':
+			case '1':
+				child = &node.right
+			default:
+				return nil, fmt.Errorf("code for %q contains invalid bit %q", char, code[i])
+			}
+			if *child == nil {
+				*child = &HuffmanNode{}
+			}
+			node = *child
+		}
+		if leaves[node] || node.left != nil || node.right != nil {
+			return nil, fmt.Errorf("code for %q is a prefix of another code", char)
+		}
+		node.character = char
+		leaves[node] = true
+	}
+	return root, nil
+}
+
+// PrefixConflicts returns every pair of symbols whose codes collide: the
+// first symbol's code is a prefix of, or equal to, the second's. Pairs are
+// ordered by code, for diagnosing tables that fail to decode.
+func PrefixConflicts(codes map[rune]string) [][2]rune {
+	symbols := make([]rune, 0, len(codes))
+	for char := range codes {
+		symbols = append(symbols, char)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		ci, cj := codes[symbols[i]], codes[symbols[j]]
+		if ci != cj {
+			return ci < cj
+		}
+		return symbols[i] < symbols[j]
+	})
+
+	// In sorted order, every code a given code prefixes follows it directly
+	var conflicts [][2]rune
+	for i, char := range symbols {
+		for _, other := range symbols[i+1:] {
+			if !strings.HasPrefix(codes[other], codes[char]) {
+				break
+			}
+			conflicts = append(conflicts, [2]rune{char, other})
+		}
+	}
+	return conflicts
+}
+
+// IsPrefixCode reports whether no code in the table is a prefix of another
+func IsPrefixCode(codes map[rune]string) bool {
+	return len(PrefixConflicts(codes)) == 0
+}
+
+// ComputeCodes builds the tree and code table for text and checks the
+// table before returning it: every symbol of text must have a code of '0'
+// and '1' characters, and the codes must form a prefix code. A failed
+// check means an internal inconsistency and is returned as an error
+// rather than as codes that would not decode. Empty text gives an empty
+// table and a nil tree.
+func ComputeCodes(text string) (map[rune]string, *HuffmanNode, error) {
+	frequency := BuildFrequencyTable(text)
+	root := BuildHuffmanTree(frequency)
+	codes := BuildCodes(root)
+	for char := range frequency {
+		code, ok := codes[char]
+		if !ok || code == "" || strings.Trim(code, "01") != "" {
+			return nil, nil, fmt.Errorf("symbol %q has invalid code %q", char, code)
+		}
+	}
+	if len(codes) != len(frequency) {
+		return nil, nil, fmt.Errorf("%d codes for %d symbols", len(codes), len(frequency))
+	}
+	if conflicts := PrefixConflicts(codes); len(conflicts) > 0 {
+		pair := conflicts[0]
+		return nil, nil, fmt.Errorf("code %q of %q is a prefix of code %q of %q", codes[pair[0]], pair[0], codes[pair[1]], pair[1])
+	}
+	return codes, root, nil
+}
+
+// maxCachedTrees bounds the code cache of EncodeWithTree; it is cleared
+// when full rather than tracking which tree was used least recently
+const maxCachedTrees = 64
+
+var (
+	treeCodesMu sync.Mutex
+	treeCodes   = make(map[*HuffmanNode]map[rune]string)
+)
+
+// EncodeWithTree encodes text with the codes of a tree built earlier,
+// skipping the frequency pass when many similar messages share one tree.
+// The codes are cached per tree, so only the first call for a tree walks
+// it. It fails if text holds a symbol that has no leaf in root.
+func EncodeWithTree(text string, root *HuffmanNode) (string, error) {
+	return encodeChecked(text, cachedCodes(root))
+}
+
+// cachedCodes returns the code table of root, building it on first use
+func cachedCodes(root *HuffmanNode) map[rune]string {
+	treeCodesMu.Lock()
+	defer treeCodesMu.Unlock()
+	codes, ok := treeCodes[root]
+	if !ok {
+		if len(treeCodes) >= maxCachedTrees {
+			clear(treeCodes)
+		}
+		codes = BuildCodes(root)
+		treeCodes[root] = codes
+	}
+	return codes
+}
+
+// forgetCodes drops the cached codes of root, whose nodes are about to be
+// reused for another tree
+func forgetCodes(root *HuffmanNode) {
+	treeCodesMu.Lock()
+	delete(treeCodes, root)
+	treeCodesMu.Unlock()
+}
+
+// encodeChecked encodes text like Encode but fails on symbols missing from
+// the code table instead of silently dropping them
+func encodeChecked(text string, codes map[rune]string) (string, error) {
+	var sb strings.Builder
+	for _, char := range text {
+		code, ok := codes[char]
+		if !ok {
+			return "", fmt.Errorf("symbol %q is not in the code table", char)
+		}
+		sb.WriteString(code)
+	}
+	return sb.String(), nil
+}
+
+// codeEntry is the JSON form of one code table entry. Symbol is only for
+// readability; Rune is authoritative, so code points with no UTF-8 form,
+// such as surrogates, values above utf8.MaxRune or escapeSymbol, round-trip
+// as integers.
+type codeEntry struct {
+	Rune   rune   `json:"rune"`
+	Symbol string `json:"symbol,omitempty"`
+	Code   string `json:"code"`
+}
+
+// symbolLabel returns char as a string for the readable Symbol field of
+// JSON entries, or "" if char is not a valid code point, which string
+// would turn into U+FFFD
+func symbolLabel(char rune) string {
+	if !utf8.ValidRune(char) {
+		return ""
+	}
+	return string(char)
+}
+
+// MarshalCodes encodes a code table as JSON. Entries are sorted by code
+// point, so equal tables always marshal to identical bytes.
+func MarshalCodes(codes map[rune]string) ([]byte, error) {
+	return json.MarshalIndent(sortedCodeEntries(codes), "", "  ")
+}
+
+// sortedCodeEntries returns the entries of a code table in code point order
+func sortedCodeEntries(codes map[rune]string) []codeEntry {
+	entries := make([]codeEntry, 0, len(codes))
+	for char, code := range codes {
+		entries = append(entries, codeEntry{Rune: char, Symbol: symbolLabel(char), Code: code})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Rune < entries[j].Rune })
+	return entries
+}
+
+// UnmarshalCodes decodes a code table written by MarshalCodes
+func UnmarshalCodes(data []byte) (map[rune]string, error) {
+	var entries []codeEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	codes := make(map[rune]string, len(entries))
+	for _, e := range entries {
+		if _, dup := codes[e.Rune]; dup {
+			return nil, fmt.Errorf("symbol %q appears twice", e.Rune)
+		}
+		codes[e.Rune] = e.Code
+	}
+	return codes, nil
+}
+
+// Kinds of CodeDiff
+const (
+	CodeAdded         = "added"
+	CodeRemoved       = "removed"
+	CodeChanged       = "changed"        // same length, different bits
+	CodeLengthChanged = "length changed" // different length
+)
+
+// CodeDiff is one difference between two code tables. Old is empty for an
+// added symbol and New for a removed one.
+type CodeDiff struct {
+	Symbol   rune
+	Kind     string
+	Old, New string
+}
+
+// DiffCodes reports how code table b differs from a: symbols added,
+// removed, or given a different code, sorted by symbol
+func DiffCodes(a, b map[rune]string) []CodeDiff {
+	var diffs []CodeDiff
+	for char, old := range a {
+		code, ok := b[char]
+		switch {
+		case !ok:
+			diffs = append(diffs, CodeDiff{Symbol: char, Kind: CodeRemoved, Old: old})
+		case len(code) != len(old):
+			diffs = append(diffs, CodeDiff{Symbol: char, Kind: CodeLengthChanged, Old: old, New: code})
+		case code != old:
+			diffs = append(diffs, CodeDiff{Symbol: char, Kind: CodeChanged, Old: old, New: code})
+		}
+	}
+	for char, code := range b {
+		if _, ok := a[char]; !ok {
+			diffs = append(diffs, CodeDiff{Symbol: char, Kind: CodeAdded, New: code})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Symbol < diffs[j].Symbol })
+	return diffs
+}
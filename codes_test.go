@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMarshalCodesDeterministic(t *testing.T) {
+	text := "deterministic output for caching and content addressing: ünïcödé"
+	want, err := MarshalCodes(BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantContainer := encodeContainer(t, text, EncodeOptions{})
+	for i := 0; i < 20; i++ {
+		// Copying into a fresh map changes its iteration order
+		codes := make(map[rune]string)
+		for char, code := range BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text))) {
+			codes[char] = code
+		}
+		got, err := MarshalCodes(codes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("run %d: MarshalCodes differs:\n%s\nwant\n%s", i, got, want)
+		}
+		if got := encodeContainer(t, text, EncodeOptions{}); !bytes.Equal(got, wantContainer) {
+			t.Fatalf("run %d: container differs", i)
+		}
+	}
+}
+
+func TestPrefixConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes map[rune]string
+		want  [][2]rune
+	}{
+		{"empty", nil, nil},
+		{"prefix code", map[rune]string{'a': "0", 'b': "10", 'c': "11"}, nil},
+		{"one prefix", map[rune]string{'a': "0", 'b': "01", 'c': "1"}, [][2]rune{{'a', 'b'}}},
+		{"equal codes", map[rune]string{'a': "10", 'b': "10", 'c': "0"}, [][2]rune{{'a', 'b'}}},
+		{"chain", map[rune]string{'a': "1", 'b': "10", 'c': "101", 'd': "0"}, [][2]rune{{'a', 'b'}, {'a', 'c'}, {'b', 'c'}}},
+		{"siblings", map[rune]string{'a': "0", 'b': "00", 'c': "01", 'd': "1"}, [][2]rune{{'a', 'b'}, {'a', 'c'}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PrefixConflicts(tt.codes)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("PrefixConflicts = %q, want %q", got, tt.want)
+			}
+			if IsPrefixCode(tt.codes) != (len(tt.want) == 0) {
+				t.Errorf("IsPrefixCode = %v with conflicts %q", IsPrefixCode(tt.codes), tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffCodes(t *testing.T) {
+	a := BuildCodes(BuildHuffmanTree(map[rune]int{'a': 8, 'b': 4, 'c': 2, 'd': 1, 'e': 1}))
+	b := BuildCodes(BuildHuffmanTree(map[rune]int{'a': 8, 'b': 1, 'c': 4, 'd': 2, 'f': 1}))
+	// a: a 0, b 10, c 110, d 1110, e 1111
+	// b: a 0, c 10, d 110, b 1110, f 1111
+	want := []CodeDiff{
+		{Symbol: 'b', Kind: CodeLengthChanged, Old: "10", New: "1110"},
+		{Symbol: 'c', Kind: CodeLengthChanged, Old: "110", New: "10"},
+		{Symbol: 'd', Kind: CodeLengthChanged, Old: "1110", New: "110"},
+		{Symbol: 'e', Kind: CodeRemoved, Old: "1111"},
+		{Symbol: 'f', Kind: CodeAdded, New: "1111"},
+	}
+	if got := DiffCodes(a, b); !slices.Equal(got, want) {
+		t.Errorf("DiffCodes =\n%+v\nwant\n%+v", got, want)
+	}
+	if got := DiffCodes(a, a); len(got) != 0 {
+		t.Errorf("DiffCodes of a table with itself = %+v", got)
+	}
+
+	swapped := map[rune]string{'x': "0", 'y': "1"}
+	if got, want := DiffCodes(swapped, map[rune]string{'x': "1", 'y': "0"}), []CodeDiff{
+		{Symbol: 'x', Kind: CodeChanged, Old: "0", New: "1"},
+		{Symbol: 'y', Kind: CodeChanged, Old: "1", New: "0"},
+	}; !slices.Equal(got, want) {
+		t.Errorf("swapped codes: %+v, want %+v", got, want)
+	}
+	if got := DiffCodes(nil, swapped); len(got) != 2 || got[0].Kind != CodeAdded || got[1].Kind != CodeAdded {
+		t.Errorf("from an empty table: %+v", got)
+	}
+}
+
+// cachedTree reports whether EncodeWithTree has cached codes for root
+func cachedTree(root *HuffmanNode) bool {
+	treeCodesMu.Lock()
+	defer treeCodesMu.Unlock()
+	_, ok := treeCodes[root]
+	return ok
+}
+
+func TestEncodeWithTree(t *testing.T) {
+	root := BuildHuffmanTree(BuildFrequencyTable(benchmarkText(4 << 10)))
+	codes := BuildCodes(root)
+	for _, text := range []string{"", "the", "one message", "and another that is longer than the others"} {
+		got, err := EncodeWithTree(text, root)
+		if err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+		if want := Encode(text, codes); got != want {
+			t.Errorf("%q: EncodeWithTree = %q, want %q", text, got, want)
+		}
+	}
+	if !cachedTree(root) {
+		t.Error("codes of the tree are not cached")
+	}
+	if _, err := EncodeWithTree("unknown symbol é", root); err == nil {
+		t.Error("no error for a symbol absent from the tree")
+	}
+
+	// A released tree's nodes may come back as another tree, which must
+	// not be coded with the old codes
+	ReleaseTree(root)
+	if cachedTree(root) {
+		t.Error("ReleaseTree left the cached codes")
+	}
+	text := "zzzzzzzzzy"
+	other := BuildHuffmanTree(BuildFrequencyTable(text))
+	got, err := EncodeWithTree(text, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := Encode(text, BuildCodes(other)); got != want {
+		t.Errorf("tree built from released nodes: EncodeWithTree = %q, want %q", got, want)
+	}
+
+	// The cache stays bounded
+	for i := 0; i < 2*maxCachedTrees; i++ {
+		EncodeWithTree("ab", BuildHuffmanTree(map[rune]int{'a': i + 1, 'b': 1}))
+	}
+	treeCodesMu.Lock()
+	size := len(treeCodes)
+	treeCodesMu.Unlock()
+	if size > maxCachedTrees {
+		t.Errorf("%d cached trees, limit %d", size, maxCachedTrees)
+	}
+}
+
+func TestComputeCodes(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			codes, root, err := ComputeCodes(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(codes, BuildCodes(root)) {
+				t.Error("codes differ from those of the returned tree")
+			}
+			if len(codes) != len(BuildFrequencyTable(tt.text)) {
+				t.Errorf("%d codes for %d symbols", len(codes), len(BuildFrequencyTable(tt.text)))
+			}
+			if conflicts := PrefixConflicts(codes); len(conflicts) > 0 {
+				t.Errorf("prefix conflicts %v", conflicts)
+			}
+			if got := Decode(Encode(tt.text, codes), root); got != tt.text {
+				t.Errorf("round trip = %q", got)
+			}
+		})
+	}
+
+	codes, root, err := ComputeCodes("")
+	if err != nil || len(codes) != 0 || root != nil {
+		t.Errorf("ComputeCodes of empty text = %v, %v, %v; want an empty table and a nil tree", codes, root, err)
+	}
+}
+
+// edgeCodePoints are runes with no UTF-8 form, which a hand-built tree may
+// still hold: both ends of the surrogate range, the first value above
+// utf8.MaxRune, the capped tree escape and a negative rune
+var edgeCodePoints = []rune{0xd800, 0xdfff, 0x110000, escapeSymbol, -1}
+
+func TestEdgeCodePointsRoundTrip(t *testing.T) {
+	// A complete prefix code: 0, 10, 110, ... and a last code of all ones
+	codes := map[rune]string{'a': "0"}
+	for i, char := range edgeCodePoints {
+		codes[char] = strings.Repeat("1", i+1) + "0"
+	}
+	codes[edgeCodePoints[len(edgeCodePoints)-1]] = strings.Repeat("1", len(edgeCodePoints))
+
+	data, err := MarshalCodes(codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalCodes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(got, codes) {
+		t.Errorf("JSON round trip = %v, want %v", got, codes)
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		char := rune(e["rune"].(float64))
+		if _, labelled := e["symbol"]; labelled != (char == 'a') {
+			t.Errorf("rune %#x: symbol label present = %v", char, labelled)
+		}
+	}
+
+	root, err := TreeFromCodes(codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := ReadTree(bytes.NewReader(AppendTree(nil, root)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := BuildCodes(tree); !maps.Equal(got, codes) {
+		t.Errorf("serialized tree round trip = %v, want %v", got, codes)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// maxEmptyRows bounds the row count of a table with no columns, which
+// takes no payload, so a corrupt count cannot force a huge allocation
+const maxEmptyRows = 1 << 20
+
+// EncodeColumns Huffman-codes a table, such as parsed CSV records, with a
+// separate tree per column. Each distinct value of a column is one symbol,
+// so columns of repeated values code in a few bits per row. Rows may be
+// ragged: a row without a field for some column gets a missing-field
+// sentinel there, and decodes to the same shorter row. A table whose rows
+// are all empty codes as its row count and zero columns.
+//
+// The layout is the row and column counts as uvarints, then for each
+// column the count of its distinct values and each value as a uvarint
+// length and its bytes, in sorted order; the tree over value indexes,
+// where the index one past the last value is the sentinel (AppendTree);
+// and the payload bit count as a uvarint followed by the packed bits.
+func EncodeColumns(rows [][]string) ([]byte, error) {
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 && len(rows) > maxEmptyRows {
+		return nil, fmt.Errorf("%d empty rows exceed the limit of %d", len(rows), maxEmptyRows)
+	}
+	data := binary.AppendUvarint(nil, uint64(len(rows)))
+	data = binary.AppendUvarint(data, uint64(columns))
+
+	for col := 0; col < columns; col++ {
+		counts := make(map[string]int)
+		missing := 0
+		for _, row := range rows {
+			if col < len(row) {
+				counts[row[col]]++
+			} else {
+				missing++
+			}
+		}
+		values := make([]string, 0, len(counts))
+		for value := range counts {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+
+		ids := make(map[string]rune, len(values))
+		frequency := make(map[rune]int, len(values)+1)
+		for id, value := range values {
+			ids[value] = rune(id)
+			frequency[rune(id)] = counts[value]
+		}
+		sentinel := rune(len(values))
+		frequency[sentinel] = missing
+		root := BuildHuffmanTree(frequency)
+		codes := BuildCodes(root)
+
+		var encoded []byte
+		for _, row := range rows {
+			id := sentinel
+			if col < len(row) {
+				id = ids[row[col]]
+			}
+			encoded = append(encoded, codes[id]...)
+		}
+		payload, bitCount := PackBits(string(encoded))
+
+		data = binary.AppendUvarint(data, uint64(len(values)))
+		for _, value := range values {
+			data = binary.AppendUvarint(data, uint64(len(value)))
+			data = append(data, value...)
+		}
+		data = AppendTree(data, root)
+		data = binary.AppendUvarint(data, uint64(bitCount))
+		data = append(data, payload...)
+	}
+	return data, nil
+}
+
+// DecodeColumns decodes data produced by EncodeColumns back into rows
+func DecodeColumns(data []byte) ([][]string, error) {
+	r := bytes.NewReader(data)
+	rowCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	columns, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	// Every row codes as at least one bit per column and every column
+	// takes at least three bytes, which bounds corrupt counts
+	if columns == 0 {
+		if rowCount > maxEmptyRows {
+			return nil, fmt.Errorf("%d empty rows exceed the limit of %d", rowCount, maxEmptyRows)
+		}
+	} else if rowCount == 0 || rowCount > uint64(r.Len())*8 || columns > uint64(r.Len()) {
+		return nil, fmt.Errorf("%d rows of %d columns exceed the remaining %d bytes", rowCount, columns, r.Len())
+	}
+
+	rows := make([][]string, rowCount)
+	for col := uint64(0); col < columns; col++ {
+		values, root, payload, bitCount, err := readColumn(r)
+		if err != nil {
+			return nil, fmt.Errorf("column %d: %w", col, err)
+		}
+		row := 0
+		err = decodeSymbols(payload, bitCount, root, func(id rune) error {
+			if row == len(rows) {
+				return errors.New("more values than rows")
+			}
+			switch {
+			case int(id) == len(values):
+				// A missing field
+			case int(id) > len(values):
+				return fmt.Errorf("invalid value index %d", id)
+			case len(rows[row]) != int(col):
+				return fmt.Errorf("row %d has a field after a missing one", row)
+			default:
+				rows[row] = append(rows[row], values[id])
+			}
+			row++
+			return nil
+		})
+		if err == nil && row != len(rows) {
+			err = fmt.Errorf("%d values for %d rows", row, len(rows))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("column %d: %w", col, err)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("unexpected data after the last column")
+	}
+	return rows, nil
+}
+
+// readColumn reads the values, tree and payload of one EncodeColumns column
+func readColumn(r *bytes.Reader) ([]string, *HuffmanNode, []byte, int, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, nil, nil, 0, unexpectedEOF(err)
+	}
+	if count > uint64(r.Len()) {
+		return nil, nil, nil, 0, fmt.Errorf("value count %d exceeds the remaining %d bytes", count, r.Len())
+	}
+	values := make([]string, count)
+	for i := range values {
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, nil, nil, 0, unexpectedEOF(err)
+		}
+		if length > uint64(r.Len()) {
+			return nil, nil, nil, 0, io.ErrUnexpectedEOF
+		}
+		value := make([]byte, length)
+		r.Read(value)
+		values[i] = string(value)
+	}
+	root, err := ReadTree(r)
+	if err != nil {
+		return nil, nil, nil, 0, fmt.Errorf("reading tree: %w", err)
+	}
+	bitCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, nil, nil, 0, unexpectedEOF(err)
+	}
+	if (bitCount+7)/8 > uint64(r.Len()) {
+		return nil, nil, nil, 0, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, (bitCount+7)/8)
+	r.Read(payload)
+	return values, root, payload, int(bitCount), nil
+}
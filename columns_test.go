@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// equalRows reports whether two tables hold the same fields, treating nil
+// and empty rows alike
+func equalRows(a, b [][]string) bool {
+	return slices.EqualFunc(a, b, func(x, y []string) bool { return slices.Equal(x, y) })
+}
+
+func TestColumnsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]string
+	}{
+		{"no rows", nil},
+		{"one field", [][]string{{"only"}}},
+		{"repeated values", [][]string{
+			{"2024-01-01", "GET", "200"},
+			{"2024-01-01", "GET", "404"},
+			{"2024-01-02", "POST", "200"},
+			{"2024-01-02", "GET", "200"},
+		}},
+		{"ragged", [][]string{{"a", "b", "c"}, {"a"}, {}, {"a", "b"}}},
+		{"empty fields", [][]string{{"", ""}, {"", "x"}}},
+		{"all rows empty", [][]string{{}, {}, {}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeColumns(tt.rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeColumns(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalRows(got, tt.rows) {
+				t.Errorf("DecodeColumns = %q, want %q", got, tt.rows)
+			}
+		})
+	}
+}
+
+func TestDecodeColumnsInvalid(t *testing.T) {
+	valid, err := EncodeColumns([][]string{{"a", "b"}, {"a", "c"}, {strings.Repeat("d", 10)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)-1]},
+		{"trailing data", append(valid[:len(valid):len(valid)], 0)},
+		{"columns without rows", []byte{0, 1}},
+		{"huge row count", []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 1}},
+		{"huge empty row count", []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0}},
+	}
+	for _, tt := range tests {
+		if _, err := DecodeColumns(tt.data); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
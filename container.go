@@ -0,0 +1,839 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// A .huff container holds one Huffman-coded text. Its layout is:
+//
+//	magic     "HUFF"
+//	version   1 byte, one of SupportedVersions
+//	length    uvarint, length of the header body
+//	body:
+//	  flags     a combination of the Flag constants: one byte in version
+//	            1, a uvarint from version 2
+//	  size      uvarint, original size in bytes
+//	  symbols   uvarint, number of encoded symbols (runes, or bytes with
+//	            FlagBytes)
+//	  checksum  uint32 big-endian, CRC-32 (IEEE) of the original text
+//	  sha256    with FlagSHA256, the 32-byte SHA-256 of the original text
+//	  tree      serialized with AppendTree, or with FlagCanonical the code
+//	            lengths serialized with AppendCodeLengths, or with
+//	            AppendOrderedCodeLengths if FlagFreqOrder is also set;
+//	            absent with FlagStatic or FlagStored
+//	  bits      uvarint, payload bit count
+//	hcrc      uint32 big-endian, CRC-32 of every header byte above
+//	payload   packed bits, padded to a whole byte, most significant bit
+//	          first unless FlagLSBFirst is set
+//
+// Writers use the oldest version that can hold the flags, so containers
+// stay readable by version 1 readers for as long as the flags fit in a
+// byte.
+//
+// The body is parsed as it is read, but the header checksum is always
+// checked before a parse error is returned, so a corrupt header is reported
+// as such rather than as whatever parse error it causes.
+const (
+	huffMagic = "HUFF"
+
+	// FormatVersion is the newest container version this package reads
+	// and writes
+	FormatVersion = 2
+
+	// maxHeaderBody bounds the header body so a corrupt length cannot force
+	// a huge allocation; it comfortably fits a tree over every rune
+	maxHeaderBody = 16 << 20
+)
+
+// Header flags
+const (
+	// FlagLeftOne marks codes that assign '1' to left branches and '0' to
+	// right branches, the opposite of GenerateHuffmanCodes
+	FlagLeftOne = 1 << iota
+	// FlagCanonical marks a header that stores canonical code lengths
+	// instead of the tree, which is much smaller for large alphabets
+	FlagCanonical
+	// FlagStatic marks a file coded with the built-in StaticTree, which is
+	// not stored
+	FlagStatic
+	// FlagBytes marks a payload coded one byte at a time rather than one
+	// rune at a time, so input need not be valid UTF-8. Tree leaves hold
+	// byte values.
+	FlagBytes
+	// FlagFooter marks a container written in a single pass, whose sizes,
+	// checksum and bit count are zero in the header and carried instead by
+	// a footer after the payload; see NewFooterWriter
+	FlagFooter
+	// FlagLSBFirst marks a payload packed least significant bit first
+	// within each byte, as some other tools do; without it bits are packed
+	// most significant first. It is recorded per container, so blocks of
+	// one archive may differ.
+	FlagLSBFirst
+	// FlagRLE marks a payload whose runs were collapsed into run-length
+	// symbols before coding; see rleSymbols. The sizes and checksum in the
+	// header describe the text after the runs are expanded again.
+	FlagRLE
+	// FlagStored marks a container that holds its input uncompressed,
+	// because coding it did not pay off; see EncodeOptions.MinRatio. It is
+	// always combined with FlagBytes, and the payload is decoded with
+	// StoredTree, which maps every byte to itself.
+	FlagStored
+	// FlagSHA256 marks a header that also holds a SHA-256 of the original
+	// text, for callers wanting a cryptographic check rather than CRC-32;
+	// see HuffHeader.VerifySHA256. Readers only check it on request.
+	FlagSHA256
+	// FlagFreqOrder marks a FlagCanonical header whose code lengths list
+	// the symbols in code order, most frequent first, rather than by code
+	// point; see AppendOrderedCodeLengths
+	FlagFreqOrder
+)
+
+var (
+	// ErrNotHuff is returned when input does not start with a .huff header
+	ErrNotHuff = errors.New("not a .huff file")
+	// ErrInvalidHeader is returned when a .huff header with a valid
+	// checksum cannot be parsed, or has an unsupported version
+	ErrInvalidHeader = errors.New("invalid .huff header")
+	// ErrUnsupportedVersion is returned, wrapped with ErrInvalidHeader, for
+	// a container version outside SupportedVersions, such as one written
+	// by a newer release
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	// ErrHeaderChecksum is returned when the header does not match its checksum
+	ErrHeaderChecksum = errors.New("header checksum mismatch")
+	// ErrPayloadChecksum is returned when decoded text does not match the
+	// checksum of the original
+	ErrPayloadChecksum = errors.New("payload checksum mismatch")
+)
+
+// HuffHeader describes a .huff container without its payload
+type HuffHeader struct {
+	Version      byte
+	Flags        uint32
+	OriginalSize uint64
+	SymbolCount  uint64
+	Checksum     uint32
+	SHA256       []byte // with FlagSHA256, the SHA-256 of the original text
+	Tree         *HuffmanNode
+	BitCount     uint64
+}
+
+// SupportedVersions returns the container versions this package can read,
+// oldest first
+func SupportedVersions() []byte {
+	return []byte{1, 2}
+}
+
+// versionFor returns the oldest container version that can hold flags.
+// Version 1 stores the flags in a single byte.
+func versionFor(flags uint32) byte {
+	if flags > math.MaxUint8 {
+		return 2
+	}
+	return 1
+}
+
+// PayloadSize returns the size in bytes of the packed payload
+func (h *HuffHeader) PayloadSize() uint64 {
+	return (h.BitCount + 7) / 8
+}
+
+// Size returns the size in bytes of the serialized header
+func (h *HuffHeader) Size() int {
+	return len(h.appendTo(nil))
+}
+
+// DistinctSymbols returns the number of distinct symbols in the tree
+func (h *HuffHeader) DistinctSymbols() int {
+	return len(CodeLengths(h.Tree))
+}
+
+// DecodingTree returns the tree to decode the payload with, accounting for
+// the bit convention recorded in the flags
+func (h *HuffHeader) DecodingTree() *HuffmanNode {
+	if h.Flags&FlagLeftOne != 0 {
+		return MirrorTree(h.Tree)
+	}
+	return h.Tree
+}
+
+// EncodeOptions controls how WriteHuffFileWithOptions builds a container
+type EncodeOptions struct {
+	// LeftOne assigns '1' to left branches and '0' to right branches, for
+	// interop with tools using that convention
+	LeftOne bool
+	// Compact stores canonical code lengths instead of the tree
+	Compact bool
+	// FrequencyOrder stores the code lengths with the most frequent
+	// symbols first, setting FlagFreqOrder, for decoders that reuse one
+	// table across many messages. It implies Compact.
+	FrequencyOrder bool
+	// Fast skips the frequency scan and codes ASCII text with the static
+	// English table; it fails with ErrNotStatic on other input
+	Fast bool
+	// Bytes codes the input one byte at a time. It is implied for input
+	// that is not valid UTF-8.
+	Bytes bool
+	// Transform, if set, maps each rune before it is counted and coded;
+	// runes for which it returns false are dropped. This is opt-in and
+	// lossy: the container holds, and decodes to, the transformed text.
+	// It cannot be combined with byte mode, whether requested or implied.
+	Transform func(rune) (rune, bool)
+	// LSBFirst packs payload bits least significant bit first within each
+	// byte, setting FlagLSBFirst
+	LSBFirst bool
+	// MinCodeLength, if positive, lengthens shorter codes to this many
+	// bits; see BuildHuffmanTreeMinLength. It is ignored with Fast.
+	MinCodeLength int
+	// RLE collapses runs of repeated symbols before coding, setting
+	// FlagRLE. It helps inputs with long runs and cannot be combined with
+	// Fast.
+	RLE bool
+	// Frequency, if set, is a precomputed frequency table, such as a
+	// shared dictionary, to build the tree from instead of scanning the
+	// input. Encoding fails if the input has a symbol the table lacks or
+	// counts as zero. It cannot be combined with Fast or RLE.
+	Frequency map[rune]int
+	// Alphabet, if set, is the fixed symbol set of a protocol: the tree is
+	// built over exactly these symbols, weighted equally, so every input
+	// gets the same code table whichever symbols it happens to use.
+	// Encoding fails if the input has a symbol outside it. It cannot be
+	// combined with Frequency, Fast or RLE.
+	Alphabet []rune
+	// SHA256 also stores a SHA-256 of the input in the header, setting
+	// FlagSHA256
+	SHA256 bool
+	// MinRatio, if positive, is the smallest ratio of input size to
+	// container size worth keeping. Input that would compress less is
+	// stored uncompressed with FlagStored instead. The ratio is estimated
+	// from the code lengths before the payload is encoded.
+	MinRatio float64
+}
+
+// WriteHuffFile compresses text and writes it to w as a .huff container
+func WriteHuffFile(w io.Writer, text string) error {
+	return WriteHuffFileWithOptions(w, text, EncodeOptions{})
+}
+
+// WriteHuffFileWithOptions compresses text and writes it to w as a .huff
+// container built according to opts
+func WriteHuffFileWithOptions(w io.Writer, text string, opts EncodeOptions) error {
+	start := startOp()
+	header, payload, err := BuildHuffFile(text, opts)
+	if err != nil {
+		return err
+	}
+	headerBytes := header.appendTo(nil)
+	if _, err := w.Write(headerBytes); err != nil {
+		return err
+	}
+	if _, err = w.Write(payload); err != nil {
+		return err
+	}
+	reportOp("encode", start, len(text), len(headerBytes)+len(payload), int(header.SymbolCount))
+	return nil
+}
+
+// BuildHuffFile compresses text, returning the container header and the
+// packed payload without writing them. With opts.Transform the header
+// describes the transformed text.
+func BuildHuffFile(text string, opts EncodeOptions) (*HuffHeader, []byte, error) {
+	byteMode := opts.Bytes || !utf8.ValidString(text)
+	if opts.Transform != nil {
+		if byteMode {
+			return nil, nil, errors.New("a transform cannot be applied in byte mode")
+		}
+		text = ApplyTransform(text, opts.Transform)
+	}
+	header, payload, err := buildHuffFile(text, opts, byteMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.SHA256 {
+		sum := sha256.Sum256([]byte(text))
+		header.Flags |= FlagSHA256
+		header.Version = versionFor(header.Flags)
+		header.SHA256 = sum[:]
+	}
+	return header, payload, nil
+}
+
+// buildHuffFile does the work of BuildHuffFile on text after any transform
+func buildHuffFile(text string, opts EncodeOptions, byteMode bool) (*HuffHeader, []byte, error) {
+	var root *HuffmanNode
+	var flags uint32
+	if byteMode {
+		flags |= FlagBytes
+	}
+	var symbols []rune
+	frequency := opts.Frequency
+	if opts.Alphabet != nil {
+		if frequency != nil {
+			return nil, nil, errors.New("an alphabet cannot be combined with a supplied frequency table")
+		}
+		frequency = make(map[rune]int, len(opts.Alphabet))
+		for _, char := range opts.Alphabet {
+			frequency[char] = 1
+		}
+	}
+	supplied := frequency != nil
+	if supplied && (opts.Fast || opts.RLE) {
+		return nil, nil, errors.New("a supplied frequency table cannot be combined with the static table or run-length coding")
+	}
+	if opts.RLE {
+		if opts.Fast {
+			return nil, nil, errors.New("run-length coding cannot be combined with the static table")
+		}
+		flags |= FlagRLE
+		symbols = rleSymbols(text, byteMode)
+	}
+	if opts.Fast {
+		root, _ = StaticTree()
+		flags |= FlagStatic
+	} else {
+		if supplied {
+			// Supplied by the caller
+		} else if opts.RLE {
+			frequency = make(map[rune]int)
+			for _, sym := range symbols {
+				frequency[sym]++
+			}
+		} else if byteMode {
+			frequency = byteFrequencyTable(text)
+		} else {
+			frequency = BuildFrequencyTable(text)
+		}
+		if opts.MinCodeLength > 0 {
+			var err error
+			if root, err = BuildHuffmanTreeMinLength(frequency, opts.MinCodeLength); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			root = BuildHuffmanTree(frequency)
+		}
+	}
+	if (opts.Compact || opts.FrequencyOrder) && !opts.Fast {
+		lengths := CodeLengths(root)
+		for _, length := range lengths {
+			if length > maxCompactLength {
+				return nil, nil, fmt.Errorf("code length %d is too long for a compact header", length)
+			}
+		}
+		var err error
+		if opts.FrequencyOrder {
+			root, err = FrequencyOrderedTree(lengths, frequency)
+			flags |= FlagFreqOrder
+		} else {
+			root, err = CanonicalTree(lengths)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		flags |= FlagCanonical
+	}
+	codeTree := root
+	if opts.LeftOne {
+		flags |= FlagLeftOne
+		codeTree = MirrorTree(root)
+	}
+	var codes map[rune]string
+	if opts.Fast && !opts.LeftOne {
+		_, codes = StaticTree()
+	} else {
+		codes = BuildCodes(codeTree)
+	}
+	if opts.MinRatio > 0 && !opts.Fast && !supplied {
+		bits := 0
+		lengths := CodeLengths(root)
+		for char, count := range frequency {
+			bits += count * lengths[char]
+		}
+		estimate := &HuffHeader{Version: versionFor(flags), Flags: flags, OriginalSize: uint64(len(text)), SymbolCount: symbolCount(text, flags), Tree: root, BitCount: uint64(bits)}
+		if !beatsRatio(len(text), estimate.Size()+int(estimate.PayloadSize()), opts.MinRatio) {
+			header, payload := storedHuffFile(text)
+			return header, payload, nil
+		}
+	}
+	var encoded string
+	var err error
+	if opts.RLE {
+		encoded, err = encodeSymbolsChecked(symbols, codes)
+	} else if byteMode {
+		encoded, err = encodeBytesChecked(text, codes)
+	} else {
+		encoded, err = encodeChecked(text, codes)
+	}
+	if err != nil {
+		if opts.Fast {
+			return nil, nil, ErrNotStatic
+		}
+		return nil, nil, err
+	}
+	payload, bitCount := PackBits(encoded)
+	if opts.MinRatio > 0 && (opts.Fast || supplied) {
+		// A static or supplied table says nothing of this input's
+		// frequencies, so only the encoded size can tell
+		estimate := &HuffHeader{Version: versionFor(flags), Flags: flags, OriginalSize: uint64(len(text)), SymbolCount: symbolCount(text, flags), BitCount: uint64(bitCount)}
+		if !beatsRatio(len(text), estimate.Size()+len(payload), opts.MinRatio) {
+			header, payload := storedHuffFile(text)
+			return header, payload, nil
+		}
+	}
+	if opts.LSBFirst {
+		flags |= FlagLSBFirst
+		reverseBitOrder(payload)
+	}
+
+	header := &HuffHeader{
+		Version:      versionFor(flags),
+		Flags:        flags,
+		OriginalSize: uint64(len(text)),
+		SymbolCount:  symbolCount(text, flags),
+		Checksum:     crc32.ChecksumIEEE([]byte(text)),
+		Tree:         root,
+		BitCount:     uint64(bitCount),
+	}
+	return header, payload, nil
+}
+
+// beatsRatio reports whether coding size bytes into compressed bytes
+// reaches minRatio. Empty input always does.
+func beatsRatio(size, compressed int, minRatio float64) bool {
+	return size == 0 || float64(size) >= minRatio*float64(compressed)
+}
+
+// storedHuffFile returns the header and payload of a FlagStored container
+// holding text uncompressed
+func storedHuffFile(text string) (*HuffHeader, []byte) {
+	header := &HuffHeader{
+		Version:      versionFor(FlagStored | FlagBytes),
+		Flags:        FlagStored | FlagBytes,
+		OriginalSize: uint64(len(text)),
+		SymbolCount:  uint64(len(text)),
+		Checksum:     crc32.ChecksumIEEE([]byte(text)),
+		Tree:         StoredTree(),
+		BitCount:     uint64(len(text)) * 8,
+	}
+	return header, []byte(text)
+}
+
+// appendTo appends the serialized header to dst
+func (h *HuffHeader) appendTo(dst []byte) []byte {
+	var body []byte
+	if h.Version == 1 {
+		body = append(body, byte(h.Flags))
+	} else {
+		body = binary.AppendUvarint(body, uint64(h.Flags))
+	}
+	body = binary.AppendUvarint(body, h.OriginalSize)
+	body = binary.AppendUvarint(body, h.SymbolCount)
+	body = binary.BigEndian.AppendUint32(body, h.Checksum)
+	if h.Flags&FlagSHA256 != 0 {
+		body = append(body, h.SHA256...)
+	}
+	switch {
+	case h.Flags&(FlagStatic|FlagStored) != 0:
+		// The static and stored trees are built in, not stored
+	case h.Flags&FlagCanonical != 0 && h.Flags&FlagFreqOrder != 0:
+		body = AppendOrderedCodeLengths(body, h.Tree)
+	case h.Flags&FlagCanonical != 0:
+		body = AppendCodeLengths(body, CodeLengths(h.Tree))
+	default:
+		body = AppendTree(body, h.Tree)
+	}
+	body = binary.AppendUvarint(body, h.BitCount)
+
+	start := len(dst)
+	dst = append(dst, huffMagic...)
+	dst = append(dst, h.Version)
+	dst = binary.AppendUvarint(dst, uint64(len(body)))
+	dst = append(dst, body...)
+	return binary.BigEndian.AppendUint32(dst, crc32.ChecksumIEEE(dst[start:]))
+}
+
+// ReadHuffHeader reads and checksums the header of a .huff container
+// without reading its payload. This is a cheap first-line integrity check:
+// a corrupt header fails with ErrHeaderChecksum.
+func ReadHuffHeader(r io.Reader) (*HuffHeader, error) {
+	return readHuffHeader(bufio.NewReader(r))
+}
+
+func readHuffHeader(br *bufio.Reader) (*HuffHeader, error) {
+	raw := make([]byte, len(huffMagic)+1, 16)
+	if _, err := io.ReadFull(br, raw); err != nil || string(raw[:len(huffMagic)]) != huffMagic {
+		return nil, ErrNotHuff
+	}
+	h := &HuffHeader{Version: raw[len(huffMagic)]}
+	if !slices.Contains(SupportedVersions(), h.Version) {
+		return nil, fmt.Errorf("%w: %w %d", ErrInvalidHeader, ErrUnsupportedVersion, h.Version)
+	}
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if length > maxHeaderBody {
+		return nil, ErrHeaderChecksum
+	}
+	raw = binary.AppendUvarint(raw, length)
+
+	// Parse the body as it streams in, checksumming it on the way. If
+	// parsing fails, the rest of the body is still read so that corruption
+	// is reported as a checksum mismatch rather than as the parse error.
+	body := &headerBodyReader{br: br, remaining: int64(length), crc: crc32.ChecksumIEEE(raw)}
+	parseErr := h.parseBody(body)
+	if parseErr == nil && body.remaining != 0 {
+		parseErr = fmt.Errorf("%d unexpected bytes at end of header", body.remaining)
+	}
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return nil, err
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(br, sum[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if body.crc != binary.BigEndian.Uint32(sum[:]) {
+		return nil, ErrHeaderChecksum
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHeader, parseErr)
+	}
+	return h, nil
+}
+
+// headerBodyReader reads at most remaining bytes of a header body from br,
+// updating the running header checksum
+type headerBodyReader struct {
+	br        *bufio.Reader
+	remaining int64
+	crc       uint32
+}
+
+func (r *headerBodyReader) ReadByte() (byte, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	b, err := r.br.ReadByte()
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	r.remaining--
+	r.crc = crc32.Update(r.crc, crc32.IEEETable, []byte{b})
+	return b, nil
+}
+
+func (r *headerBodyReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.br.Read(p)
+	r.remaining -= int64(n)
+	r.crc = crc32.Update(r.crc, crc32.IEEETable, p[:n])
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// parseBody fills in the header fields from the header body. Lengths and
+// trees are read straight from the stream, so big alphabets never need the
+// whole body in memory at once; the canonical tree is built as soon as the
+// last code length arrives.
+func (h *HuffHeader) parseBody(body *headerBodyReader) error {
+	var flags uint64
+	var err error
+	if h.Version == 1 {
+		var b byte
+		b, err = body.ReadByte()
+		flags = uint64(b)
+	} else {
+		flags, err = binary.ReadUvarint(body)
+	}
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if flags > math.MaxUint32 {
+		return fmt.Errorf("invalid flags %#x", flags)
+	}
+	h.Flags = uint32(flags)
+	if h.OriginalSize, err = binary.ReadUvarint(body); err != nil {
+		return unexpectedEOF(err)
+	}
+	if h.SymbolCount, err = binary.ReadUvarint(body); err != nil {
+		return unexpectedEOF(err)
+	}
+	var sum [4]byte
+	if _, err = io.ReadFull(body, sum[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	h.Checksum = binary.BigEndian.Uint32(sum[:])
+	if h.Flags&FlagSHA256 != 0 {
+		h.SHA256 = make([]byte, sha256.Size)
+		if _, err = io.ReadFull(body, h.SHA256); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	if h.Flags&FlagStored != 0 {
+		if h.Flags&FlagBytes == 0 {
+			return errors.New("stored container without FlagBytes")
+		}
+		h.Tree = StoredTree()
+	} else if h.Flags&FlagStatic != 0 {
+		h.Tree, _ = StaticTree()
+	} else if h.Flags&FlagCanonical != 0 && h.Flags&FlagFreqOrder != 0 {
+		if h.Tree, err = ReadOrderedCodeLengths(body); err != nil {
+			return fmt.Errorf("reading code lengths: %w", err)
+		}
+	} else if h.Flags&FlagCanonical != 0 {
+		lengths, err := ReadCodeLengths(body)
+		if err != nil {
+			return fmt.Errorf("reading code lengths: %w", err)
+		}
+		if h.Tree, err = CanonicalTree(lengths); err != nil {
+			return err
+		}
+	} else if h.Tree, err = ReadTree(body); err != nil {
+		return fmt.Errorf("reading tree: %w", err)
+	}
+	if h.Flags&FlagBytes != 0 {
+		for char := range CodeLengths(h.Tree) {
+			if _, run := runRepeats(char); run && h.Flags&FlagRLE != 0 {
+				continue
+			}
+			if char > 0xff {
+				return fmt.Errorf("symbol %q out of range for a byte-coded payload", char)
+			}
+		}
+	}
+	if h.BitCount, err = binary.ReadUvarint(body); err != nil {
+		return unexpectedEOF(err)
+	}
+	return nil
+}
+
+// ReadHuffFile reads a .huff container and returns its decoding tree and
+// decoded text, verifying the stored checksum
+func ReadHuffFile(r io.Reader) (*HuffmanNode, string, error) {
+	start := startOp()
+	br := bufio.NewReader(r)
+	h, err := readHuffHeader(br)
+	if err != nil {
+		return nil, "", err
+	}
+	tree := h.DecodingTree()
+	if h.Flags&FlagFooter != 0 {
+		text, err := io.ReadAll(newContainerDecoder(br, h))
+		if err != nil {
+			return nil, "", err
+		}
+		return tree, string(text), nil
+	}
+
+	// Large payloads decode faster by table: byte at a time for small
+	// alphabets, two-level for large ones. Build it while the payload is
+	// still being read.
+	var decoder PayloadDecoder = tree
+	var table func() *DecodeTable
+	if h.Flags&FlagRLE != 0 {
+		decoder = rleDecoder{tree, h.Flags&FlagBytes != 0}
+	} else if h.Flags&FlagBytes != 0 {
+		decoder = byteDecoder{tree}
+	} else if h.PayloadSize() >= tableMinPayload && h.DistinctSymbols() <= tableMaxSymbols {
+		table = PrewarmDecodeTable(tree)
+	} else if h.PayloadSize() >= tableMinPayload {
+		decoder = NewTwoLevelTable(tree)
+	}
+
+	var payload bytes.Buffer
+	n, err := io.CopyN(&payload, br, int64(h.PayloadSize()))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading payload: got %d of %d bytes: %w", n, h.PayloadSize(), unexpectedEOF(err))
+	}
+	if table != nil {
+		decoder = table()
+	}
+	if h.Flags&FlagLSBFirst != 0 {
+		reverseBitOrder(payload.Bytes())
+	}
+	text, err := decoder.Decode(payload.Bytes(), int(h.BitCount))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := h.verify(text); err != nil {
+		return nil, "", err
+	}
+	if MetricsHook != nil {
+		reportOp("decode", start, h.Size()+payload.Len(), len(text), int(h.SymbolCount))
+	}
+	return tree, text, nil
+}
+
+// ReadHuffFileMapped reads a .huff container like ReadHuffFile but writes
+// each decoded symbol in substitutions as its replacement string, such as
+// the expansion of a token; other symbols are written unchanged. For
+// byte-coded containers the keys are byte values. The output then differs
+// in length and content from the original, so it is not compared against
+// the header byte for byte: the sizes and checksum are checked against the
+// symbols before substitution instead.
+func ReadHuffFileMapped(r io.Reader, substitutions map[rune]string) (string, error) {
+	br := bufio.NewReader(r)
+	h, err := readHuffHeader(br)
+	if err != nil {
+		return "", err
+	}
+	if h.Flags&FlagFooter != 0 {
+		return "", errFooterUnsupported
+	}
+	payload := make([]byte, h.PayloadSize())
+	if n, err := io.ReadFull(br, payload); err != nil {
+		return "", fmt.Errorf("reading payload: got %d of %d bytes: %w", n, h.PayloadSize(), unexpectedEOF(err))
+	}
+
+	var sb strings.Builder
+	var scratch [utf8.UTFMax]byte
+	var size, symbols uint64
+	crc := crc32.NewIEEE()
+	if h.Flags&FlagLSBFirst != 0 {
+		reverseBitOrder(payload)
+	}
+	emit := func(char rune) error {
+		var raw []byte
+		if h.Flags&FlagBytes != 0 {
+			raw = append(scratch[:0], byte(char))
+		} else {
+			raw = utf8.AppendRune(scratch[:0], char)
+		}
+		crc.Write(raw)
+		size += uint64(len(raw))
+		symbols++
+		if sub, ok := substitutions[char]; ok {
+			sb.WriteString(sub)
+		} else {
+			sb.Write(raw)
+		}
+		return nil
+	}
+	if h.Flags&FlagRLE != 0 {
+		emit = expandRuns(emit)
+	}
+	if err := decodeSymbols(payload, int(h.BitCount), h.DecodingTree(), emit); err != nil {
+		return "", err
+	}
+	if err := h.check(size, symbols, crc.Sum32()); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// ReadHuffFileAt reads a .huff container that starts offset bytes into r,
+// for containers embedded in a larger file. Bytes after the container are
+// ignored.
+func ReadHuffFileAt(r io.ReaderAt, offset int64) (*HuffmanNode, string, error) {
+	if offset < 0 {
+		return nil, "", fmt.Errorf("invalid offset %d", offset)
+	}
+	return ReadHuffFile(io.NewSectionReader(r, offset, math.MaxInt64-offset))
+}
+
+// verify checks decoded text against the sizes and checksum in the header
+func (h *HuffHeader) verify(text string) error {
+	return h.check(uint64(len(text)), symbolCount(text, h.Flags), crc32.ChecksumIEEE([]byte(text)))
+}
+
+// errNoSHA256 is returned by VerifySHA256 for a header without FlagSHA256
+var errNoSHA256 = errors.New("container has no SHA-256 of its text")
+
+// VerifySHA256 compares the SHA-256 stored in the header with sum, the
+// SHA-256 of the decoded text, failing with ErrPayloadChecksum if they
+// differ
+func (h *HuffHeader) VerifySHA256(sum []byte) error {
+	if h.Flags&FlagSHA256 == 0 {
+		return errNoSHA256
+	}
+	if !bytes.Equal(sum, h.SHA256) {
+		return fmt.Errorf("%w: SHA-256 differs", ErrPayloadChecksum)
+	}
+	return nil
+}
+
+// check compares the size, symbol count and checksum of decoded output
+// with the header
+func (h *HuffHeader) check(size, symbols uint64, crc uint32) error {
+	if size != h.OriginalSize || symbols != h.SymbolCount {
+		return fmt.Errorf("%w: decoded %d bytes, header says %d", ErrPayloadChecksum, size, h.OriginalSize)
+	}
+	if crc != h.Checksum {
+		return ErrPayloadChecksum
+	}
+	return nil
+}
+
+// symbolCount returns the number of symbols text is coded as under flags
+func symbolCount(text string, flags uint32) uint64 {
+	if flags&FlagBytes != 0 {
+		return uint64(len(text))
+	}
+	return uint64(utf8.RuneCountInString(text))
+}
+
+// byteFrequencyTable counts the bytes of text, keyed by byte value
+func byteFrequencyTable(text string) map[rune]int {
+	frequency := make(map[rune]int)
+	for i := 0; i < len(text); i++ {
+		frequency[rune(text[i])]++
+	}
+	return frequency
+}
+
+// encodeBytesChecked is encodeChecked for byte-coded payloads
+func encodeBytesChecked(text string, codes map[rune]string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		code, ok := codes[rune(text[i])]
+		if !ok {
+			return "", fmt.Errorf("byte %#02x is not in the code table", text[i])
+		}
+		sb.WriteString(code)
+	}
+	return sb.String(), nil
+}
+
+// encodeSymbolsChecked is encodeChecked for a symbol sequence such as the
+// output of rleSymbols
+func encodeSymbolsChecked(symbols []rune, codes map[rune]string) (string, error) {
+	var sb strings.Builder
+	for _, sym := range symbols {
+		code, ok := codes[sym]
+		if !ok {
+			return "", fmt.Errorf("symbol %q is not in the code table", sym)
+		}
+		sb.WriteString(code)
+	}
+	return sb.String(), nil
+}
+
+// byteDecoder decodes byte-coded payloads, emitting each leaf as one byte
+type byteDecoder struct {
+	root *HuffmanNode
+}
+
+func (d byteDecoder) Decode(data []byte, bitCount int) (string, error) {
+	out := make([]byte, 0, bitCount/8)
+	err := decodeSymbols(data, bitCount, d.root, func(char rune) error {
+		out = append(out, byte(char))
+		return nil
+	})
+	return string(out), err
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// encodeContainer returns text as a .huff container built with opts
+func encodeContainer(t *testing.T, text string, opts EncodeOptions) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteHuffFileWithOptions(&buf, text, opts); err != nil {
+		t.Fatalf("encode %+v: %v", opts, err)
+	}
+	return buf.Bytes()
+}
+
+// headerSize returns the size of the header of container data
+func headerSize(t *testing.T, data []byte) int {
+	t.Helper()
+	h, err := ReadHuffHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.Size()
+}
+
+func TestHuffFileRoundTrip(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeContainer(t, tt.text, EncodeOptions{})
+			_, text, err := ReadHuffFile(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.text {
+				t.Errorf("ReadHuffFile = %q, want %q", text, tt.text)
+			}
+		})
+	}
+}
+
+func TestHeaderCorruption(t *testing.T) {
+	text := "every header byte is covered by the header checksum"
+	data := encodeContainer(t, text, EncodeOptions{})
+	size := headerSize(t, data)
+	for i := 0; i < size; i++ {
+		corrupt := bytes.Clone(data)
+		corrupt[i] ^= 0x10
+		_, err := ReadHuffHeader(bytes.NewReader(corrupt))
+		switch {
+		case i < len(huffMagic):
+			if !errors.Is(err, ErrNotHuff) {
+				t.Errorf("byte %d of the magic: error %v, want ErrNotHuff", i, err)
+			}
+		case i == len(huffMagic):
+			if !errors.Is(err, ErrUnsupportedVersion) {
+				t.Errorf("version byte: error %v, want ErrUnsupportedVersion", err)
+			}
+		default:
+			if !errors.Is(err, ErrHeaderChecksum) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("byte %d: error %v, want ErrHeaderChecksum", i, err)
+			}
+		}
+	}
+}
+
+func TestHeaderTruncation(t *testing.T) {
+	data := encodeContainer(t, "truncated headers fail cleanly", EncodeOptions{})
+	size := headerSize(t, data)
+	for n := 0; n < size; n++ {
+		_, err := ReadHuffHeader(bytes.NewReader(data[:n]))
+		want := io.ErrUnexpectedEOF
+		if n <= len(huffMagic) {
+			want = ErrNotHuff
+		}
+		if !errors.Is(err, want) {
+			t.Errorf("%d of %d header bytes: error %v, want %v", n, size, err, want)
+		}
+	}
+}
+
+func TestPayloadCorruption(t *testing.T) {
+	text := strings.Repeat("payload corruption passes the header check ", 8)
+	data := encodeContainer(t, text, EncodeOptions{})
+	size := headerSize(t, data)
+	for i := size; i < len(data); i++ {
+		corrupt := bytes.Clone(data)
+		corrupt[i] ^= 0x01
+		if _, err := ReadHuffHeader(bytes.NewReader(corrupt)); err != nil {
+			t.Fatalf("payload byte %d: header check failed: %v", i, err)
+		}
+		_, _, err := ReadHuffFile(bytes.NewReader(corrupt))
+		var decodeErr *DecodeError
+		if !errors.Is(err, ErrPayloadChecksum) && !errors.As(err, &decodeErr) {
+			t.Errorf("payload byte %d: error %v, want ErrPayloadChecksum", i, err)
+		}
+	}
+
+	_, _, err := ReadHuffFile(bytes.NewReader(data[:len(data)-1]))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated payload: error %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestLeftOneConvention(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeContainer(t, tt.text, EncodeOptions{LeftOne: true})
+			h, err := ReadHuffHeader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Flags&FlagLeftOne == 0 {
+				t.Fatal("header lacks FlagLeftOne")
+			}
+
+			// Every code is the complement of the default convention's
+			swapped := BuildCodes(h.DecodingTree())
+			for char, code := range BuildCodes(h.Tree) {
+				want := strings.Map(func(bit rune) rune { return '0' + '1' - bit }, code)
+				if len(code) == 1 && h.Tree.left == nil {
+					want = code // a lone leaf keeps the code "0"
+				}
+				if swapped[char] != want {
+					t.Errorf("%q: swapped code %q, want %q", char, swapped[char], want)
+				}
+			}
+			if payload, _ := PackBits(Encode(tt.text, swapped)); !bytes.Equal(data[h.Size():], payload) {
+				t.Error("payload is not coded with the swapped codes")
+			}
+
+			_, text, err := ReadHuffFile(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.text {
+				t.Errorf("ReadHuffFile = %q, want %q", text, tt.text)
+			}
+		})
+	}
+}
+
+// modeName names a selfTestModes combination for a subtest
+func modeName(opts EncodeOptions) string {
+	var names []string
+	for _, option := range []struct {
+		set  bool
+		name string
+	}{
+		{opts.LeftOne, "left-one"},
+		{opts.Compact, "compact"},
+		{opts.FrequencyOrder, "freq-order"},
+		{opts.Fast, "fast"},
+		{opts.Bytes, "bytes"},
+		{opts.LSBFirst, "lsb-first"},
+		{opts.RLE, "rle"},
+		{opts.MinRatio > 0, "stored"},
+	} {
+		if option.set {
+			names = append(names, option.name)
+		}
+	}
+	if len(names) == 0 {
+		return "default"
+	}
+	return strings.Join(names, "+")
+}
+
+func TestModeMatrix(t *testing.T) {
+	cases := selfTestCases()
+	for _, opts := range selfTestModes() {
+		t.Run(modeName(opts), func(t *testing.T) {
+			for _, c := range cases {
+				t.Run(c.name, func(t *testing.T) {
+					var buf bytes.Buffer
+					err := WriteHuffFileWithOptions(&buf, c.text, opts)
+					if opts.Fast && errors.Is(err, ErrNotStatic) {
+						t.Skip("input is outside the static table")
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					encoded := buf.Bytes()
+
+					h, err := ReadHuffHeader(bytes.NewReader(encoded))
+					if err != nil {
+						t.Fatal(err)
+					}
+					// Only coding that reaches MinRatio, as long runs under
+					// RLE do, may skip the stored fallback
+					if opts.MinRatio > 0 && h.Flags&FlagStored == 0 && float64(len(c.text)) < opts.MinRatio*float64(h.PayloadSize()) {
+						t.Errorf("payload of %d bytes for %d input bytes is not stored", h.PayloadSize(), len(c.text))
+					}
+					_, text, err := ReadHuffFile(bytes.NewReader(encoded))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if text != c.text {
+						t.Errorf("ReadHuffFile returned %d bytes that differ from the %d byte input", len(text), len(c.text))
+					}
+					d, err := NewContainerDecoder(bytes.NewReader(encoded))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := compareStream([]byte(c.text), d); err != nil {
+						t.Errorf("stream decode: %v", err)
+					}
+					if err := checkTableDecoders(encoded, c.text); err != nil {
+						t.Error(err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestFormatVersions(t *testing.T) {
+	versions := SupportedVersions()
+	if !slices.IsSorted(versions) || versions[len(versions)-1] != FormatVersion {
+		t.Errorf("SupportedVersions = %v, want oldest first up to FormatVersion %d", versions, FormatVersion)
+	}
+
+	text := "older binaries wrote version 1 headers"
+	v1 := encodeContainer(t, text, EncodeOptions{})
+	h, err := ReadHuffHeader(bytes.NewReader(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same header with its flags as a version 2 uvarint
+	v2Header := *h
+	v2Header.Version = 2
+	v2 := append(v2Header.appendTo(nil), v1[h.Size():]...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		version byte
+		text    string
+	}{
+		{"v1", v1, 1, text},
+		{"v2", v2, 2, text},
+		{"v2 wide flags", encodeContainer(t, text, EncodeOptions{SHA256: true}), 2, text},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := ReadHuffHeader(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Version != tt.version {
+				t.Errorf("version %d, want %d", h.Version, tt.version)
+			}
+			_, got, err := ReadHuffFile(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.text {
+				t.Errorf("ReadHuffFile = %q, want %q", got, tt.text)
+			}
+		})
+	}
+
+	for _, version := range []byte{0, 3, 99} {
+		data := bytes.Clone(v1)
+		data[len(huffMagic)] = version
+		_, err := ReadHuffHeader(bytes.NewReader(data))
+		if !errors.Is(err, ErrUnsupportedVersion) || !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("version %d: error %v, want ErrUnsupportedVersion", version, err)
+		}
+	}
+}
+
+// withWrongSHA256 returns container data whose header stores a different
+// SHA-256, with the header checksum recomputed so only the SHA-256 differs
+func withWrongSHA256(t *testing.T, data []byte) []byte {
+	t.Helper()
+	h, err := ReadHuffHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := *h
+	forged.SHA256 = bytes.Clone(h.SHA256)
+	forged.SHA256[0] ^= 0xff
+	return append(forged.appendTo(nil), data[h.Size():]...)
+}
+
+func TestVerifySHA256(t *testing.T) {
+	text := "cryptographic integrity, not just a CRC"
+	data := encodeContainer(t, text, EncodeOptions{SHA256: true})
+	h, err := ReadHuffHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Flags&FlagSHA256 == 0 {
+		t.Fatal("header lacks FlagSHA256")
+	}
+	sum := sha256.Sum256([]byte(text))
+	if !bytes.Equal(h.SHA256, sum[:]) {
+		t.Errorf("header SHA-256 %x, want %x", h.SHA256, sum)
+	}
+
+	other := sha256.Sum256([]byte(text + "!"))
+	wrong, err := ReadHuffHeader(bytes.NewReader(withWrongSHA256(t, data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ReadHuffHeader(bytes.NewReader(encodeContainer(t, text, EncodeOptions{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		header *HuffHeader
+		sum    []byte
+		want   error
+	}{
+		{"match", h, sum[:], nil},
+		{"different text", h, other[:], ErrPayloadChecksum},
+		{"different stored sum", wrong, sum[:], ErrPayloadChecksum},
+		{"no stored sum", plain, sum[:], errNoSHA256},
+	}
+	for _, tt := range tests {
+		if err := tt.header.VerifySHA256(tt.sum); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestFrequencyOrderHeader(t *testing.T) {
+	texts := append(roundTripTexts, struct{ name, text string }{"large alphabet", largeAlphabetText(2000)})
+	for _, tt := range texts {
+		t.Run(tt.name, func(t *testing.T) {
+			compact := encodeContainer(t, tt.text, EncodeOptions{Compact: true})
+			ordered := encodeContainer(t, tt.text, EncodeOptions{FrequencyOrder: true})
+			compactHeader, err := ReadHuffHeader(bytes.NewReader(compact))
+			if err != nil {
+				t.Fatal(err)
+			}
+			orderedHeader, err := ReadHuffHeader(bytes.NewReader(ordered))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := uint32(FlagCanonical | FlagFreqOrder); orderedHeader.Flags&want != want {
+				t.Errorf("flags %#x lack FlagCanonical and FlagFreqOrder", orderedHeader.Flags)
+			}
+			if !reflect.DeepEqual(CodeLengths(orderedHeader.Tree), CodeLengths(compactHeader.Tree)) {
+				t.Error("the orderings give different code lengths")
+			}
+
+			for name, data := range map[string][]byte{"canonical": compact, "frequency order": ordered} {
+				_, text, err := ReadHuffFile(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if text != tt.text {
+					t.Errorf("%s: ReadHuffFile returned %d bytes that differ from the %d byte input", name, len(text), len(tt.text))
+				}
+				d, err := NewContainerDecoder(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if err := compareStream([]byte(tt.text), d); err != nil {
+					t.Errorf("%s: stream decode: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	// Fold case and drop digits
+	fold := func(char rune) (rune, bool) {
+		if unicode.IsDigit(char) {
+			return 0, false
+		}
+		return unicode.ToLower(char), true
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"unchanged", "hello world", "hello world"},
+		{"folded", "Hello World", "hello world"},
+		{"dropped", "r2d2 and c3po", "rd and cpo"},
+		{"all dropped", "2024", ""},
+		{"non-ASCII", "ÄÖÜ straße", "äöü straße"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ApplyTransform(tt.text, fold); got != tt.want {
+				t.Errorf("ApplyTransform(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			data := encodeContainer(t, tt.text, EncodeOptions{Transform: fold})
+			_, text, err := ReadHuffFile(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.want {
+				t.Errorf("container decodes to %q, want %q", text, tt.want)
+			}
+		})
+	}
+
+	t.Run("byte mode", func(t *testing.T) {
+		for _, tt := range []struct {
+			name string
+			text string
+			opts EncodeOptions
+		}{
+			{"requested", "valid text", EncodeOptions{Bytes: true, Transform: fold}},
+			{"invalid UTF-8", "bad \xff text", EncodeOptions{Transform: fold}},
+		} {
+			if err := WriteHuffFileWithOptions(io.Discard, tt.text, tt.opts); err == nil {
+				t.Errorf("%s: no error for a transform in byte mode", tt.name)
+			}
+		}
+	})
+}
+
+func TestDecodeErrorOffset(t *testing.T) {
+	// With a minimum length of 2, a is 00 and b is 01, so no code starts
+	// with 1 and setting the first bit of any code is detected right there
+	text := "aaaabbab"
+	data := encodeContainer(t, text, EncodeOptions{MinCodeLength: 2})
+	size := headerSize(t, data)
+	for _, bit := range []int{0, 6, 10, 14} {
+		corrupt := bytes.Clone(data)
+		corrupt[size+bit/8] |= 0x80 >> (bit % 8)
+		_, _, err := ReadHuffFile(bytes.NewReader(corrupt))
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("bit %d: error %v, want a DecodeError", bit, err)
+		}
+		if decodeErr.BitOffset != bit || decodeErr.ByteOffset != bit/8 || !errors.Is(err, errInvalidCode) {
+			t.Errorf("bit %d: error at bit %d, byte %d (%v); want bit %d, byte %d",
+				bit, decodeErr.BitOffset, decodeErr.ByteOffset, decodeErr.Err, bit, bit/8)
+		}
+	}
+}
+
+func TestReadHuffFileAt(t *testing.T) {
+	first := encodeContainer(t, "the first embedded container", EncodeOptions{})
+	second := encodeContainer(t, "and the second, ünïcödé", EncodeOptions{Compact: true})
+	prefix := []byte("a file header of some other format\n")
+	var file []byte
+	file = append(file, prefix...)
+	file = append(file, first...)
+	file = append(file, second...)
+	file = append(file, "trailing bytes"...)
+	r := bytes.NewReader(file)
+
+	tests := []struct {
+		offset int64
+		want   string
+	}{
+		{int64(len(prefix)), "the first embedded container"},
+		{int64(len(prefix) + len(first)), "and the second, ünïcödé"},
+	}
+	for _, tt := range tests {
+		_, text, err := ReadHuffFileAt(r, tt.offset)
+		if err != nil {
+			t.Fatalf("offset %d: %v", tt.offset, err)
+		}
+		if text != tt.want {
+			t.Errorf("offset %d: text %q, want %q", tt.offset, text, tt.want)
+		}
+	}
+	if _, _, err := ReadHuffFile(bytes.NewReader(file)); err == nil {
+		t.Error("ReadHuffFile accepted the file at offset 0")
+	}
+	for _, offset := range []int64{-1, 1, int64(len(file))} {
+		if _, _, err := ReadHuffFileAt(r, offset); err == nil {
+			t.Errorf("offset %d: no error", offset)
+		}
+	}
+}
+
+func TestDecodeMapped(t *testing.T) {
+	// Private-use runes stand for longer tokens
+	text := "\uE000 said \uE001, and \uE000 agreed: \uE001\uE001"
+	substitutions := map[rune]string{'\uE000': "Ada Lovelace", '\uE001': "the engine", 'x': "never used"}
+	want := "Ada Lovelace said the engine, and Ada Lovelace agreed: the enginethe engine"
+
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	got, err := DecodeBytesMapped(payload, bitCount, root, substitutions)
+	if err != nil || got != want {
+		t.Errorf("DecodeBytesMapped = %q, %v; want %q", got, err, want)
+	}
+	if got, err := DecodeBytesMapped(payload, bitCount, root, nil); err != nil || got != text {
+		t.Errorf("without substitutions: %q, %v; want %q", got, err, text)
+	}
+
+	for _, opts := range []EncodeOptions{{}, {Compact: true}, {LSBFirst: true}, {RLE: true}} {
+		data := encodeContainer(t, text, opts)
+		got, err := ReadHuffFileMapped(bytes.NewReader(data), substitutions)
+		if err != nil || got != want {
+			t.Errorf("%+v: ReadHuffFileMapped = %q, %v; want %q", opts, got, err, want)
+		}
+		// The checksum is still verified, against the unsubstituted text
+		corrupt := corruptPayload(t, data)
+		if _, err := ReadHuffFileMapped(bytes.NewReader(corrupt), substitutions); err == nil {
+			t.Errorf("%+v: no error for a bad checksum", opts)
+		}
+	}
+
+	// Byte-coded containers substitute byte values
+	data := encodeContainer(t, "a\x00b\x00", EncodeOptions{Bytes: true})
+	if got, err := ReadHuffFileMapped(bytes.NewReader(data), map[rune]string{0: ", "}); err != nil || got != "a, b, " {
+		t.Errorf("byte mode: %q, %v", got, err)
+	}
+}
+
+func TestAlphabet(t *testing.T) {
+	alphabet := []rune("0123456789+-=日")
+	for _, compact := range []bool{false, true} {
+		t.Run(modeName(EncodeOptions{Compact: compact}), func(t *testing.T) {
+			opts := EncodeOptions{Alphabet: alphabet, Compact: compact}
+			var tables []map[rune]string
+			for _, text := range []string{"12+3=15", "987-6=981", "", "日"} {
+				root, got, err := ReadHuffFile(bytes.NewReader(encodeContainer(t, text, opts)))
+				if err != nil || got != text {
+					t.Fatalf("%q decodes to %q, %v", text, got, err)
+				}
+				codes := BuildCodes(root)
+				for _, char := range alphabet {
+					if _, ok := codes[char]; !ok {
+						t.Errorf("%q: symbol %q of the alphabet has no code", text, char)
+					}
+				}
+				tables = append(tables, codes)
+			}
+			for i, codes := range tables[1:] {
+				if !maps.Equal(codes, tables[0]) {
+					t.Errorf("message %d has a different code table", i+1)
+				}
+			}
+		})
+	}
+
+	errs := []struct {
+		name string
+		text string
+		opts EncodeOptions
+	}{
+		{"symbol outside", "12*3", EncodeOptions{Alphabet: alphabet}},
+		{"with frequency", "12", EncodeOptions{Alphabet: alphabet, Frequency: map[rune]int{'1': 1, '2': 1}}},
+		{"with fast", "12", EncodeOptions{Alphabet: alphabet, Fast: true}},
+		{"with rle", "12", EncodeOptions{Alphabet: alphabet, RLE: true}},
+	}
+	for _, tt := range errs {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := WriteHuffFileWithOptions(io.Discard, tt.text, tt.opts); err == nil {
+				t.Errorf("encoding %q with %+v succeeded", tt.text, tt.opts)
+			}
+		})
+	}
+}
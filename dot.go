@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// dotEscaper escapes a label for a double-quoted DOT string
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// WriteDOT writes the tree as a Graphviz DOT digraph: leaves are boxes
+// labeled with their quoted symbol and frequency, internal nodes circles
+// labeled with their total frequency, and edges are labeled with the bit
+// they stand for. Nodes are numbered in preorder, so the same tree always
+// produces the same output.
+func WriteDOT(root *HuffmanNode, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph huffman {")
+	next := 0
+	var walk func(node *HuffmanNode) int
+	walk = func(node *HuffmanNode) int {
+		id := next
+		next++
+		if node.left == nil && node.right == nil {
+			label := dotEscaper.Replace(strconv.QuoteRune(node.character))
+			fmt.Fprintf(bw, "\tn%d [shape=box, label=\"%s\\n%d\"];\n", id, label, node.frequency)
+			return id
+		}
+		fmt.Fprintf(bw, "\tn%d [shape=circle, label=\"%d\"];\n", id, node.frequency)
+		for bit, child := range []*HuffmanNode{node.left, node.right} {
+			if child != nil {
+				fmt.Fprintf(bw, "\tn%d -> n%d [label=\"%d\"];\n", id, walk(child), bit)
+			}
+		}
+		return id
+	}
+	if root != nil {
+		walk(root)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
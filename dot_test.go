@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	leaf := func(char rune, freq int) *HuffmanNode { return &HuffmanNode{character: char, frequency: freq} }
+	join := func(left, right *HuffmanNode) *HuffmanNode {
+		return &HuffmanNode{frequency: left.frequency + right.frequency, left: left, right: right}
+	}
+	tests := []struct {
+		name        string
+		root        *HuffmanNode
+		nodes       int
+		edges       int
+		leafLabels  []string
+		shortOutput string // the whole output, for the smallest trees
+	}{
+		{"empty", nil, 0, 0, nil, "digraph huffman {\n}\n"},
+		{"single leaf", leaf('a', 3), 1, 0, nil, "digraph huffman {\n\tn0 [shape=box, label=\"'a'\\n3\"];\n}\n"},
+		{"small tree", join(leaf('a', 4), join(leaf('"', 2), leaf('\n', 1))), 5, 4,
+			[]string{`label="'a'\n4"`, `label="'\"'\n2"`, `label="'\\n'\n1"`}, ""},
+		{"built tree", BuildHuffmanTree(BuildFrequencyTable("abracadabra")), 9, 8, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			if err := WriteDOT(tt.root, &sb); err != nil {
+				t.Fatal(err)
+			}
+			out := sb.String()
+			if tt.shortOutput != "" && out != tt.shortOutput {
+				t.Errorf("WriteDOT =\n%s\nwant\n%s", out, tt.shortOutput)
+			}
+			if got := strings.Count(out, "shape="); got != tt.nodes {
+				t.Errorf("%d nodes, want %d:\n%s", got, tt.nodes, out)
+			}
+			if got := strings.Count(out, " -> "); got != tt.edges {
+				t.Errorf("%d edges, want %d:\n%s", got, tt.edges, out)
+			}
+			if zeros, ones := strings.Count(out, `[label="0"]`), strings.Count(out, `[label="1"]`); zeros != tt.edges/2 || ones != tt.edges/2 {
+				t.Errorf("%d edges labeled 0 and %d labeled 1, want %d of each", zeros, ones, tt.edges/2)
+			}
+			for _, label := range tt.leafLabels {
+				if !strings.Contains(out, label) {
+					t.Errorf("output lacks %s:\n%s", label, out)
+				}
+			}
+			var again strings.Builder
+			WriteDOT(tt.root, &again)
+			if again.String() != out {
+				t.Error("a second WriteDOT differs")
+			}
+		})
+	}
+}
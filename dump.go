@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteFrequencyDump writes one line per symbol of a frequency table with
+// its count and, if codes is not nil, its code. Lines are sorted by code
+// point, so the same table always dumps identically.
+func WriteFrequencyDump(w io.Writer, frequency map[rune]int, codes map[rune]string) error {
+	for _, pair := range SortSymbols(frequency, BySymbol) {
+		var err error
+		if codes != nil {
+			_, err = fmt.Fprintf(w, "U+%04X\t%q\t%d\t%s\n", pair.Symbol, pair.Symbol, pair.Freq, codes[pair.Symbol])
+		} else {
+			_, err = fmt.Fprintf(w, "U+%04X\t%q\t%d\n", pair.Symbol, pair.Symbol, pair.Freq)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// freqEntry is the JSON form of one frequency table entry. Symbol is only
+// for readability and omitted for invalid code points; Rune is
+// authoritative.
+type freqEntry struct {
+	Rune   rune   `json:"rune"`
+	Symbol string `json:"symbol,omitempty"`
+	Count  int    `json:"count"`
+}
+
+// MarshalFrequencies encodes a frequency table as JSON, sorted by code
+// point so equal tables marshal identically
+func MarshalFrequencies(frequency map[rune]int) ([]byte, error) {
+	entries := make([]freqEntry, 0, len(frequency))
+	for _, pair := range SortedSymbolFreqs(frequency) {
+		entries = append(entries, freqEntry{Rune: pair.Symbol, Symbol: symbolLabel(pair.Symbol), Count: pair.Freq})
+	}
+	return json.MarshalIndent(entries, "", "  ")
+}
+
+// UnmarshalFrequencies decodes a frequency table written by
+// MarshalFrequencies
+func UnmarshalFrequencies(data []byte) (map[rune]int, error) {
+	var entries []freqEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	frequency := make(map[rune]int, len(entries))
+	for _, e := range entries {
+		if _, dup := frequency[e.Rune]; dup {
+			return nil, fmt.Errorf("symbol %q appears twice", e.Rune)
+		}
+		if e.Count < 0 {
+			return nil, fmt.Errorf("symbol %q has negative count %d", e.Rune, e.Count)
+		}
+		frequency[e.Rune] = e.Count
+	}
+	return frequency, nil
+}
+
+// ReadFrequencyDump parses the output of WriteFrequencyDump back into a
+// frequency table; the symbol and code columns are ignored
+func ReadFrequencyDump(r io.Reader) (map[rune]int, error) {
+	frequency := make(map[rune]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "U+") {
+			return nil, fmt.Errorf("line %d: not a frequency dump line", line)
+		}
+		char, err := strconv.ParseUint(fields[0][2:], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid code point %q", line, fields[0])
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("line %d: invalid count %q", line, fields[2])
+		}
+		if _, dup := frequency[rune(char)]; dup {
+			return nil, fmt.Errorf("line %d: symbol %q appears twice", line, rune(char))
+		}
+		frequency[rune(char)] = count
+	}
+	return frequency, scanner.Err()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestWriteFrequencyDumpDeterministic(t *testing.T) {
+	frequency := map[rune]int{'b': 2, 'a': 3, '日': 1, '\t': 1}
+	codes := map[rune]string{'a': "0", 'b': "10", '日': "110", '\t': "111"}
+	want := "U+0009\t'\\t'\t1\t111\n" +
+		"U+0061\t'a'\t3\t0\n" +
+		"U+0062\t'b'\t2\t10\n" +
+		"U+65E5\t'日'\t1\t110\n"
+	for i := 0; i < 20; i++ {
+		// Copying into a fresh map changes its iteration order
+		copied := make(map[rune]int, len(frequency))
+		for char, count := range frequency {
+			copied[char] = count
+		}
+		var buf bytes.Buffer
+		if err := WriteFrequencyDump(&buf, copied, codes); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Fatalf("run %d: dump\n%s\nwant\n%s", i, buf.String(), want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteFrequencyDump(&buf, map[rune]int{'z': 4, 'y': 5}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "U+0079\t'y'\t5\nU+007A\t'z'\t4\n"; buf.String() != want {
+		t.Errorf("dump without codes %q, want %q", buf.String(), want)
+	}
+}
+
+func TestFrequencyTableRoundTrip(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			frequency := BuildFrequencyTable(tt.text)
+			data, err := MarshalFrequencies(frequency)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := UnmarshalFrequencies(data); err != nil || !maps.Equal(got, frequency) {
+				t.Errorf("JSON round trip = %v, %v; want %v", got, err, frequency)
+			}
+
+			for _, codes := range []map[rune]string{nil, BuildCodes(BuildHuffmanTree(frequency))} {
+				var buf bytes.Buffer
+				if err := WriteFrequencyDump(&buf, frequency, codes); err != nil {
+					t.Fatal(err)
+				}
+				if got, err := ReadFrequencyDump(&buf); err != nil || !maps.Equal(got, frequency) {
+					t.Errorf("dump round trip (codes %v) = %v, %v; want %v", codes != nil, got, err, frequency)
+				}
+			}
+		})
+	}
+}
+
+func TestFrequencyTableErrors(t *testing.T) {
+	dumps := []struct {
+		name string
+		dump string
+	}{
+		{"too few columns", "U+0061\t'a'\n"},
+		{"no U+ prefix", "0061\t'a'\t3\n"},
+		{"bad code point", "U+00G1\t'a'\t3\n"},
+		{"bad count", "U+0061\t'a'\tmany\n"},
+		{"negative count", "U+0061\t'a'\t-1\n"},
+		{"duplicate", "U+0061\t'a'\t3\nU+0061\t'a'\t4\n"},
+	}
+	for _, tt := range dumps {
+		t.Run("dump "+tt.name, func(t *testing.T) {
+			if _, err := ReadFrequencyDump(strings.NewReader(tt.dump)); err == nil {
+				t.Errorf("ReadFrequencyDump accepted %q", tt.dump)
+			}
+		})
+	}
+
+	docs := []struct {
+		name string
+		json string
+	}{
+		{"not JSON", "U+0061"},
+		{"not a list", `{"rune": 97, "count": 3}`},
+		{"negative count", `[{"rune": 97, "count": -1}]`},
+		{"duplicate", `[{"rune": 97, "count": 3}, {"rune": 97, "count": 4}]`},
+	}
+	for _, tt := range docs {
+		t.Run("JSON "+tt.name, func(t *testing.T) {
+			if _, err := UnmarshalFrequencies([]byte(tt.json)); err == nil {
+				t.Errorf("UnmarshalFrequencies accepted %s", tt.json)
+			}
+		})
+	}
+}
+
+func TestEdgeCodePointFrequencies(t *testing.T) {
+	frequency := map[rune]int{'a': 5}
+	for i, char := range edgeCodePoints {
+		frequency[char] = i + 1
+	}
+	data, err := MarshalFrequencies(frequency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := UnmarshalFrequencies(data); err != nil || !maps.Equal(got, frequency) {
+		t.Errorf("JSON round trip = %v, %v; want %v", got, err, frequency)
+	}
+}
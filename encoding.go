@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// TextEncoding identifies the character encoding of an input file
+type TextEncoding int
+
+const (
+	EncodingUTF8 TextEncoding = iota
+	EncodingUTF16LE
+	EncodingUTF16BE
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// String returns the flag name of the encoding
+func (e TextEncoding) String() string {
+	switch e {
+	case EncodingUTF16LE:
+		return "utf-16le"
+	case EncodingUTF16BE:
+		return "utf-16be"
+	default:
+		return "utf-8"
+	}
+}
+
+// ParseTextEncoding parses an -encoding flag value; "auto" reports ok=false
+func ParseTextEncoding(name string) (enc TextEncoding, ok bool, err error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return EncodingUTF8, false, nil
+	case "utf-8", "utf8":
+		return EncodingUTF8, true, nil
+	case "utf-16le", "utf16le":
+		return EncodingUTF16LE, true, nil
+	case "utf-16be", "utf16be":
+		return EncodingUTF16BE, true, nil
+	}
+	return EncodingUTF8, false, fmt.Errorf("unknown encoding %q", name)
+}
+
+// DetectEncoding sniffs the byte-order mark at the start of data.
+// Data without a BOM is assumed to be UTF-8.
+func DetectEncoding(data []byte) (enc TextEncoding, hasBOM bool) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return EncodingUTF8, true
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return EncodingUTF16LE, true
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return EncodingUTF16BE, true
+	}
+	return EncodingUTF8, false
+}
+
+// bom returns the byte-order mark for the encoding
+func (e TextEncoding) bom() []byte {
+	switch e {
+	case EncodingUTF16LE:
+		return bomUTF16LE
+	case EncodingUTF16BE:
+		return bomUTF16BE
+	default:
+		return bomUTF8
+	}
+}
+
+// DecodeText transcodes raw file content in the given encoding to a UTF-8
+// string, stripping a leading BOM and reporting whether one was present
+func DecodeText(data []byte, enc TextEncoding) (text string, hasBOM bool, err error) {
+	if bytes.HasPrefix(data, enc.bom()) {
+		data = data[len(enc.bom()):]
+		hasBOM = true
+	}
+	if enc == EncodingUTF8 {
+		return string(data), hasBOM, nil
+	}
+
+	if len(data)%2 != 0 {
+		return "", hasBOM, errors.New("odd number of bytes in UTF-16 input")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		lo, hi := data[2*i], data[2*i+1]
+		if enc == EncodingUTF16BE {
+			lo, hi = hi, lo
+		}
+		units[i] = uint16(lo) | uint16(hi)<<8
+	}
+	return string(utf16.Decode(units)), hasBOM, nil
+}
+
+// EncodeText converts a UTF-8 string back to the given encoding,
+// restoring the BOM if the original input had one
+func EncodeText(text string, enc TextEncoding, withBOM bool) []byte {
+	var out []byte
+	if withBOM {
+		out = append(out, enc.bom()...)
+	}
+	if enc == EncodingUTF8 {
+		return append(out, text...)
+	}
+
+	for _, unit := range utf16.Encode([]rune(text)) {
+		lo, hi := byte(unit), byte(unit>>8)
+		if enc == EncodingUTF16BE {
+			lo, hi = hi, lo
+		}
+		out = append(out, lo, hi)
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		enc     TextEncoding
+		withBOM bool
+	}{
+		{"empty", nil, EncodingUTF8, false},
+		{"no bom", []byte("plain"), EncodingUTF8, false},
+		{"utf-8 bom", append(bomUTF8, 'a'), EncodingUTF8, true},
+		{"utf-16le bom", append(bomUTF16LE, 'a', 0), EncodingUTF16LE, true},
+		{"utf-16be bom", append(bomUTF16BE, 0, 'a'), EncodingUTF16BE, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, withBOM := DetectEncoding(tt.data)
+			if enc != tt.enc || withBOM != tt.withBOM {
+				t.Errorf("DetectEncoding = %v, %v; want %v, %v", enc, withBOM, tt.enc, tt.withBOM)
+			}
+		})
+	}
+}
+
+func TestParseTextEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		enc    TextEncoding
+		forced bool
+		ok     bool
+	}{
+		{"auto", EncodingUTF8, false, true},
+		{"", EncodingUTF8, false, true},
+		{"UTF-8", EncodingUTF8, true, true},
+		{"utf16le", EncodingUTF16LE, true, true},
+		{"utf-16be", EncodingUTF16BE, true, true},
+		{"latin1", EncodingUTF8, false, false},
+	}
+	for _, tt := range tests {
+		enc, forced, err := ParseTextEncoding(tt.name)
+		if (err == nil) != tt.ok || enc != tt.enc || forced != tt.forced {
+			t.Errorf("ParseTextEncoding(%q) = %v, %v, %v", tt.name, enc, forced, err)
+		}
+	}
+}
+
+func TestUTF16FileRoundTrip(t *testing.T) {
+	const text = "naïve café, 日本語 and 𝄞 clefs"
+	for _, enc := range []TextEncoding{EncodingUTF16LE, EncodingUTF16BE, EncodingUTF8} {
+		for _, withBOM := range []bool{true, false} {
+			path := filepath.Join(t.TempDir(), "input.txt")
+			raw := EncodeText(text, enc, withBOM)
+			if err := os.WriteFile(path, raw, 0644); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			detected, _ := DetectEncoding(data)
+			if !withBOM {
+				// Nothing to sniff; -encoding supplies it
+				detected = enc
+			}
+			if detected != enc {
+				t.Fatalf("%v: detected %v", enc, detected)
+			}
+			decoded, hasBOM, err := DecodeText(data, detected)
+			if err != nil {
+				t.Fatalf("%v: DecodeText: %v", enc, err)
+			}
+			if decoded != text || hasBOM != withBOM {
+				t.Fatalf("%v: DecodeText = %q, %v; want %q, %v", enc, decoded, hasBOM, text, withBOM)
+			}
+
+			root := BuildHuffmanTree(BuildFrequencyTable(decoded))
+			restored := Decode(Encode(decoded, BuildCodes(root)), root)
+			if got := EncodeText(restored, enc, hasBOM); !bytes.Equal(got, raw) {
+				t.Errorf("%v, bom %v: round trip changed the file bytes", enc, withBOM)
+			}
+		}
+	}
+}
+
+func TestDecodeTextOddUTF16(t *testing.T) {
+	if _, _, err := DecodeText([]byte{'a', 0, 'b'}, EncodingUTF16LE); err == nil {
+		t.Error("DecodeText accepted an odd number of UTF-16 bytes")
+	}
+}
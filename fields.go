@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// EncodeFields Huffman-codes several string fields, such as the columns of
+// one record, under a single tree built over all of them while keeping the
+// field boundaries. The layout is the tree (AppendTree), the field count as
+// a uvarint, then for each field its payload bit count as a uvarint
+// followed by its packed bits. Empty fields take a single zero byte.
+func EncodeFields(fields []string) ([]byte, error) {
+	frequency := make(map[rune]int)
+	for i, field := range fields {
+		if !utf8.ValidString(field) {
+			return nil, fmt.Errorf("field %d is not valid UTF-8", i)
+		}
+		for _, char := range field {
+			frequency[char]++
+		}
+	}
+	root := BuildHuffmanTree(frequency)
+	codes := BuildCodes(root)
+
+	data := AppendTree(nil, root)
+	data = binary.AppendUvarint(data, uint64(len(fields)))
+	for _, field := range fields {
+		encoded, err := encodeChecked(field, codes)
+		if err != nil {
+			return nil, err
+		}
+		payload, bitCount := PackBits(encoded)
+		data = binary.AppendUvarint(data, uint64(bitCount))
+		data = append(data, payload...)
+	}
+	return data, nil
+}
+
+// DecodeFields decodes data produced by EncodeFields
+func DecodeFields(data []byte) ([]string, error) {
+	r := bytes.NewReader(data)
+	root, err := ReadTree(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading tree: %w", err)
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	// Every field takes at least one byte, which bounds a corrupt count
+	if count > uint64(r.Len()) {
+		return nil, fmt.Errorf("field count %d exceeds the remaining %d bytes", count, r.Len())
+	}
+
+	fields := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		bitCount, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", i, unexpectedEOF(err))
+		}
+		if (bitCount+7)/8 > uint64(r.Len()) {
+			return nil, fmt.Errorf("field %d: %w", i, io.ErrUnexpectedEOF)
+		}
+		payload := make([]byte, (bitCount+7)/8)
+		r.Read(payload)
+		field, err := DecodeBytes(payload, int(bitCount), root)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", i, err)
+		}
+		fields = append(fields, field)
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("unexpected data after the last field")
+	}
+	return fields, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEncodeFieldsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+	}{
+		{"no fields", nil},
+		{"one empty field", []string{""}},
+		{"empty fields", []string{"", "", ""}},
+		{"one field", []string{"single"}},
+		{"record", []string{"42", "Ada Lovelace", "", "London", "ada@example.com"}},
+		{"unicode", []string{"日本", "ünïcödé", "🙂"}},
+		{"one symbol", []string{"aaa", "a", "", "aaaaaaaa"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeFields(tt.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeFields(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.fields) {
+				t.Errorf("DecodeFields = %q, want %q", got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestDecodeFieldsErrors(t *testing.T) {
+	if _, err := EncodeFields([]string{"ok", "bad \xff"}); err == nil {
+		t.Error("EncodeFields accepted invalid UTF-8")
+	}
+	data, err := EncodeFields([]string{"first field", "second field"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < len(data); n++ {
+		if _, err := DecodeFields(data[:n]); err == nil {
+			t.Errorf("%d of %d bytes: no error", n, len(data))
+		}
+	}
+	if _, err := DecodeFields(append(data, 0)); err == nil {
+		t.Error("no error for data after the last field")
+	}
+}
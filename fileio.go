@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// AtomicOptions are the settings of an atomic write
+type AtomicOptions struct {
+	// Perm is the permission bits of the created file, 0644 if zero
+	Perm os.FileMode
+
+	// TempDir, if set, is the directory the temporary file is created in,
+	// for destinations whose directory cannot hold it. By default it is
+	// created next to the destination.
+	TempDir string
+
+	// rename renames a finished temporary file into place, os.Rename if
+	// nil; tests replace it to exercise the cross-device fallback
+	rename func(oldpath, newpath string) error
+}
+
+// WriteFileAtomic writes data to a temporary file in the destination's
+// directory and renames it into place, so readers never
+// observe a partially written file. If the rename crosses filesystems, the
+// file is copied to a second temporary file next to the destination and
+// renamed from there. On error the destination is left untouched and the
+// temporary files are removed. The file is created with mode 0644.
+func WriteFileAtomic(filename string, data []byte) error {
+	return WriteFileAtomicOptions(filename, data, AtomicOptions{})
+}
+
+// WriteFileAtomicMode is WriteFileAtomic creating the file with the given
+// permission bits, such as 0600 for sensitive data
+func WriteFileAtomicMode(filename string, data []byte, perm os.FileMode) error {
+	return WriteFileAtomicOptions(filename, data, AtomicOptions{Perm: perm})
+}
+
+// WriteFileAtomicOptions is WriteFileAtomic with the file mode and
+// temporary directory given by opts
+func WriteFileAtomicOptions(filename string, data []byte, opts AtomicOptions) error {
+	return writeFileAtomicFunc(filename, opts, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeFileAtomicFunc is WriteFileAtomicOptions for content produced by
+// write
+func writeFileAtomicFunc(filename string, opts AtomicOptions, write func(w io.Writer) error) (err error) {
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+	dir := opts.TempDir
+	if dir == "" {
+		dir = filepath.Dir(filename)
+	}
+	rename := opts.rename
+	if rename == nil {
+		rename = os.Rename
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = finishTemp(tmp, perm); err != nil {
+		return err
+	}
+	if err = rename(tmp.Name(), filename); errors.Is(err, syscall.EXDEV) {
+		err = copyIntoPlace(tmp.Name(), filename, perm, rename)
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// finishTemp sets the mode of a written temporary file, flushes it to
+// disk and closes it
+func finishTemp(tmp *os.File, perm os.FileMode) error {
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	return tmp.Close()
+}
+
+// copyIntoPlace copies the file src, on another filesystem, to a temporary
+// file next to filename and renames that into place
+func copyIntoPlace(src, filename string, perm os.FileMode, rename func(oldpath, newpath string) error) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = io.Copy(tmp, in); err != nil {
+		return err
+	}
+	if err = finishTemp(tmp, perm); err != nil {
+		return err
+	}
+	return rename(tmp.Name(), filename)
+}
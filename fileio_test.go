@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// assertOnly fails unless dir holds exactly the named file with content
+func assertOnly(t *testing.T, dir, name, content string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != name {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("directory holds %q, want only %q", names, name)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("%s holds %q, want %q", name, data, content)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.huff")
+	for _, content := range []string{"first", "second, longer content"} {
+		if err := WriteFileAtomic(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		assertOnly(t, dir, "out.huff", content)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+}
+
+func TestWriteFileAtomicMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permission bits")
+	}
+	writers := []struct {
+		name  string
+		write func(path string, perm os.FileMode) error
+	}{
+		{"WriteFileAtomicMode", func(path string, perm os.FileMode) error {
+			return WriteFileAtomicMode(path, []byte("secret"), perm)
+		}},
+		{"WriteToFile", func(path string, perm os.FileMode) error {
+			return WriteToFile(path, "secret", perm)
+		}},
+	}
+	for _, w := range writers {
+		for _, perm := range []os.FileMode{0600, 0640, 0644} {
+			t.Run(fmt.Sprintf("%s/%o", w.name, perm), func(t *testing.T) {
+				t.Parallel()
+				path := filepath.Join(t.TempDir(), "out.huff")
+				if err := w.write(path, perm); err != nil {
+					t.Fatal(err)
+				}
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != perm {
+					t.Errorf("mode = %v, want %v", info.Mode().Perm(), perm)
+				}
+			})
+		}
+	}
+}
+
+func TestWriteFileAtomicFailure(t *testing.T) {
+	errWrite := errors.New("disk full")
+	errRename := errors.New("rename failed")
+	tests := []struct {
+		name   string
+		write  func(w io.Writer) error
+		rename func(oldpath, newpath string) error
+		want   error
+	}{
+		{
+			name: "write error",
+			write: func(w io.Writer) error {
+				w.Write([]byte("partial"))
+				return errWrite
+			},
+			want: errWrite,
+		},
+		{
+			name:   "rename error",
+			rename: func(oldpath, newpath string) error { return errRename },
+			want:   errRename,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			path := filepath.Join(dir, "out.huff")
+			if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			write := tt.write
+			if write == nil {
+				write = func(w io.Writer) error {
+					_, err := w.Write([]byte("replacement"))
+					return err
+				}
+			}
+			if err := writeFileAtomicFunc(path, AtomicOptions{rename: tt.rename}, write); !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			assertOnly(t, dir, "out.huff", "original")
+		})
+	}
+}
+
+func TestWriteFileAtomicCrossDevice(t *testing.T) {
+	t.Parallel()
+	dir, tmpDir := t.TempDir(), t.TempDir()
+	opts := AtomicOptions{
+		TempDir: tmpDir,
+		// Fail only renames out of TempDir, as a rename across filesystems
+		// would
+		rename: func(oldpath, newpath string) error {
+			if filepath.Dir(oldpath) == tmpDir {
+				return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+			}
+			return os.Rename(oldpath, newpath)
+		},
+	}
+
+	path := filepath.Join(dir, "out.huff")
+	if err := writeFileAtomicFunc(path, opts, func(w io.Writer) error {
+		_, err := w.Write([]byte("copied"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertOnly(t, dir, "out.huff", "copied")
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("%d temporary files left in TempDir", len(entries))
+	}
+}
+
+func TestWriteFileAtomicTempDir(t *testing.T) {
+	t.Parallel()
+	dir, tmpDir := t.TempDir(), t.TempDir()
+	var tmpPath string
+	opts := AtomicOptions{
+		TempDir: tmpDir,
+		rename: func(oldpath, newpath string) error {
+			tmpPath = oldpath
+			return os.Rename(oldpath, newpath)
+		},
+	}
+	if err := writeFileAtomicFunc(filepath.Join(dir, "out.huff"), opts, func(w io.Writer) error {
+		_, err := w.Write([]byte("via tmpdir"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(tmpPath) != tmpDir {
+		t.Errorf("temporary file %s is not in TempDir %s", tmpPath, tmpDir)
+	}
+	assertOnly(t, dir, "out.huff", "via tmpdir")
+}
+
+func TestReadWriteFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ReadFile(filepath.Join(dir, "missing.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile of a missing file: error %v, want fs.ErrNotExist", err)
+	}
+	if err := WriteToFile(filepath.Join(dir, "missing", "out.txt"), "text", 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("WriteToFile into a missing directory: error %v, want fs.ErrNotExist", err)
+	}
+
+	path := filepath.Join(dir, "out.txt")
+	if err := WriteToFile(path, "text", 0644); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ReadFile(path); err != nil || content != "text" {
+		t.Errorf("ReadFile = %q, %v; want %q", content, err, "text")
+	}
+}
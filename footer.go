@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A FlagFooter container is written in one pass with a code table fixed in
+// advance, so its header cannot hold the sizes or checksum of the text. It
+// is followed by a fixed-size footer instead, found by reading to the end
+// of the input, so such a container must end its stream and cannot be
+// placed in an archive:
+//
+//	bits      uint64 big-endian, payload bit count
+//	symbols   uint64 big-endian, number of encoded symbols
+//	size      uint64 big-endian, original size in bytes
+//	checksum  uint32 big-endian, CRC-32 (IEEE) of the original text
+//	fcrc      uint32 big-endian, CRC-32 of the footer fields above
+const footerSize = 8 + 8 + 8 + 4 + 4
+
+// errFooterUnsupported is returned by readers that need the payload size
+// before decoding
+var errFooterUnsupported = errors.New("container has a footer; decode it with ReadHuffFile or NewContainerDecoder")
+
+// FooterWriter compresses UTF-8 text in a single pass into a FlagFooter
+// container, for streams whose length is not known up front
+type FooterWriter struct {
+	w   io.Writer
+	enc *Encoder
+}
+
+// NewFooterWriter writes a FlagFooter container header for the code tree
+// root to w and returns a FooterWriter for the text. Every symbol written
+// must have a leaf in root. Close must be called to write the footer.
+func NewFooterWriter(w io.Writer, root *HuffmanNode) (*FooterWriter, error) {
+	h := &HuffHeader{Version: versionFor(FlagFooter), Flags: FlagFooter, Tree: root}
+	if _, err := w.Write(h.appendTo(nil)); err != nil {
+		return nil, err
+	}
+	return &FooterWriter{w: w, enc: NewEncoder(w, BuildCodes(root))}, nil
+}
+
+// Write encodes the UTF-8 text in p
+func (fw *FooterWriter) Write(p []byte) (int, error) {
+	return fw.enc.Write(p)
+}
+
+// Close writes the rest of the payload and the footer
+func (fw *FooterWriter) Close() error {
+	if err := fw.enc.Close(); err != nil {
+		return err
+	}
+	footer := binary.BigEndian.AppendUint64(nil, uint64(fw.enc.BitCount()))
+	footer = binary.BigEndian.AppendUint64(footer, uint64(fw.enc.symbols))
+	footer = binary.BigEndian.AppendUint64(footer, uint64(fw.enc.inputBytes))
+	footer = binary.BigEndian.AppendUint32(footer, fw.enc.Checksum())
+	footer = binary.BigEndian.AppendUint32(footer, crc32.ChecksumIEEE(footer))
+	_, err := fw.w.Write(footer)
+	return err
+}
+
+// newFooterDecoder returns a Decoder for the payload of a FlagFooter
+// container. The payload length is unknown until the footer is reached, so
+// the last footerSize bytes read are always held back; once the input ends
+// they are parsed as the footer, which fills in the header fields and the
+// payload bit count before the final payload byte is released.
+func newFooterDecoder(br *bufio.Reader, h *HuffHeader) *Decoder {
+	d := &Decoder{root: h.DecodingTree(), header: h, bytes: h.Flags&FlagBytes != 0, rle: h.Flags&FlagRLE != 0}
+	fr := &footerReader{r: br}
+	fr.onFooter = func(footer []byte, payloadBytes int64) error {
+		if crc32.ChecksumIEEE(footer[:footerSize-4]) != binary.BigEndian.Uint32(footer[footerSize-4:]) {
+			return errors.New("footer checksum mismatch")
+		}
+		h.BitCount = binary.BigEndian.Uint64(footer)
+		h.SymbolCount = binary.BigEndian.Uint64(footer[8:])
+		h.OriginalSize = binary.BigEndian.Uint64(footer[16:])
+		h.Checksum = binary.BigEndian.Uint32(footer[24:])
+		if h.PayloadSize() != uint64(payloadBytes) || h.BitCount < uint64(d.bits.consumed) {
+			return fmt.Errorf("footer bit count %d is inconsistent with the payload", h.BitCount)
+		}
+		d.bits.remaining = int(h.BitCount) - d.bits.consumed
+		return nil
+	}
+	if h.Flags&FlagLSBFirst != 0 {
+		d.bits = newBitReader(lsbFirstReader{fr}, math.MaxInt)
+	} else {
+		d.bits = newBitReader(fr, math.MaxInt)
+	}
+	return d
+}
+
+// footerReader passes through all but the last footerSize bytes of r,
+// calling onFooter with them and the payload length when r ends
+type footerReader struct {
+	r         io.Reader
+	buf       []byte // bytes read from r and not yet returned
+	chunk     []byte
+	delivered int64 // bytes returned so far
+	eof       bool
+	onFooter  func(footer []byte, payloadBytes int64) error
+	err       error
+}
+
+func (fr *footerReader) Read(p []byte) (int, error) {
+	if fr.err != nil {
+		return 0, fr.err
+	}
+	// Hold back one byte beyond the footer until the end is seen, so the
+	// footer is always parsed before the last payload byte is returned
+	for !fr.eof && len(fr.buf) < len(p)+footerSize+1 {
+		if len(fr.chunk) < len(p) {
+			fr.chunk = make([]byte, max(len(p), 4096))
+		}
+		n, err := fr.r.Read(fr.chunk)
+		fr.buf = append(fr.buf, fr.chunk[:n]...)
+		if err == io.EOF {
+			fr.eof = true
+			if len(fr.buf) < footerSize {
+				fr.err = io.ErrUnexpectedEOF
+				return 0, fr.err
+			}
+			payloadBytes := fr.delivered + int64(len(fr.buf)-footerSize)
+			if fr.err = fr.onFooter(fr.buf[len(fr.buf)-footerSize:], payloadBytes); fr.err != nil {
+				return 0, fr.err
+			}
+		} else if err != nil {
+			fr.err = err
+			return 0, err
+		}
+	}
+
+	avail := len(fr.buf) - footerSize - 1
+	if fr.eof {
+		avail = len(fr.buf) - footerSize
+	}
+	n := copy(p, fr.buf[:max(avail, 0)])
+	fr.buf = fr.buf[n:]
+	fr.delivered += int64(n)
+	if n == 0 && fr.eof {
+		return 0, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFooterWriterPipe(t *testing.T) {
+	text := strings.Repeat("streamed through a pipe, verified at the end ", 100)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+
+	pr, pw := io.Pipe()
+	go func() {
+		fw, err := NewFooterWriter(pw, root)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		// Write in uneven pieces, as a producer of unknown length would
+		for rest := text; rest != ""; {
+			n := min(len(rest), 37)
+			if _, err := fw.Write([]byte(rest[:n])); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			rest = rest[n:]
+		}
+		pw.CloseWithError(fw.Close())
+	}()
+
+	d, err := NewContainerDecoder(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != text {
+		t.Error("footer container decoded to different text")
+	}
+	if h := d.Header(); h.OriginalSize != uint64(len(text)) || h.Flags&FlagFooter == 0 {
+		t.Errorf("header after decoding: size %d, flags %#x", h.OriginalSize, h.Flags)
+	}
+}
+
+// footerContainer returns text as a FlagFooter container
+func footerContainer(t *testing.T, text string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	fw, err := NewFooterWriter(&buf, BuildHuffmanTree(BuildFrequencyTable(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFooterVerification(t *testing.T) {
+	text := strings.Repeat("footer fields are checked ", 20)
+	data := footerContainer(t, text)
+	_, decoded, err := ReadHuffFile(bytes.NewReader(data))
+	if err != nil || decoded != text {
+		t.Fatalf("ReadHuffFile = %v", err)
+	}
+
+	checksum := bytes.Clone(data)
+	checksum[len(checksum)-5] ^= 1 // text checksum field; fcrc no longer matches
+	payload := bytes.Clone(data)
+	payload[headerSize(t, data)] ^= 0x80
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"footer corrupt", checksum},
+		{"payload corrupt", payload},
+		{"footer truncated", data[:len(data)-3]},
+		{"no footer", data[:headerSize(t, data)+2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ReadHuffFile(bytes.NewReader(tt.data)); err == nil {
+				t.Error("corruption not detected")
+			}
+		})
+	}
+
+	if _, err := BuildIndex(text, mustHeader(t, data), 16); err == nil {
+		t.Error("BuildIndex accepted a footer container")
+	}
+	if _, err := ConcatBlocks(data); err == nil {
+		t.Error("ConcatBlocks accepted a footer container")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// CodeLengthsFunc returns Huffman code lengths for symbols of any type, such
+// as structs that cannot be ordered with <. Symbols are sorted with less
+// before the tree is built, so ties between equal counts are broken the same
+// way on every run, as BuildHuffmanTree breaks them by code point. less must
+// be a strict ordering that tells every two distinct symbols apart. Symbols
+// with a count of zero or less get no code.
+func CodeLengthsFunc[T comparable](frequency map[T]int, less func(a, b T) bool) map[T]int {
+	symbols := make([]T, 0, len(frequency))
+	for sym, count := range frequency {
+		if count > 0 {
+			symbols = append(symbols, sym)
+		}
+	}
+	slices.SortFunc(symbols, compareFunc(less))
+
+	// Build the tree over the symbols' positions in that order
+	pairs := make([]SymbolFreq, len(symbols))
+	for i, sym := range symbols {
+		pairs[i] = SymbolFreq{Symbol: rune(i), Freq: frequency[sym]}
+	}
+	lengths := make(map[T]int, len(symbols))
+	for i, length := range CodeLengths(BuildHuffmanTreeFromSorted(pairs)) {
+		lengths[symbols[i]] = length
+	}
+	return lengths
+}
+
+// CanonicalCodesFunc assigns canonical codes like CanonicalCodes, but for
+// symbols of any type, ordering those of equal code length with less. Both
+// sides must use the same less for the codes to match.
+func CanonicalCodesFunc[T comparable](lengths map[T]int, less func(a, b T) bool) (map[T]string, error) {
+	symbols := make([]T, 0, len(lengths))
+	for sym, length := range lengths {
+		if length < 1 {
+			return nil, fmt.Errorf("symbol %v has invalid code length %d", sym, length)
+		}
+		symbols = append(symbols, sym)
+	}
+	byValue := compareFunc(less)
+	slices.SortFunc(symbols, func(a, b T) int {
+		if c := cmp.Compare(lengths[a], lengths[b]); c != 0 {
+			return c
+		}
+		return byValue(a, b)
+	})
+	return orderedCodes(symbols, lengths)
+}
+
+// CodeLengthsOrdered is CodeLengthsFunc in the natural order of T
+func CodeLengthsOrdered[T cmp.Ordered](frequency map[T]int) map[T]int {
+	return CodeLengthsFunc(frequency, cmp.Less[T])
+}
+
+// CanonicalCodesOrdered is CanonicalCodesFunc in the natural order of T
+func CanonicalCodesOrdered[T cmp.Ordered](lengths map[T]int) (map[T]string, error) {
+	return CanonicalCodesFunc(lengths, cmp.Less[T])
+}
+
+// compareFunc turns a less function into a three-way comparison for
+// slices.SortFunc
+func compareFunc[T any](less func(a, b T) bool) func(a, b T) int {
+	return func(a, b T) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		}
+		return 0
+	}
+}
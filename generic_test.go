@@ -0,0 +1,122 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+// token is a struct symbol, which has no natural order
+type token struct {
+	kind  string
+	value int
+}
+
+func tokenLess(a, b token) bool {
+	if a.kind != b.kind {
+		return a.kind < b.kind
+	}
+	return a.value < b.value
+}
+
+func TestOrderedMatchesRuneCore(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			frequency := BuildFrequencyTable(tt.text)
+			lengths := CodeLengthsOrdered(frequency)
+			if want := CodeLengths(BuildHuffmanTree(frequency)); !maps.Equal(lengths, want) {
+				t.Errorf("CodeLengthsOrdered = %v, want %v", lengths, want)
+			}
+			codes, err := CanonicalCodesOrdered(lengths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := CanonicalCodes(lengths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(codes, want) {
+				t.Errorf("CanonicalCodesOrdered = %v, want %v", codes, want)
+			}
+		})
+	}
+}
+
+func TestCanonicalCodesFuncStruct(t *testing.T) {
+	tokens := []token{
+		{"ident", 1}, {"op", '+'}, {"ident", 2}, {"op", '*'}, {"ident", 1},
+		{"number", 7}, {"op", '+'}, {"ident", 1}, {"number", 7}, {"ident", 3},
+	}
+	frequency := make(map[token]int)
+	for _, tok := range tokens {
+		frequency[tok]++
+	}
+	// Many counts tie, so only less makes the lengths deterministic
+	lengths := CodeLengthsFunc(frequency, tokenLess)
+	for i := 0; i < 20; i++ {
+		if again := CodeLengthsFunc(maps.Clone(frequency), tokenLess); !maps.Equal(again, lengths) {
+			t.Fatalf("CodeLengthsFunc = %v, then %v", lengths, again)
+		}
+	}
+	codes, err := CanonicalCodesFunc(lengths, tokenLess)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Codes of equal length follow less, and none is a prefix of another
+	for a, codeA := range codes {
+		for b, codeB := range codes {
+			if a == b {
+				continue
+			}
+			if strings.HasPrefix(codeB, codeA) {
+				t.Errorf("code %q of %v is a prefix of %q of %v", codeA, a, codeB, b)
+			}
+			if len(codeA) == len(codeB) && tokenLess(a, b) && codeA > codeB {
+				t.Errorf("%v < %v but code %q > %q", a, b, codeA, codeB)
+			}
+		}
+	}
+
+	// The tokens round-trip through the codes
+	var encoded strings.Builder
+	for _, tok := range tokens {
+		encoded.WriteString(codes[tok])
+	}
+	symbols := make(map[string]token, len(codes))
+	for tok, code := range codes {
+		symbols[code] = tok
+	}
+	var decoded []token
+	prefix := ""
+	for _, bit := range encoded.String() {
+		prefix += string(bit)
+		if tok, ok := symbols[prefix]; ok {
+			decoded = append(decoded, tok)
+			prefix = ""
+		}
+	}
+	if prefix != "" || len(decoded) != len(tokens) {
+		t.Fatalf("decoded %v with %q left over, want %v", decoded, prefix, tokens)
+	}
+	for i := range tokens {
+		if decoded[i] != tokens[i] {
+			t.Fatalf("decoded %v, want %v", decoded, tokens)
+		}
+	}
+}
+
+func TestCanonicalCodesFuncInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		lengths map[token]int
+	}{
+		{"zero length", map[token]int{{"a", 1}: 0}},
+		{"oversubscribed", map[token]int{{"a", 1}: 1, {"a", 2}: 1, {"a", 3}: 1}},
+	}
+	for _, tt := range tests {
+		if _, err := CanonicalCodesFunc(tt.lengths, tokenLess); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
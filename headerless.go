@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// errNoTable is returned when a header-less payload is decoded without a
+// code table
+var errNoTable = errors.New("header-less payload needs an external code table")
+
+// EncodeHeaderless codes text with a code table both sides already share,
+// emitting only the payload bit count as a uvarint followed by the packed
+// payload. It fails if text holds a symbol missing from codes.
+func EncodeHeaderless(text string, codes map[rune]string) ([]byte, error) {
+	if !utf8.ValidString(text) {
+		return nil, errors.New("input is not valid UTF-8")
+	}
+	payload, bitCount, err := EncodeAppend(nil, text, codes)
+	if err != nil {
+		return nil, err
+	}
+	return append(binary.AppendUvarint(nil, uint64(bitCount)), payload...), nil
+}
+
+// DecodeHeaderless decodes data produced by EncodeHeaderless with the same
+// code table
+func DecodeHeaderless(data []byte, codes map[rune]string) (string, error) {
+	if codes == nil {
+		return "", errNoTable
+	}
+	bitCount, n := binary.Uvarint(data)
+	if n <= 0 {
+		return "", errors.New("invalid bit count prefix")
+	}
+	payload := data[n:]
+	if bitCount > uint64(len(payload))*8 {
+		return "", fmt.Errorf("bit count %d exceeds the %d bits of data", bitCount, len(payload)*8)
+	}
+	root, err := TreeFromCodes(codes)
+	if err != nil {
+		return "", err
+	}
+	return DecodeBytes(payload, int(bitCount), root)
+}
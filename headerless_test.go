@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestHeaderlessRoundTrip(t *testing.T) {
+	shared := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(benchmarkText(4 << 10))))
+	for _, text := range []string{"", "the", "one more message", "many words that are in the shared table"} {
+		data, err := EncodeHeaderless(text, shared)
+		if err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+		if container := encodeContainer(t, text, EncodeOptions{}); len(data) >= len(container) {
+			t.Errorf("%q: %d header-less bytes, container %d", text, len(data), len(container))
+		}
+		got, err := DecodeHeaderless(data, shared)
+		if err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+		if got != text {
+			t.Errorf("DecodeHeaderless = %q, want %q", got, text)
+		}
+	}
+}
+
+func TestHeaderlessErrors(t *testing.T) {
+	codes := map[rune]string{'a': "0", 'b': "10", 'c': "11"}
+	if _, err := EncodeHeaderless("abz", codes); err == nil {
+		t.Error("EncodeHeaderless accepted a symbol missing from the table")
+	}
+	if _, err := EncodeHeaderless("ab\xff", codes); err == nil {
+		t.Error("EncodeHeaderless accepted invalid UTF-8")
+	}
+	data, err := EncodeHeaderless("abcabcaaa", codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeHeaderless(data, nil); err != errNoTable {
+		t.Errorf("no table: error %v, want errNoTable", err)
+	}
+	if _, err := DecodeHeaderless(nil, codes); err == nil {
+		t.Error("no error for missing data")
+	}
+	if _, err := DecodeHeaderless(data[:len(data)-1], codes); err == nil {
+		t.Error("no error for a truncated payload")
+	}
+	if _, err := DecodeHeaderless(data, map[rune]string{'a': "0", 'b': "01"}); err == nil {
+		t.Error("no error for a table that is not a prefix code")
+	}
+	if got, err := DecodeHeaderless(data, map[rune]string{'x': "0", 'y': "10", 'z': "11"}); err != nil || got != "xyzxyzxxx" {
+		t.Errorf("another table of the same shape: %q, %v", got, err)
+	}
+}
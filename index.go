@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// An index is a sidecar file, saved next to a container with the
+// indexSuffix, mapping offsets in the original text to offsets in the
+// payload, so DecodeRange can start decoding near the bytes it needs. Its
+// layout is:
+//
+//	magic     "HUFI"
+//	count     uvarint, number of entries
+//	entries   count pairs of uvarints: the offset and payload bit offset,
+//	          each minus those of the previous entry
+//	crc       uint32 big-endian, CRC-32 of every byte above
+const (
+	indexMagic  = "HUFI"
+	indexSuffix = ".idx"
+)
+
+// IndexEntry marks a symbol boundary: the symbol starting at byte Offset
+// of the original text starts at bit Bit of the payload
+type IndexEntry struct {
+	Offset int64
+	Bit    int64
+}
+
+// BuildIndex returns index entries for text coded in the container
+// described by h, one at the first symbol boundary at or after every
+// interval bytes of text, starting with the boundary at offset 0. It fails
+// for run-length coded containers, whose symbols may stand for many bytes,
+// and for footer containers.
+func BuildIndex(text string, h *HuffHeader, interval int) ([]IndexEntry, error) {
+	if interval < 1 {
+		return nil, fmt.Errorf("invalid index interval %d", interval)
+	}
+	if h.Flags&(FlagRLE|FlagFooter) != 0 {
+		return nil, errors.New("container cannot be indexed: it is run-length coded or has a footer")
+	}
+	lengths := CodeLengths(h.Tree)
+	entries := []IndexEntry{{}}
+	next := int64(interval)
+	var offset, bit int64
+	for offset < int64(len(text)) {
+		if offset >= next {
+			entries = append(entries, IndexEntry{Offset: offset, Bit: bit})
+			next = offset - offset%int64(interval) + int64(interval)
+		}
+		char, size := rune(text[offset]), 1
+		if h.Flags&FlagBytes == 0 {
+			char, size = utf8.DecodeRuneInString(text[offset:])
+		}
+		length, ok := lengths[char]
+		if !ok {
+			return nil, fmt.Errorf("symbol %q is not in the code table", char)
+		}
+		offset += int64(size)
+		bit += int64(length)
+	}
+	return entries, nil
+}
+
+// WriteIndex writes index entries to w in the sidecar layout
+func WriteIndex(w io.Writer, entries []IndexEntry) error {
+	data := append([]byte(indexMagic), binary.AppendUvarint(nil, uint64(len(entries)))...)
+	var prev IndexEntry
+	for _, e := range entries {
+		if e.Offset < prev.Offset || e.Bit < prev.Bit {
+			return errors.New("index entries are not in order")
+		}
+		data = binary.AppendUvarint(data, uint64(e.Offset-prev.Offset))
+		data = binary.AppendUvarint(data, uint64(e.Bit-prev.Bit))
+		prev = e
+	}
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	_, err := w.Write(data)
+	return err
+}
+
+// ReadIndex reads index entries written by WriteIndex
+func ReadIndex(r io.Reader) ([]IndexEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(indexMagic)+4 || string(data[:len(indexMagic)]) != indexMagic {
+		return nil, errors.New("not an index file")
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+		return nil, errors.New("index checksum mismatch")
+	}
+	br := bytes.NewReader(body[len(indexMagic):])
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if count > uint64(br.Len())/2 {
+		return nil, fmt.Errorf("index count %d exceeds the remaining %d bytes", count, br.Len())
+	}
+	entries := make([]IndexEntry, count)
+	var prev IndexEntry
+	for i := range entries {
+		offset, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		bit, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		prev = IndexEntry{Offset: prev.Offset + int64(offset), Bit: prev.Bit + int64(bit)}
+		if prev.Offset < 0 || prev.Bit < 0 {
+			return nil, errors.New("index offset overflows")
+		}
+		entries[i] = prev
+	}
+	if br.Len() != 0 {
+		return nil, errors.New("unexpected data after the index entries")
+	}
+	return entries, nil
+}
+
+// DecodeRange decodes bytes [start, end) of the original text of the
+// container at path. If the index sidecar path+".idx" exists, decoding
+// starts at the last entry at or before start, so only the bits from
+// there on are read; otherwise it starts at the beginning of the payload.
+// A range starting inside a multi-byte rune begins with the rest of its
+// bytes. Only part of the text is decoded, so the checksum cannot be
+// verified.
+func DecodeRange(path string, start, end int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h, err := readHuffHeader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	if h.Flags&(FlagRLE|FlagFooter) != 0 {
+		return nil, errors.New("ranges cannot be decoded from a run-length coded or footer container")
+	}
+	if start < 0 || end < start || uint64(end) > h.OriginalSize {
+		return nil, fmt.Errorf("invalid range [%d, %d) of %d bytes", start, end, h.OriginalSize)
+	}
+
+	var from IndexEntry
+	if idx, err := os.Open(path + indexSuffix); err == nil {
+		entries, err := ReadIndex(idx)
+		idx.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading index: %w", err)
+		}
+		for _, e := range entries {
+			if e.Offset > start {
+				break
+			}
+			from = e
+		}
+		if uint64(from.Bit) > h.BitCount {
+			return nil, fmt.Errorf("index entry at bit %d is past the %d bit payload", from.Bit, h.BitCount)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if _, err := f.Seek(int64(h.Size())+from.Bit/8, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var r io.Reader = bufio.NewReader(f)
+	if h.Flags&FlagLSBFirst != 0 {
+		r = lsbFirstReader{r}
+	}
+	d := NewDecoder(r, h.DecodingTree(), int(h.BitCount)-int(from.Bit/8*8))
+	d.bytes = h.Flags&FlagBytes != 0
+	for i := int64(0); i < from.Bit%8; i++ {
+		if _, err := d.bits.readBit(); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	if _, err := io.CopyN(io.Discard, d, start-from.Offset); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	out := make([]byte, end-start)
+	if _, err := io.ReadFull(d, out); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return out, nil
+}
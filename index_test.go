@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeIndexed writes text as a container at dir/name, and with a positive
+// interval its index sidecar, returning the container path
+func writeIndexed(t *testing.T, dir, name, text string, opts EncodeOptions, interval int) string {
+	t.Helper()
+	path := writeContainer(t, dir, name, text, opts)
+	if interval > 0 {
+		h, _, err := BuildHuffFile(text, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := BuildIndex(text, h, interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := WriteIndex(&buf, entries); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path+indexSuffix, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestBuildIndex(t *testing.T) {
+	text := strings.Repeat("índex entries fall on rune boundaries 日本 ", 20)
+	h, _, err := BuildHuffFile(text, EncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := BuildCodes(h.Tree)
+	const interval = 50
+	entries, err := BuildIndex(text, h, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < len(text)/interval || entries[0] != (IndexEntry{}) {
+		t.Fatalf("%d entries starting at %+v for %d bytes", len(entries), entries[0], len(text))
+	}
+	for i, e := range entries[1:] {
+		if e.Offset < int64(i+1)*interval || e.Offset >= int64(i+1)*interval+4 {
+			t.Errorf("entry %d at offset %d, want the first boundary from %d", i+1, e.Offset, (i+1)*interval)
+		}
+		if want := len(Encode(text[:e.Offset], codes)); e.Bit != int64(want) {
+			t.Errorf("entry %d at bit %d, want %d", i+1, e.Bit, want)
+		}
+	}
+
+	if _, err := BuildIndex(text, h, 0); err == nil {
+		t.Error("BuildIndex accepted an interval of 0")
+	}
+	rle, _, err := BuildHuffFile(text, EncodeOptions{RLE: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildIndex(text, rle, interval); err == nil {
+		t.Error("BuildIndex accepted a run-length coded container")
+	}
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	for _, entries := range [][]IndexEntry{
+		{},
+		{{}},
+		{{}, {Offset: 100, Bit: 433}, {Offset: 203, Bit: 871}, {Offset: 1 << 40, Bit: 1 << 42}},
+	} {
+		var buf bytes.Buffer
+		if err := WriteIndex(&buf, entries); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadIndex(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, entries) {
+			t.Errorf("ReadIndex = %v, want %v", got, entries)
+		}
+	}
+	if err := WriteIndex(&bytes.Buffer{}, []IndexEntry{{Offset: 10, Bit: 40}, {Offset: 5, Bit: 50}}); err == nil {
+		t.Error("WriteIndex accepted entries out of order")
+	}
+}
+
+func TestReadIndexCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, []IndexEntry{{}, {Offset: 100, Bit: 433}}); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	// withChecksum appends a valid checksum to body, so the layout checks
+	// are reached
+	withChecksum := func(body []byte) []byte {
+		return binary.BigEndian.AppendUint32(bytes.Clone(body), crc32.ChecksumIEEE(body))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("HUFX"), valid[4:]...)},
+		{"bad checksum", append(bytes.Clone(valid[:len(valid)-1]), valid[len(valid)-1]^1)},
+		{"flipped entry", append(append(bytes.Clone(valid[:6]), valid[6]^1), valid[7:]...)},
+		{"count too large", withChecksum([]byte("HUFI\x7f\x00\x00"))},
+		{"truncated entry", withChecksum([]byte("HUFI\x01\x00"))},
+		{"trailing data", withChecksum(append(bytes.Clone(valid[:len(valid)-4]), 0))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadIndex(bytes.NewReader(tt.data)); err == nil {
+				t.Errorf("ReadIndex accepted %x", tt.data)
+			}
+		})
+	}
+}
+
+func TestDecodeRange(t *testing.T) {
+	text := strings.Repeat("ranges decode from the nearest índex entry 日本語; ", 60)
+	inRune := int64(strings.Index(text, "日") + 1)
+	ranges := [][2]int64{
+		{0, 0},
+		{0, int64(len(text))},
+		{0, 10},
+		{777, 1500},
+		{int64(len(text)) - 5, int64(len(text))},
+		{inRune, inRune + 20},
+	}
+	modes := []EncodeOptions{{}, {Compact: true}, {LSBFirst: true}, {Bytes: true}}
+	for _, opts := range modes {
+		for _, interval := range []int{0, 64, 1000} {
+			name := modeName(opts) + "/no index"
+			if interval > 0 {
+				name = fmt.Sprintf("%s/index every %d", modeName(opts), interval)
+			}
+			t.Run(name, func(t *testing.T) {
+				path := writeIndexed(t, t.TempDir(), "range.huff", text, opts, interval)
+				for _, r := range ranges {
+					got, err := DecodeRange(path, r[0], r[1])
+					if err != nil {
+						t.Fatalf("[%d, %d): %v", r[0], r[1], err)
+					}
+					if want := text[r[0]:r[1]]; string(got) != want {
+						t.Errorf("[%d, %d) = %q, want %q", r[0], r[1], got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeRangeErrors(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("a corrupt index is reported, not trusted ", 30)
+	path := writeIndexed(t, dir, "in.huff", text, EncodeOptions{}, 100)
+
+	for _, r := range [][2]int64{{-1, 5}, {10, 5}, {0, int64(len(text)) + 1}} {
+		if _, err := DecodeRange(path, r[0], r[1]); err == nil {
+			t.Errorf("DecodeRange accepted [%d, %d)", r[0], r[1])
+		}
+	}
+
+	index, err := os.ReadFile(path + indexSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index[len(index)/2] ^= 0xff
+	if err := os.WriteFile(path+indexSuffix, index, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeRange(path, 500, 510); err == nil {
+		t.Error("DecodeRange used a corrupt index")
+	}
+
+	// An entry past the payload passes the checksum but not the bounds
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, []IndexEntry{{}, {Offset: 100, Bit: 1 << 30}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+indexSuffix, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeRange(path, 500, 510); err == nil {
+		t.Error("DecodeRange followed an index entry past the payload")
+	}
+
+	rle := writeContainer(t, dir, "rle.huff", text, EncodeOptions{RLE: true})
+	if _, err := DecodeRange(rle, 0, 10); err == nil {
+		t.Error("DecodeRange accepted a run-length coded container")
+	}
+	if _, err := DecodeRange(filepath.Join(dir, "missing.huff"), 0, 1); err == nil {
+		t.Error("DecodeRange accepted a missing container")
+	}
+}
+
+func TestEncodeIndexFlag(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("encode -index writes the sidecar 日本 ", 50)
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runCLI(t, dir, "encode", "-index", "128", "in.txt", "out.huff"); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	f, err := os.Open(filepath.Join(dir, "out.huff"+indexSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := ReadIndex(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != (len(text)+127)/128 {
+		t.Errorf("%d index entries for %d bytes at an interval of 128", len(entries), len(text))
+	}
+	got, err := DecodeRange(filepath.Join(dir, "out.huff"), 1000, 1100)
+	if err != nil || string(got) != text[1000:1100] {
+		t.Errorf("DecodeRange = %q, %v; want %q", got, err, text[1000:1100])
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestInteropFixtures decodes the containers in testdata/interop, written
+// by make_fixtures.py there: an independent Python canonical Huffman
+// encoder sharing no code with this package. Each must decode byte for
+// byte to the original .txt next to it.
+func TestInteropFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "interop", "*.huff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Skip("no interop fixtures in testdata/interop")
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".huff")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(strings.TrimSuffix(path, ".huff") + ".txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := ReadHuffHeader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Flags&FlagCanonical == 0 {
+				t.Errorf("fixture flags %#x lack FlagCanonical", h.Flags)
+			}
+			_, text, err := ReadHuffFile(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal([]byte(text), want) {
+				t.Errorf("decoded %q, want %q", text, want)
+			}
+
+			// The payload must also decode from the code lengths alone
+			payload := data[h.Size():]
+			text, err = DecodeCanonical(payload, int(h.BitCount), CodeLengths(h.Tree))
+			if err != nil || text != string(want) {
+				t.Errorf("DecodeCanonical = %q, %v", text, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// EncodeInts Huffman-codes a sequence of integers, such as quantized
+// samples, building the frequency table over the integer values. The
+// returned data is the payload bit count as a uvarint followed by the
+// packed payload; the codes map is needed to decode it.
+func EncodeInts(values []int) ([]byte, map[int]string, error) {
+	counts := make(map[int]int)
+	for _, v := range values {
+		counts[v]++
+	}
+
+	// The tree is built over symbol IDs that index the sorted values
+	distinct := make([]int, 0, len(counts))
+	for v := range counts {
+		distinct = append(distinct, v)
+	}
+	sort.Ints(distinct)
+	frequency := make(map[rune]int, len(distinct))
+	for id, v := range distinct {
+		frequency[rune(id)] = counts[v]
+	}
+	idCodes := make(map[rune]string, len(distinct))
+	GenerateHuffmanCodes(BuildHuffmanTree(frequency), "", idCodes)
+
+	codes := make(map[int]string, len(distinct))
+	for id, v := range distinct {
+		codes[v] = idCodes[rune(id)]
+	}
+	encoded := make([]byte, 0, len(values))
+	for _, v := range values {
+		encoded = append(encoded, codes[v]...)
+	}
+	payload, bitCount := PackBits(string(encoded))
+	return append(binary.AppendUvarint(nil, uint64(bitCount)), payload...), codes, nil
+}
+
+// DecodeInts decodes data produced by EncodeInts using its codes map
+func DecodeInts(data []byte, codes map[int]string) ([]int, error) {
+	bitCount, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errors.New("invalid bit count prefix")
+	}
+	payload := data[n:]
+	if bitCount > uint64(len(payload))*8 {
+		return nil, fmt.Errorf("bit count %d exceeds the %d bits of data", bitCount, len(payload)*8)
+	}
+
+	distinct := make([]int, 0, len(codes))
+	for v := range codes {
+		distinct = append(distinct, v)
+	}
+	sort.Ints(distinct)
+	idCodes := make(map[rune]string, len(distinct))
+	for id, v := range distinct {
+		idCodes[rune(id)] = codes[v]
+	}
+	root, err := TreeFromCodes(idCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []int
+	err = decodeSymbols(payload, int(bitCount), root, func(id rune) error {
+		values = append(values, distinct[id])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
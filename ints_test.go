@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestEncodeIntsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+	}{
+		{"empty", nil},
+		{"single value", []int{7}},
+		{"repeated value", []int{-3, -3, -3, -3}},
+		{"samples", []int{0, 1, -1, 2, -2, 0, 0, 1, 0, -1, 0, 3}},
+		{"negative", []int{-1, -1000, -5, -1, -1, -1000}},
+		{"large", []int{math.MaxInt, math.MinInt, 1 << 40, -(1 << 40), math.MaxInt, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, codes, err := EncodeInts(tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeInts(data, codes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.values) {
+				t.Errorf("DecodeInts = %v, want %v", got, tt.values)
+			}
+		})
+	}
+}
+
+func TestDecodeIntsErrors(t *testing.T) {
+	data, codes, err := EncodeInts([]int{1, 2, 2, 3, 3, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeInts(nil, codes); err == nil {
+		t.Error("no error for missing data")
+	}
+	if _, err := DecodeInts(data[:len(data)-1], codes); err == nil {
+		t.Error("no error for a truncated payload")
+	}
+	if _, err := DecodeInts(data, map[int]string{1: "0", 2: "01"}); err == nil {
+		t.Error("no error for codes that are not a prefix code")
+	}
+}
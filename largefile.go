@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// CompressFileStreaming compresses inPath into a .huff container at outPath
+// in two passes over the input, never holding the whole input or output in
+// memory. The first pass counts frequencies and checksums the input; the
+// second encodes it straight into the output file, which is written
+// atomically with opts.
+func CompressFileStreaming(inPath, outPath string, opts AtomicOptions) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Pass one: frequencies, size and checksum
+	frequency := make(map[rune]int)
+	header := &HuffHeader{Version: versionFor(0)}
+	crc := crc32.NewIEEE()
+	br := bufio.NewReader(io.TeeReader(in, crc))
+	for {
+		char, size, err := br.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if char == utf8.RuneError && size == 1 {
+			return errors.New("input is not valid UTF-8")
+		}
+		frequency[char]++
+		header.OriginalSize += uint64(size)
+		header.SymbolCount++
+	}
+	header.Checksum = crc.Sum32()
+	header.Tree = BuildHuffmanTree(frequency)
+	header.BitCount = uint64(EstimateCompressedBits(frequency))
+
+	// Pass two: encode directly into the output
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	codes := BuildCodes(header.Tree)
+	return writeFileAtomicFunc(outPath, opts, func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		if _, err := bw.Write(header.appendTo(nil)); err != nil {
+			return err
+		}
+		enc := NewEncoder(bw, codes)
+		if _, err := io.Copy(enc, in); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		if uint64(enc.BitCount()) != header.BitCount || enc.Checksum() != header.Checksum {
+			return errors.New("input changed between passes")
+		}
+		return bw.Flush()
+	})
+}
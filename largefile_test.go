@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCompressFileStreaming(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes a large file")
+	}
+	const size = 8 << 20
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "large.txt")
+	outPath := filepath.Join(dir, "large.huff")
+	f, err := os.Create(inPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	chunk := benchmarkText(64<<10) + "ünïcödé\n"
+	for written := 0; written < size; written += len(chunk) {
+		w.WriteString(chunk)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if err := CompressFileStreaming(inPath, outPath, AtomicOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	// Buffers and the tree only; holding the input or the output would
+	// allocate several times this
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("allocated %d bytes compressing a %d byte file", allocated, size)
+	}
+
+	input, err := os.ReadFile(inPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, text, err := ReadHuffFile(bytes.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != string(input) {
+		t.Error("output does not decode to the input")
+	}
+	if want := encodeContainer(t, string(input), EncodeOptions{}); !bytes.Equal(output, want) {
+		t.Error("output differs from WriteHuffFile's container")
+	}
+}
@@ -2,12 +2,23 @@ package main
 
 import (
 	"container/heap"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
-// HuffmanNode represents a node in the Huffman Tree
+// HuffmanNode represents a node in the Huffman Tree.
+// Nothing in this package modifies a tree after it is built, so a tree and
+// the codes map generated from it are safe to share between goroutines
+// running Encode, Decode and the other decoders concurrently.
 type HuffmanNode struct {
 	character rune
 	frequency int
@@ -15,14 +26,20 @@ type HuffmanNode struct {
 	right     *HuffmanNode
 }
 
-// HuffmanHeap implements heap.Interface for HuffmanNode
+// HuffmanHeap implements heap.Interface for HuffmanNode.
+// Entries are never nil; Push panics rather than letting a nil node
+// surface later as a dereference inside Less.
 type HuffmanHeap []*HuffmanNode
 
 func (h HuffmanHeap) Len() int           { return len(h) }
 func (h HuffmanHeap) Less(i, j int) bool { return h[i].frequency < h[j].frequency }
 func (h HuffmanHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
 func (h *HuffmanHeap) Push(x interface{}) {
-	*h = append(*h, x.(*HuffmanNode))
+	node, _ := x.(*HuffmanNode)
+	if node == nil {
+		panic("huffman: nil node pushed onto HuffmanHeap")
+	}
+	*h = append(*h, node)
 }
 func (h *HuffmanHeap) Pop() interface{} {
 	old := *h
@@ -41,36 +58,241 @@ func BuildFrequencyTable(text string) map[rune]int {
 	return frequency
 }
 
-// BuildHuffmanTree builds a Huffman tree based on character frequencies
+// BuildFrequencyTableFromRuneReader counts the runes of r, such as a
+// bufio.Reader, until io.EOF. The reader decodes each rune, so runes are
+// never split across reads. Unlike BuildFrequencyTable it is strict: an
+// invalid UTF-8 sequence, which r reports as utf8.RuneError of size 1,
+// fails with its byte offset rather than being counted as U+FFFD.
+func BuildFrequencyTableFromRuneReader(r io.RuneReader) (map[rune]int, error) {
+	frequency := make(map[rune]int)
+	offset := 0
+	for {
+		char, size, err := r.ReadRune()
+		if err == io.EOF {
+			return frequency, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if char == utf8.RuneError && size == 1 {
+			return nil, fmt.Errorf("input is not valid UTF-8 at byte %d", offset)
+		}
+		frequency[char]++
+		offset += size
+	}
+}
+
+// MergeStrategy selects how MergeFrequencyTables combines the counts of a
+// symbol found in more than one table
+type MergeStrategy int
+
+const (
+	// MergeSum adds the counts, as if the texts were concatenated
+	MergeSum MergeStrategy = iota
+	// MergeMax keeps the largest count, so a large prior table is not
+	// inflated by a document it already covers
+	MergeMax
+	// MergeAverage takes the mean over all tables, counting a table
+	// without the symbol as zero, rounded up so that every symbol keeps a
+	// positive count. It weighs each table equally whatever its size.
+	MergeAverage
+)
+
+// MergeFrequencyTables combines frequency tables into a new table holding
+// every symbol of any of them, combining repeated symbols by strategy
+func MergeFrequencyTables(strategy MergeStrategy, tables ...map[rune]int) map[rune]int {
+	merged := make(map[rune]int)
+	for _, table := range tables {
+		for char, count := range table {
+			switch strategy {
+			case MergeMax:
+				if current, ok := merged[char]; !ok || count > current {
+					merged[char] = count
+				}
+			default:
+				merged[char] += count
+			}
+		}
+	}
+	if strategy == MergeAverage && len(tables) > 0 {
+		for char, sum := range merged {
+			merged[char] = (sum + len(tables) - 1) / len(tables)
+		}
+	}
+	return merged
+}
+
+// BuildFrequencyTableConcurrent counts text like BuildFrequencyTable but
+// splits it into chunks counted by up to workers goroutines, for large
+// inputs on multi-core machines
+func BuildFrequencyTableConcurrent(text string, workers int) map[rune]int {
+	chunks := splitAtRuneStarts(text, workers)
+	tables := make([]map[rune]int, len(chunks))
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk string) {
+			defer wg.Done()
+			tables[i] = BuildFrequencyTable(chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	frequency := make(map[rune]int)
+	for _, table := range tables {
+		for char, count := range table {
+			frequency[char] += count
+		}
+	}
+	return frequency
+}
+
+// splitAtRuneStarts splits text into at most n chunks of roughly equal
+// size. Each cut is moved forward past continuation bytes to the start of
+// the next rune, so no rune is split between chunks. Since a rune never
+// absorbs a following rune start, this holds for invalid UTF-8 too.
+func splitAtRuneStarts(text string, n int) []string {
+	n = max(min(n, len(text)), 1)
+	chunks := make([]string, 0, n)
+	start := 0
+	for i := 1; i <= n && start < len(text); i++ {
+		end := len(text) * i / n
+		for end > start && end < len(text) && !utf8.RuneStart(text[end]) {
+			end++
+		}
+		if end > start {
+			chunks = append(chunks, text[start:end])
+			start = end
+		}
+	}
+	return chunks
+}
+
+// ApplyTransform maps every rune of text through transform, dropping
+// runes for which it returns false. Transforming text before compression is
+// lossy: decoding yields the transformed text, not the original.
+func ApplyTransform(text string, transform func(rune) (rune, bool)) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+	for _, char := range text {
+		if mapped, keep := transform(char); keep {
+			sb.WriteRune(mapped)
+		}
+	}
+	return sb.String()
+}
+
+// SymbolFreq is a symbol and its frequency
+type SymbolFreq struct {
+	Symbol rune
+	Freq   int
+}
+
+// SortKey selects the order of SortSymbols
+type SortKey int
+
+const (
+	// BySymbol orders by code point
+	BySymbol SortKey = iota
+	// ByFrequency orders from least to most frequent
+	ByFrequency
+	// ByFrequencyDesc orders from most to least frequent
+	ByFrequencyDesc
+	// ByCodeLength orders by the length of each symbol's code in the tree
+	// BuildHuffmanTree builds from the table, shortest first, which is the
+	// canonical code order. Symbols without a code, having a count of zero
+	// or less, come last.
+	ByCodeLength
+)
+
+// SortSymbols converts a frequency table to a slice in the order of by.
+// Ties are broken by code point, so the same table always gives the same
+// slice.
+func SortSymbols(frequency map[rune]int, by SortKey) []SymbolFreq {
+	pairs := make([]SymbolFreq, 0, len(frequency))
+	for char, freq := range frequency {
+		pairs = append(pairs, SymbolFreq{Symbol: char, Freq: freq})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Symbol < pairs[j].Symbol })
+	switch by {
+	case ByFrequency:
+		sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Freq < pairs[j].Freq })
+	case ByFrequencyDesc:
+		sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Freq > pairs[j].Freq })
+	case ByCodeLength:
+		lengths := CodeLengths(BuildHuffmanTree(frequency))
+		key := func(char rune) int {
+			if length, ok := lengths[char]; ok {
+				return length
+			}
+			return math.MaxInt
+		}
+		sort.SliceStable(pairs, func(i, j int) bool { return key(pairs[i].Symbol) < key(pairs[j].Symbol) })
+	}
+	return pairs
+}
+
+// SortedSymbolFreqs converts a frequency table to a slice sorted by symbol,
+// giving tree builders a deterministic input order
+func SortedSymbolFreqs(frequency map[rune]int) []SymbolFreq {
+	return SortSymbols(frequency, BySymbol)
+}
+
+// BuildHuffmanTree builds a Huffman tree based on character frequencies.
+// Symbols with a count of zero or less are dropped rather than given codes
+// that would only waste header space; an empty table, or one with no
+// positive counts, yields a nil tree. The same table always yields the same
+// tree, since symbols are pushed in sorted order.
 func BuildHuffmanTree(frequency map[rune]int) *HuffmanNode {
+	return BuildHuffmanTreeFromSorted(positiveFreqs(SortedSymbolFreqs(frequency)))
+}
+
+// positiveFreqs drops the pairs with a count of zero or less, in place
+func positiveFreqs(pairs []SymbolFreq) []SymbolFreq {
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if pair.Freq > 0 {
+			kept = append(kept, pair)
+		}
+	}
+	return kept
+}
+
+// BuildHuffmanTreeFromSorted builds a Huffman tree from symbol frequencies
+// in the given order. Ties between equal frequencies depend only on that
+// order, so identical slices always produce identical trees.
+func BuildHuffmanTreeFromSorted(pairs []SymbolFreq) *HuffmanNode {
+	if len(pairs) == 0 {
+		return nil
+	}
 	h := &HuffmanHeap{}
 	heap.Init(h)
 
 	// Create a leaf node for each character and push it into the priority queue
-	for char, freq := range frequency {
-		heap.Push(h, &HuffmanNode{character: char, frequency: freq})
+	for _, pair := range pairs {
+		heap.Push(h, newNode(pair.Symbol, pair.Freq, nil, nil))
 	}
 
 	// Build the Huffman tree
 	for h.Len() > 1 {
 		left := heap.Pop(h).(*HuffmanNode)
 		right := heap.Pop(h).(*HuffmanNode)
-		heap.Push(h, &HuffmanNode{
-			frequency: left.frequency + right.frequency,
-			left:      left,
-			right:     right,
-		})
+		heap.Push(h, newNode(0, left.frequency+right.frequency, left, right))
 	}
 
 	return heap.Pop(h).(*HuffmanNode)
 }
 
-// GenerateHuffmanCodes generates Huffman codes by traversing the tree
+// GenerateHuffmanCodes generates Huffman codes by traversing the tree.
+// A tree with a single leaf gives that symbol the code "0".
 func GenerateHuffmanCodes(node *HuffmanNode, prefix string, codes map[rune]string) {
 	if node == nil {
 		return
 	}
 	if node.left == nil && node.right == nil {
+		if prefix == "" {
+			prefix = "0"
+		}
 		codes[node.character] = prefix
 		return
 	}
@@ -78,6 +300,142 @@ func GenerateHuffmanCodes(node *HuffmanNode, prefix string, codes map[rune]strin
 	GenerateHuffmanCodes(node.right, prefix+"1", codes)
 }
 
+// BuildCodes returns the code table for a tree: empty for a nil tree, and
+// {symbol: "0"} for a single leaf
+func BuildCodes(root *HuffmanNode) map[rune]string {
+	codes := make(map[rune]string)
+	GenerateHuffmanCodesIterative(root, codes)
+	return codes
+}
+
+// GenerateHuffmanCodesIterative generates the same codes as
+// GenerateHuffmanCodes with an explicit stack and one shared path buffer,
+// so the only allocation per symbol is its final code string
+func GenerateHuffmanCodesIterative(root *HuffmanNode, codes map[rune]string) {
+	WalkLeaves(root, func(char rune, code string) {
+		codes[char] = code
+	})
+}
+
+// WalkLeaves calls fn for every leaf of the tree with its symbol and code,
+// in code order: a leaf is visited before every leaf to its right, so the
+// codes arrive in lexicographic order. It uses an explicit stack and one
+// shared path buffer. A single leaf is visited with the code "0".
+func WalkLeaves(root *HuffmanNode, fn func(r rune, code string)) {
+	if root == nil {
+		return
+	}
+	if root.left == nil && root.right == nil {
+		fn(root.character, "0")
+		return
+	}
+	type frame struct {
+		node  *HuffmanNode
+		depth int
+		bit   byte
+	}
+	stack := []frame{{node: root.right, depth: 1, bit: '1'}, {node: root.left, depth: 1, bit: '0'}}
+	path := make([]byte, 0, 64)
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.node == nil {
+			continue
+		}
+		path = append(path[:f.depth-1], f.bit)
+		if f.node.left == nil && f.node.right == nil {
+			fn(f.node.character, string(path))
+			continue
+		}
+		stack = append(stack, frame{f.node.right, f.depth + 1, '1'}, frame{f.node.left, f.depth + 1, '0'})
+	}
+}
+
+// MirrorTree returns a copy of the tree with every node's children swapped,
+// which exchanges the '0' and '1' bits of every code
+func MirrorTree(node *HuffmanNode) *HuffmanNode {
+	if node == nil {
+		return nil
+	}
+	return &HuffmanNode{
+		character: node.character,
+		frequency: node.frequency,
+		left:      MirrorTree(node.right),
+		right:     MirrorTree(node.left),
+	}
+}
+
+// CodeLengths returns the code length of every symbol in the tree,
+// matching the codes GenerateHuffmanCodes assigns
+func CodeLengths(root *HuffmanNode) map[rune]int {
+	lengths := make(map[rune]int)
+	var walk func(node *HuffmanNode, depth int)
+	walk = func(node *HuffmanNode, depth int) {
+		if node == nil {
+			return
+		}
+		if node.left == nil && node.right == nil {
+			if depth == 0 {
+				depth = 1
+			}
+			lengths[node.character] = depth
+			return
+		}
+		walk(node.left, depth+1)
+		walk(node.right, depth+1)
+	}
+	walk(root, 0)
+	return lengths
+}
+
+// TreeDepth returns the longest code length of the tree: the number of
+// edges on its longest root-to-leaf path. It is 0 for an empty tree and 1
+// for a single leaf, which is coded with one bit.
+func TreeDepth(root *HuffmanNode) int {
+	if root == nil {
+		return 0
+	}
+	if root.left == nil && root.right == nil {
+		return 1
+	}
+	return edgeDepth(root)
+}
+
+// edgeDepth returns the number of edges on the longest path from node to
+// a leaf
+func edgeDepth(node *HuffmanNode) int {
+	if node == nil || (node.left == nil && node.right == nil) {
+		return 0
+	}
+	return 1 + max(edgeDepth(node.left), edgeDepth(node.right))
+}
+
+// TreeLeafCount returns the number of leaves in the tree, which is the
+// size of its alphabet
+func TreeLeafCount(root *HuffmanNode) int {
+	if root == nil {
+		return 0
+	}
+	if root.left == nil && root.right == nil {
+		return 1
+	}
+	return TreeLeafCount(root.left) + TreeLeafCount(root.right)
+}
+
+// Rebalance returns an optimal tree over the alphabet of root for fresh
+// frequencies, such as when root was built from stale or capped
+// statistics. Symbols of root that freq lacks or counts as zero are given
+// a frequency of 1 so they keep a code; symbols freq has but root lacks
+// are ignored. root itself is left unchanged.
+func Rebalance(root *HuffmanNode, freq map[rune]int) *HuffmanNode {
+	alphabet := CodeLengths(root)
+	frequency := make(map[rune]int, len(alphabet))
+	for char := range alphabet {
+		frequency[char] = max(freq[char], 1)
+	}
+	return BuildHuffmanTree(frequency)
+}
+
 // Encode encodes the input text using Huffman codes
 func Encode(text string, codes map[rune]string) string {
 	encoded := ""
@@ -87,12 +445,15 @@ func Encode(text string, codes map[rune]string) string {
 	return encoded
 }
 
-// Decode decodes the binary string using the Huffman tree
+// Decode decodes the binary string using the Huffman tree.
+// It only reads the tree and is safe to call concurrently.
 func Decode(encoded string, root *HuffmanNode) string {
 	decoded := ""
 	node := root
 	for _, bit := range encoded {
-		if bit == '0' {
+		if root.left == nil && root.right == nil {
+			// A single-symbol tree: every bit is one occurrence
+		} else if bit == '0' {
 			node = node.left
 		} else {
 			node = node.right
@@ -105,45 +466,250 @@ func Decode(encoded string, root *HuffmanNode) string {
 	return decoded
 }
 
-// ReadFile reads the content of a file and returns it as a string
-func ReadFile(filename string) string {
-	content, err := ioutil.ReadFile(filename)
+// DecodeInto decodes a binary string like Decode but appends the UTF-8
+// text to dst and returns the extended slice, so a caller decoding many
+// messages can reuse one buffer, passing it back as dst[:0]. Unlike Decode
+// it reports invalid bits, codes and trailing partial codes; on error dst
+// is returned unextended.
+func DecodeInto(dst []byte, encoded string, root *HuffmanNode) ([]byte, error) {
+	start := len(dst)
+	if root == nil {
+		if encoded != "" {
+			return dst, errors.New("cannot decode with an empty tree")
+		}
+		return dst, nil
+	}
+	node := root
+	for i := 0; i < len(encoded); i++ {
+		bit := encoded[i]
+		if bit != '0' && bit != '1' {
+			return dst[:start], fmt.Errorf("invalid bit %q at offset %d", bit, i)
+		}
+		if root.left == nil && root.right == nil {
+			// A single-symbol tree: every bit is one occurrence
+		} else if bit == '0' {
+			node = node.left
+		} else {
+			node = node.right
+		}
+		if node == nil {
+			return dst[:start], decodeErrorAt(i, errInvalidCode)
+		}
+		if node.left == nil && node.right == nil {
+			dst = utf8.AppendRune(dst, node.character)
+			node = root
+		}
+	}
+	if node != root {
+		return dst[:start], decodeErrorAt(len(encoded), errTruncatedCode)
+	}
+	return dst, nil
+}
+
+// DecodeBytes decodes the first bitCount bits of a packed payload using the
+// Huffman tree
+func DecodeBytes(data []byte, bitCount int, root *HuffmanNode) (string, error) {
+	decoded, err := DecodeBytesRecover(data, bitCount, root)
 	if err != nil {
-		log.Fatalf("Failed to read file: %v", err)
+		return "", err
 	}
-	return string(content)
+	return decoded, nil
+}
+
+// DecodeBytesRecover decodes like DecodeBytes, but on corrupt input it
+// returns the symbols decoded before the failure along with the error.
+// The partial output is best-effort: corruption may have changed symbols
+// before the point where it was detected.
+func DecodeBytesRecover(data []byte, bitCount int, root *HuffmanNode) (string, error) {
+	var sb strings.Builder
+	err := decodeSymbols(data, bitCount, root, func(char rune) error {
+		sb.WriteRune(char)
+		return nil
+	})
+	return sb.String(), err
 }
 
-// WriteToFile writes a string to a file
-func WriteToFile(filename, content string) {
-	err := ioutil.WriteFile(filename, []byte(content), 0644)
+// DecodeBytesMapped decodes like DecodeBytes but writes each symbol found
+// in substitutions as its replacement string, so a payload coded over
+// compact symbols can expand to longer text. The output length then no
+// longer matches the original.
+func DecodeBytesMapped(data []byte, bitCount int, root *HuffmanNode, substitutions map[rune]string) (string, error) {
+	var sb strings.Builder
+	err := decodeSymbols(data, bitCount, root, func(char rune) error {
+		if sub, ok := substitutions[char]; ok {
+			sb.WriteString(sub)
+		} else {
+			sb.WriteRune(char)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatalf("Failed to write to file: %v", err)
+		return "", err
 	}
+	return sb.String(), nil
 }
 
-func main() {
-	// Read the input text from input.txt
-	inputText := ReadFile("input.txt")
+// ctxCheckInterval is how many symbols DecodeBytesContext decodes between
+// checks of its context
+const ctxCheckInterval = 4096
 
-	// Build frequency table and Huffman Tree
-	frequency := BuildFrequencyTable(inputText)
-	huffmanTree := BuildHuffmanTree(frequency)
+// DecodeBytesContext decodes like DecodeBytes but stops once ctx is done,
+// bounding the time spent on untrusted input. The context is checked
+// before decoding starts and then every ctxCheckInterval symbols, so a
+// cancellation takes effect within 4096 symbols, a few microseconds of
+// work, rather than at once. On cancellation it returns the text decoded
+// so far along with ctx.Err().
+func DecodeBytesContext(ctx context.Context, data []byte, bitCount int, root *HuffmanNode) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	n := 0
+	err := decodeSymbols(data, bitCount, root, func(char rune) error {
+		if n++; n%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		sb.WriteRune(char)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		return "", err
+	}
+	return sb.String(), err
+}
 
-	// Generate Huffman Codes
-	codes := make(map[rune]string)
-	GenerateHuffmanCodes(huffmanTree, "", codes)
+// DecodeBytesTimeout decodes like DecodeBytesContext with a context that
+// expires after timeout, returning the partial text and
+// context.DeadlineExceeded if decoding takes longer
+func DecodeBytesTimeout(data []byte, bitCount int, root *HuffmanNode, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return DecodeBytesContext(ctx, data, bitCount, root)
+}
 
-	// Encode the input text
-	encoded := Encode(inputText, codes)
-	// Write the encoded text to encoded.txt
-	WriteToFile("encoded.txt", encoded)
+// UnexpectedSymbolError is returned by DecodeBytesAllowed when a decoded
+// symbol is outside the allowed set, which usually means corrupt data
+type UnexpectedSymbolError struct {
+	Symbol rune
+	Offset int // byte offset of the symbol in the decoded text
+}
 
-	// Decode the encoded text
-	decoded := Decode(encoded, huffmanTree)
-	// Write the decoded text to decoded.txt
-	WriteToFile("decoded.txt", decoded)
+func (e *UnexpectedSymbolError) Error() string {
+	return fmt.Sprintf("unexpected symbol %q at offset %d", e.Symbol, e.Offset)
+}
 
-	fmt.Println("Encoding and decoding complete. Check encoded.txt and decoded.txt files.")
+// DecodeBytesAllowed decodes like DecodeBytes but fails with an
+// *UnexpectedSymbolError at the first symbol for which allowed returns
+// false, e.g. a non-ASCII symbol in data known to be ASCII
+func DecodeBytesAllowed(data []byte, bitCount int, root *HuffmanNode, allowed func(rune) bool) (string, error) {
+	var sb strings.Builder
+	err := decodeSymbols(data, bitCount, root, func(char rune) error {
+		if !allowed(char) {
+			return &UnexpectedSymbolError{Symbol: char, Offset: sb.Len()}
+		}
+		sb.WriteRune(char)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return sb.String(), nil
 }
 
+// decodeSymbols walks bitCount bits of packed data through the tree,
+// calling emit with each decoded symbol and stopping at the first error
+// emit returns
+func decodeSymbols(data []byte, bitCount int, root *HuffmanNode, emit func(rune) error) error {
+	if bitCount > len(data)*8 {
+		return fmt.Errorf("bit count %d exceeds the %d bits of data", bitCount, len(data)*8)
+	}
+	if root == nil {
+		if bitCount > 0 {
+			return errors.New("cannot decode with an empty tree")
+		}
+		return nil
+	}
+	node := root
+	single := root.left == nil && root.right == nil
+	for i := 0; i < bitCount; i++ {
+		if single {
+			// A single-symbol tree: every bit is one occurrence
+		} else if data[i/8]&(0x80>>(i%8)) == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+		if node == nil {
+			return decodeErrorAt(i, errInvalidCode)
+		}
+		if node.left == nil && node.right == nil {
+			if err := emit(node.character); err != nil {
+				return err
+			}
+			node = root
+		}
+	}
+	if node != root {
+		return decodeErrorAt(bitCount, errTruncatedCode)
+	}
+	return nil
+}
+
+// DecodeChan decodes the binary string like Decode but emits each rune on the
+// returned channel as soon as it is decoded. The rune channel is closed when
+// decoding finishes; the error channel then yields at most one error and is
+// closed too. Callers must drain the rune channel.
+func DecodeChan(encoded string, root *HuffmanNode) (<-chan rune, <-chan error) {
+	out := make(chan rune, 64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(out)
+		if root == nil {
+			if encoded != "" {
+				errc <- errors.New("cannot decode with an empty tree")
+			}
+			return
+		}
+		node := root
+		for i, bit := range encoded {
+			switch {
+			case root.left == nil && root.right == nil:
+				// A single-symbol tree: every bit is one occurrence
+			case bit == '0':
+				node = node.left
+			case bit == '1':
+				node = node.right
+			default:
+				errc <- fmt.Errorf("invalid bit %q at offset %d", bit, i)
+				return
+			}
+			if node == nil {
+				errc <- decodeErrorAt(i, errInvalidCode)
+				return
+			}
+			if node.left == nil && node.right == nil {
+				out <- node.character
+				node = root
+			}
+		}
+		if node != root {
+			errc <- decodeErrorAt(len(encoded), errTruncatedCode)
+		}
+	}()
+	return out, errc
+}
+
+// ReadFile reads the content of a file and returns it as a string
+func ReadFile(filename string) (string, error) {
+	content, err := os.ReadFile(filename)
+	return string(content), err
+}
+
+// WriteToFile writes a string to a file atomically, creating it with the
+// given permission bits
+func WriteToFile(filename, content string, perm os.FileMode) error {
+	return WriteFileAtomicMode(filename, []byte(content), perm)
+}
@@ -0,0 +1,784 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
+)
+
+// roundTripTexts is a small corpus shared by the tests of the core
+// functions
+var roundTripTexts = []struct {
+	name string
+	text string
+}{
+	{"single symbol", "aaaa"},
+	{"two symbols", "abababba"},
+	{"sentence", "the quick brown fox jumps over the lazy dog"},
+	{"unicode", "日本語のテキスト, ünïcödé and emoji 🙂🙂"},
+	{"skewed", "aaaaaaaaaaaaaaaabbbbbbbbccccdde"},
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			root := BuildHuffmanTree(BuildFrequencyTable(tt.text))
+			codes := BuildCodes(root)
+			if !IsPrefixCode(codes) {
+				t.Fatalf("codes are not a prefix code: %v", codes)
+			}
+			if got := Decode(Encode(tt.text, codes), root); got != tt.text {
+				t.Errorf("Decode = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestHeapPushNil(t *testing.T) {
+	tests := []struct {
+		name string
+		x    interface{}
+	}{
+		{"untyped nil", nil},
+		{"nil node", (*HuffmanNode)(nil)},
+		{"wrong type", "node"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HuffmanHeap{{frequency: 1}}
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Push(%#v) did not panic", tt.x)
+				}
+				if h.Len() != 1 {
+					t.Errorf("heap has %d entries after a rejected push, want 1", h.Len())
+				}
+			}()
+			heap.Push(h, tt.x)
+		})
+	}
+}
+
+func TestDecodeChan(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			root := BuildHuffmanTree(BuildFrequencyTable(tt.text))
+			out, errc := DecodeChan(Encode(tt.text, BuildCodes(root)), root)
+			var sb strings.Builder
+			for char := range out {
+				sb.WriteRune(char)
+			}
+			if err := <-errc; err != nil {
+				t.Fatalf("DecodeChan: %v", err)
+			}
+			if sb.String() != tt.text {
+				t.Errorf("DecodeChan = %q, want %q", sb.String(), tt.text)
+			}
+		})
+	}
+}
+
+func TestDecodeChanErrors(t *testing.T) {
+	root := BuildHuffmanTree(BuildFrequencyTable("abc"))
+	tests := []struct {
+		name    string
+		encoded string
+		root    *HuffmanNode
+		want    error
+	}{
+		{"truncated code", Encode("abc", BuildCodes(root))[:1], root, errTruncatedCode},
+		{"empty tree", "01", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errc := DecodeChan(tt.encoded, tt.root)
+			for range out {
+			}
+			err := <-errc
+			if err == nil {
+				t.Fatal("DecodeChan reported no error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// benchmarkText returns n bytes of text built from a fixed word list with
+// a fixed seed, so every benchmark run decodes the same input
+func benchmarkText(n int) string {
+	words := strings.Fields("the of and to in is was that for it with as his on be at by had are but from or have an they which one you were her all she there would their we him been has when who will more no if out so said what up its about into than them can only other new some could time these two may then do first any my now such like our over man me even most made after also did many before must through back years where much your way well down should because each just those people how too little state good very make world still own see men work long get here between both life being under never day same another know while last might us great old year off come since against go came right used take three")
+	rng := rand.New(rand.NewSource(1))
+	var sb strings.Builder
+	for sb.Len() < n {
+		sb.WriteString(words[rng.Intn(len(words))])
+		sb.WriteByte(' ')
+	}
+	return sb.String()[:n]
+}
+
+// decodeBenchmarkSizes are the text sizes the decode benchmarks run at.
+// Decode concatenates strings, so its cost grows quadratically.
+var decodeBenchmarkSizes = []int{256, 1 << 10, 8 << 10}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, size := range decodeBenchmarkSizes {
+		text := benchmarkText(size)
+		root := BuildHuffmanTree(BuildFrequencyTable(text))
+		encoded := Encode(text, BuildCodes(root))
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				Decode(encoded, root)
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+	for _, size := range decodeBenchmarkSizes {
+		text := benchmarkText(size)
+		root := BuildHuffmanTree(BuildFrequencyTable(text))
+		payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := DecodeBytes(payload, bitCount, root); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// codeGenerationTrees returns the trees the code generation test and
+// benchmarks run on
+func codeGenerationTrees() []struct {
+	name string
+	root *HuffmanNode
+} {
+	large := make(map[rune]int)
+	for i := 0; i < 20000; i++ {
+		large[rune(0x4e00+i)] = 1 + i%97
+	}
+	balanced := make(map[rune]int)
+	for i := 0; i < 1<<14; i++ {
+		balanced[rune(i)] = 1
+	}
+	// A chain with one leaf per level, far deeper than any count table
+	// that fits an int could produce
+	skewed := &HuffmanNode{character: 0}
+	for i := 1; i < 5000; i++ {
+		skewed = &HuffmanNode{left: &HuffmanNode{character: rune(i)}, right: skewed}
+	}
+	return []struct {
+		name string
+		root *HuffmanNode
+	}{
+		{"large alphabet", BuildHuffmanTree(large)},
+		{"balanced", BuildHuffmanTree(balanced)},
+		{"deep skewed", skewed},
+	}
+}
+
+func TestGenerateHuffmanCodesIterative(t *testing.T) {
+	trees := append(codeGenerationTrees(), []struct {
+		name string
+		root *HuffmanNode
+	}{
+		{"nil", nil},
+		{"single leaf", BuildHuffmanTree(map[rune]int{'a': 3})},
+	}...)
+	for _, tt := range trees {
+		recursive, iterative := make(map[rune]string), make(map[rune]string)
+		GenerateHuffmanCodes(tt.root, "", recursive)
+		GenerateHuffmanCodesIterative(tt.root, iterative)
+		if !maps.Equal(recursive, iterative) {
+			t.Errorf("%s: iterative codes differ from recursive ones", tt.name)
+		}
+	}
+}
+
+func BenchmarkGenerateHuffmanCodes(b *testing.B) {
+	for _, tt := range codeGenerationTrees() {
+		recursive, iterative := make(map[rune]string), make(map[rune]string)
+		GenerateHuffmanCodes(tt.root, "", recursive)
+		GenerateHuffmanCodesIterative(tt.root, iterative)
+		if !maps.Equal(recursive, iterative) {
+			b.Fatalf("%s: iterative codes differ from recursive ones", tt.name)
+		}
+		b.Run(tt.name+"/recursive", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				GenerateHuffmanCodes(tt.root, "", make(map[rune]string))
+			}
+		})
+		b.Run(tt.name+"/iterative", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				GenerateHuffmanCodesIterative(tt.root, make(map[rune]string))
+			}
+		})
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		t.Run(tt.name, func(t *testing.T) {
+			root := BuildHuffmanTree(BuildFrequencyTable(tt.text))
+			encoded := Encode(tt.text, BuildCodes(root))
+			got, err := DecodeInto([]byte("prefix:"), encoded, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "prefix:" + Decode(encoded, root); string(got) != want {
+				t.Errorf("DecodeInto = %q, want %q", got, want)
+			}
+
+			buf := make([]byte, 0, len(tt.text))
+			allocs := testing.AllocsPerRun(10, func() {
+				buf, _ = DecodeInto(buf[:0], encoded, root)
+			})
+			if allocs != 0 {
+				t.Errorf("DecodeInto into a large enough buffer made %v allocations", allocs)
+			}
+		})
+	}
+}
+
+func TestDecodeIntoErrors(t *testing.T) {
+	// Codes a=0, b=10, c=11
+	root := treeFromSpec(t, map[rune]int{'a': 1, 'b': 2, 'c': 2})
+	tests := []struct {
+		name    string
+		encoded string
+		root    *HuffmanNode
+		want    error
+	}{
+		{"invalid bit", "02", root, nil},
+		{"truncated code", "01", root, errTruncatedCode},
+		{"empty tree", "0", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, err := DecodeInto([]byte("kept"), tt.encoded, tt.root)
+			if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+			if string(dst) != "kept" {
+				t.Errorf("dst extended to %q on error", dst)
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	for _, size := range decodeBenchmarkSizes {
+		text := benchmarkText(size)
+		root := BuildHuffmanTree(BuildFrequencyTable(text))
+		encoded := Encode(text, BuildCodes(root))
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			var buf []byte
+			for i := 0; i < b.N; i++ {
+				var err error
+				if buf, err = DecodeInto(buf[:0], encoded, root); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestTreeDepthAndLeafCount(t *testing.T) {
+	leaf := func(char rune) *HuffmanNode { return &HuffmanNode{character: char, frequency: 1} }
+	join := func(left, right *HuffmanNode) *HuffmanNode {
+		return &HuffmanNode{frequency: left.frequency + right.frequency, left: left, right: right}
+	}
+	tests := []struct {
+		name   string
+		root   *HuffmanNode
+		depth  int
+		leaves int
+	}{
+		{"empty", nil, 0, 0},
+		{"single leaf", leaf('a'), 1, 1},
+		{"two leaves", join(leaf('a'), leaf('b')), 1, 2},
+		{"balanced", join(join(leaf('a'), leaf('b')), join(leaf('c'), leaf('d'))), 2, 4},
+		{"chain", join(leaf('a'), join(leaf('b'), join(leaf('c'), join(leaf('d'), leaf('e'))))), 4, 5},
+		{"lopsided", join(join(join(leaf('a'), leaf('b')), leaf('c')), leaf('d')), 3, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TreeDepth(tt.root); got != tt.depth {
+				t.Errorf("TreeDepth = %d, want %d", got, tt.depth)
+			}
+			if got := TreeLeafCount(tt.root); got != tt.leaves {
+				t.Errorf("TreeLeafCount = %d, want %d", got, tt.leaves)
+			}
+			if tt.root == nil {
+				return
+			}
+			// The depth is the longest code length
+			longest := 0
+			for _, length := range CodeLengths(tt.root) {
+				longest = max(longest, length)
+			}
+			if longest != tt.depth {
+				t.Errorf("longest code length %d, TreeDepth %d", longest, tt.depth)
+			}
+		})
+	}
+}
+
+func TestBuildHuffmanTreeDeterministic(t *testing.T) {
+	// Many ties, so any dependence on map order would show
+	symbols := []rune("abcdefghijklmnopqrstuvwxyzäöü日本")
+	rng := rand.New(rand.NewSource(1))
+	var want map[rune]string
+	var wantPairs []SymbolFreq
+	for i := 0; i < 50; i++ {
+		frequency := make(map[rune]int)
+		for _, j := range rng.Perm(len(symbols)) {
+			frequency[symbols[j]] = 1 + j%4
+		}
+		pairs := SortedSymbolFreqs(frequency)
+		for k := 1; k < len(pairs); k++ {
+			if pairs[k-1].Symbol >= pairs[k].Symbol {
+				t.Fatalf("SortedSymbolFreqs is not sorted by symbol: %v", pairs)
+			}
+		}
+		codes := BuildCodes(BuildHuffmanTreeFromSorted(pairs))
+		if i == 0 {
+			want, wantPairs = codes, pairs
+			continue
+		}
+		if !slices.Equal(pairs, wantPairs) {
+			t.Fatalf("build %d: SortedSymbolFreqs = %v, want %v", i, pairs, wantPairs)
+		}
+		if !maps.Equal(codes, want) {
+			t.Fatalf("build %d: codes %v, want %v", i, codes, want)
+		}
+		if got := BuildCodes(BuildHuffmanTree(frequency)); !maps.Equal(got, want) {
+			t.Fatalf("build %d: BuildHuffmanTree codes %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestDecodeBytesRecover(t *testing.T) {
+	// a = 0, b = 10, and 11 is not a code
+	incomplete := treeFromSpec(t, map[rune]int{'a': 1, 'b': 2})
+	full := BuildHuffmanTree(BuildFrequencyTable("aaaabbc"))
+	fullCodes := BuildCodes(full)
+	tests := []struct {
+		name    string
+		root    *HuffmanNode
+		bits    string
+		want    string
+		offset  int
+		wantErr error
+	}{
+		{"invalid code", incomplete, "0100101" + "1" + "00", "abab", 7, errInvalidCode},
+		{"invalid first code", incomplete, "11", "", 1, errInvalidCode},
+		{"truncated tail", full, Encode("aabca", fullCodes) + fullCodes['c'][:1], "aabca", len(Encode("aabca", fullCodes)) + 1, errTruncatedCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, bitCount := PackBits(tt.bits)
+			got, err := DecodeBytesRecover(payload, bitCount, tt.root)
+			if got != tt.want {
+				t.Errorf("recovered %q, want %q", got, tt.want)
+			}
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Fatalf("error %v, want a DecodeError", err)
+			}
+			if de.BitOffset != tt.offset || de.ByteOffset != tt.offset/8 || !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v at bit %d", err, tt.wantErr, tt.offset)
+			}
+			if text, err := DecodeBytes(payload, bitCount, tt.root); text != "" || err == nil {
+				t.Errorf("DecodeBytes = %q, %v; want no text and an error", text, err)
+			}
+		})
+	}
+}
+
+func TestBuildCodes(t *testing.T) {
+	leaf := func(char rune) *HuffmanNode { return &HuffmanNode{character: char, frequency: 1} }
+	join := func(left, right *HuffmanNode) *HuffmanNode {
+		return &HuffmanNode{frequency: left.frequency + right.frequency, left: left, right: right}
+	}
+	tests := []struct {
+		name string
+		root *HuffmanNode
+		want map[rune]string
+	}{
+		{"nil tree", nil, map[rune]string{}},
+		{"single leaf", leaf('a'), map[rune]string{'a': "0"}},
+		{"two leaves", join(leaf('a'), leaf('b')), map[rune]string{'a': "0", 'b': "1"}},
+		{"multi-leaf", join(leaf('a'), join(join(leaf('b'), leaf('日')), leaf('d'))),
+			map[rune]string{'a': "0", 'b': "100", '日': "101", 'd': "11"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildCodes(tt.root)
+			if got == nil || !maps.Equal(got, tt.want) {
+				t.Errorf("BuildCodes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildHuffmanTreeZeroCounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency map[rune]int
+		want      []rune
+	}{
+		{"one zero count", map[rune]int{'a': 5, 'b': 3, 'z': 0}, []rune("ab")},
+		{"negative count", map[rune]int{'a': 5, 'b': 3, 'n': -1}, []rune("ab")},
+		{"one positive count", map[rune]int{'a': 5, 'z': 0}, []rune("a")},
+		{"only zero counts", map[rune]int{'y': 0, 'z': 0}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := BuildHuffmanTree(tt.frequency)
+			codes := BuildCodes(root)
+			var got []rune
+			for char := range codes {
+				got = append(got, char)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("codes for %q, want %q", got, tt.want)
+			}
+			if tt.want == nil && root != nil {
+				t.Error("non-nil tree without positive counts")
+			}
+		})
+	}
+
+	// A prior still reserves a code for a zero count
+	root := BuildHuffmanTreeWithPrior(map[rune]int{'a': 5, 'b': 3}, map[rune]int{'z': 0})
+	if _, ok := BuildCodes(root)['z']; !ok {
+		t.Error("prior with a zero count got no code")
+	}
+}
+
+func TestDecodeBytesAllowed(t *testing.T) {
+	isASCII := func(char rune) bool { return char < 0x80 }
+	tests := []struct {
+		name   string
+		text   string
+		symbol rune
+		offset int // byte offset of the rejected symbol, or -1
+	}{
+		{"all allowed", "plain ASCII text", 0, -1},
+		{"empty", "", 0, -1},
+		{"rejected first", "é and more", 'é', 0},
+		{"rejected later", "naïve", 'ï', 2},
+		{"after multi-byte", "ab\x7f日", '日', 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Code every symbol, so the rejection is by allowed alone
+			root := BuildHuffmanTree(BuildFrequencyTable(tt.text + "é日"))
+			payload, bitCount := PackBits(Encode(tt.text, BuildCodes(root)))
+			got, err := DecodeBytesAllowed(payload, bitCount, root, isASCII)
+			if tt.offset < 0 {
+				if err != nil || got != tt.text {
+					t.Errorf("DecodeBytesAllowed = %q, %v; want %q", got, err, tt.text)
+				}
+				return
+			}
+			var symErr *UnexpectedSymbolError
+			if !errors.As(err, &symErr) {
+				t.Fatalf("error %v, want an UnexpectedSymbolError", err)
+			}
+			if symErr.Symbol != tt.symbol || symErr.Offset != tt.offset || got != "" {
+				t.Errorf("rejected %q at %d with output %q, want %q at %d", symErr.Symbol, symErr.Offset, got, tt.symbol, tt.offset)
+			}
+		})
+	}
+}
+
+func TestBuildFrequencyTableConcurrent(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"ASCII", benchmarkText(1000)},
+		// Every split point is likely to land inside a rune
+		{"multi-byte", strings.Repeat("日本語🙂é", 97)},
+		{"one rune", "🙂"},
+		{"invalid UTF-8", strings.Repeat("a\xe6\x97\xff日\x80\x80🙂", 31)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := BuildFrequencyTable(tt.text)
+			for workers := 0; workers <= 17; workers++ {
+				chunks := splitAtRuneStarts(tt.text, workers)
+				if strings.Join(chunks, "") != tt.text {
+					t.Fatalf("%d workers: chunks do not join to the text", workers)
+				}
+				if len(chunks) > max(workers, 1) {
+					t.Errorf("%d workers: %d chunks", workers, len(chunks))
+				}
+				for i, chunk := range chunks {
+					if chunk == "" || !utf8.RuneStart(chunk[0]) {
+						t.Errorf("%d workers: chunk %d starts inside a rune: %q", workers, i, chunk)
+					}
+				}
+				if got := BuildFrequencyTableConcurrent(tt.text, workers); !maps.Equal(got, want) {
+					t.Errorf("%d workers: %v, want %v", workers, got, want)
+				}
+			}
+		})
+	}
+}
+
+// cancelAfter is a context whose Err reports cancellation from its nth
+// call on, so a test can cancel at an exact point of a decode
+type cancelAfter struct {
+	context.Context
+	n, calls int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.calls++; c.calls >= c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestDecodeBytesContext(t *testing.T) {
+	text := strings.Repeat("x", 3*ctxCheckInterval) + strings.Repeat("y", ctxCheckInterval)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	data, bitCount := PackBits(Encode(text, BuildCodes(root)))
+
+	got, err := DecodeBytesContext(context.Background(), data, bitCount, root)
+	if err != nil || got != text {
+		t.Fatalf("uncancelled decode = %d bytes, %v", len(got), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got, err := DecodeBytesContext(ctx, data, bitCount, root); err != context.Canceled || got != "" {
+		t.Errorf("cancelled before decoding = %d bytes, %v; want none and context.Canceled", len(got), err)
+	}
+
+	// Cancelled at the second check: the symbol that triggers it is not
+	// emitted, so the partial text is one short of the interval
+	ctx = &cancelAfter{Context: context.Background(), n: 2}
+	got, err = DecodeBytesContext(ctx, data, bitCount, root)
+	if err != context.Canceled {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	if got != text[:ctxCheckInterval-1] {
+		t.Errorf("cancelled decode returned %d bytes, want %d", len(got), ctxCheckInterval-1)
+	}
+
+	// Bad input still fails with the decode error while ctx is live
+	if _, err := DecodeBytesContext(context.Background(), data, len(data)*8+1, root); err == nil || err == context.Canceled {
+		t.Errorf("bit count beyond the data: error = %v", err)
+	}
+}
+
+func TestDecodeBytesTimeout(t *testing.T) {
+	text := "the quick brown fox jumps over the lazy dog"
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	data, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	if got, err := DecodeBytesTimeout(data, bitCount, root, time.Minute); err != nil || got != text {
+		t.Errorf("DecodeBytesTimeout = %q, %v", got, err)
+	}
+	if got, err := DecodeBytesTimeout(data, bitCount, root, 0); err != context.DeadlineExceeded || got != "" {
+		t.Errorf("expired timeout = %q, %v; want none and context.DeadlineExceeded", got, err)
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	stale := BuildHuffmanTree(map[rune]int{'a': 1, 'b': 2, 'c': 4, 'd': 8, 'e': 16})
+	before := BuildCodes(stale)
+	fresh := map[rune]int{'a': 16, 'b': 8, 'c': 4, 'd': 0, 'z': 100}
+
+	root := Rebalance(stale, fresh)
+	if !maps.Equal(BuildCodes(stale), before) {
+		t.Error("Rebalance changed the original tree")
+	}
+	lengths := CodeLengths(root)
+	if _, ok := lengths['z']; ok || len(lengths) != len(before) {
+		t.Errorf("alphabet %v, want that of the original tree", lengths)
+	}
+	kept := map[rune]int{'a': 16, 'b': 8, 'c': 4, 'd': 1, 'e': 1}
+	if !maps.Equal(lengths, CodeLengths(BuildHuffmanTree(kept))) {
+		t.Errorf("code lengths %v, want those of an optimal tree for %v", lengths, kept)
+	}
+	staleCost, _, _ := lengthStats(stale, kept)
+	cost, _, _ := lengthStats(root, kept)
+	if cost >= staleCost {
+		t.Errorf("rebalanced tree costs %d bits, stale tree %d", cost, staleCost)
+	}
+
+	if got := Rebalance(nil, fresh); got != nil {
+		t.Error("Rebalance of an empty tree is not empty")
+	}
+	single := Rebalance(BuildHuffmanTree(map[rune]int{'q': 3}), fresh)
+	if TreeLeafCount(single) != 1 || single.character != 'q' {
+		t.Error("Rebalance of a single-symbol tree lost its symbol")
+	}
+}
+
+func TestWalkLeaves(t *testing.T) {
+	// A chain deeper than the initial path buffer: leaf i has i ones and
+	// then a zero, and the last leaf all ones
+	const depth = 100
+	chain := &HuffmanNode{character: depth}
+	for i := depth - 1; i >= 0; i-- {
+		chain = &HuffmanNode{left: &HuffmanNode{character: rune(i)}, right: chain}
+	}
+
+	trees := []struct {
+		name string
+		root *HuffmanNode
+	}{
+		{"single leaf", BuildHuffmanTree(map[rune]int{'a': 3})},
+		{"sentence", BuildHuffmanTree(BuildFrequencyTable("the quick brown fox jumps over the lazy dog"))},
+		{"unicode", BuildHuffmanTree(BuildFrequencyTable("αβγαβγααα日本"))},
+		{"deep chain", chain},
+	}
+	for _, tt := range trees {
+		t.Run(tt.name, func(t *testing.T) {
+			var codes []string
+			walked := make(map[rune]string)
+			WalkLeaves(tt.root, func(char rune, code string) {
+				codes = append(codes, code)
+				walked[char] = code
+			})
+			if !maps.Equal(walked, BuildCodes(tt.root)) {
+				t.Errorf("WalkLeaves codes %v, want %v", walked, BuildCodes(tt.root))
+			}
+			if !slices.IsSorted(codes) {
+				t.Errorf("codes visited out of order: %v", codes)
+			}
+		})
+	}
+
+	WalkLeaves(chain, func(char rune, code string) {
+		if want := strings.Repeat("1", int(char)) + "0"; char < depth && code != want {
+			t.Errorf("leaf %d: code %q, want %q", char, code, want)
+		}
+	})
+	WalkLeaves(nil, func(rune, string) { t.Error("WalkLeaves visited a leaf of an empty tree") })
+}
+
+func TestBuildFrequencyTableFromRuneReader(t *testing.T) {
+	texts := append(roundTripTexts, struct{ name, text string }{"replacement character", "a\uFFFDb\uFFFD"})
+	for _, tt := range texts {
+		t.Run(tt.name, func(t *testing.T) {
+			// A small buffer over one-byte reads puts runes across refills
+			r := bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(tt.text)), 16)
+			got, err := BuildFrequencyTableFromRuneReader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := BuildFrequencyTable(tt.text); !maps.Equal(got, want) {
+				t.Errorf("frequency table %v, want %v", got, want)
+			}
+		})
+	}
+
+	_, err := BuildFrequencyTableFromRuneReader(strings.NewReader("ab日\xffc"))
+	if err == nil || !strings.Contains(err.Error(), "byte 5") {
+		t.Errorf("invalid UTF-8: error = %v, want one at byte 5", err)
+	}
+	errRead := errors.New("read failed")
+	r := bufio.NewReader(io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(errRead)))
+	if _, err := BuildFrequencyTableFromRuneReader(r); err != errRead {
+		t.Errorf("reader failure: error = %v, want %v", err, errRead)
+	}
+}
+
+func TestSortSymbols(t *testing.T) {
+	// Code lengths are e 1, d 2, c 3, and a and b 4; z has no code
+	frequency := map[rune]int{'e': 8, 'd': 4, 'c': 2, 'b': 1, 'a': 1, 'z': 0}
+	tests := []struct {
+		name string
+		by   SortKey
+		want string
+	}{
+		{"by symbol", BySymbol, "abcdez"},
+		{"by frequency", ByFrequency, "zabcde"},
+		{"by frequency descending", ByFrequencyDesc, "edcabz"},
+		{"by code length", ByCodeLength, "edcabz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				// Copying into a fresh map changes its iteration order
+				copied := maps.Clone(frequency)
+				var got []rune
+				for _, pair := range SortSymbols(copied, tt.by) {
+					if pair.Freq != frequency[pair.Symbol] {
+						t.Errorf("%q has count %d, want %d", pair.Symbol, pair.Freq, frequency[pair.Symbol])
+					}
+					got = append(got, pair.Symbol)
+				}
+				if string(got) != tt.want {
+					t.Fatalf("run %d: order %q, want %q", i, string(got), tt.want)
+				}
+			}
+		})
+	}
+	if got := SortSymbols(nil, ByCodeLength); len(got) != 0 {
+		t.Errorf("SortSymbols of an empty table = %v", got)
+	}
+}
+
+func TestMergeFrequencyTables(t *testing.T) {
+	a := map[rune]int{'x': 4, 'y': 1}
+	b := map[rune]int{'x': 2, 'z': 3}
+	c := map[rune]int{'x': 3, 'y': 2}
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		tables   []map[rune]int
+		want     map[rune]int
+	}{
+		{"sum", MergeSum, []map[rune]int{a, b, c}, map[rune]int{'x': 9, 'y': 3, 'z': 3}},
+		{"max", MergeMax, []map[rune]int{a, b, c}, map[rune]int{'x': 4, 'y': 2, 'z': 3}},
+		// A table lacking a symbol counts as 0, so every mean is exact here
+		{"average", MergeAverage, []map[rune]int{a, b, c}, map[rune]int{'x': 3, 'y': 1, 'z': 1}},
+		// Means of 3.5 and 1.5 round up rather than to even
+		{"average rounds up", MergeAverage, []map[rune]int{a, c}, map[rune]int{'x': 4, 'y': 2}},
+		// A mean of 0.25 rounds up to 1, so the symbol keeps a code
+		{"average of a rare symbol", MergeAverage, []map[rune]int{{'q': 1}, {}, {}, {}}, map[rune]int{'q': 1}},
+		{"single table", MergeAverage, []map[rune]int{a}, a},
+		{"no tables", MergeSum, nil, map[rune]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeFrequencyTables(tt.strategy, tt.tables...); !maps.Equal(got, tt.want) {
+				t.Errorf("MergeFrequencyTables = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if a['x'] != 4 || len(b) != 2 {
+		t.Error("MergeFrequencyTables changed its input tables")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "time"
+
+// OpMetrics describes one completed encode or decode operation
+type OpMetrics struct {
+	Op          string // "encode" or "decode"
+	InputBytes  int
+	OutputBytes int
+	Symbols     int
+	Duration    time.Duration
+}
+
+// MetricsHook, when non-nil, is called after every successful
+// WriteHuffFile and ReadHuffFile so services can export per-operation
+// metrics without this package importing a metrics library. Set it before
+// starting any operations; it may be called from many goroutines at once.
+var MetricsHook func(OpMetrics)
+
+// startOp returns the start time of an operation, skipping the clock read
+// when no hook is installed
+func startOp() time.Time {
+	if MetricsHook == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// reportOp passes an operation's metrics to the hook, if any
+func reportOp(op string, start time.Time, in, out, symbols int) {
+	if hook := MetricsHook; hook != nil {
+		hook(OpMetrics{Op: op, InputBytes: in, OutputBytes: out, Symbols: symbols, Duration: time.Since(start)})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMetricsHook(t *testing.T) {
+	var got []OpMetrics
+	MetricsHook = func(m OpMetrics) { got = append(got, m) }
+	defer func() { MetricsHook = nil }()
+
+	text := "metrics for the encode and the decode of ünïcödé text"
+	var buf bytes.Buffer
+	if err := WriteHuffFile(&buf, text); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if _, _, err := ReadHuffFile(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	symbols := utf8.RuneCountInString(text)
+	want := []OpMetrics{
+		{Op: "encode", InputBytes: len(text), OutputBytes: len(data), Symbols: symbols},
+		{Op: "decode", InputBytes: len(data), OutputBytes: len(text), Symbols: symbols},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("hook called %d times, want %d: %+v", len(got), len(want), got)
+	}
+	for i, m := range got {
+		if m.Duration < 0 {
+			t.Errorf("%s: negative duration %v", m.Op, m.Duration)
+		}
+		m.Duration = 0
+		if m != want[i] {
+			t.Errorf("call %d: %+v, want %+v", i, m, want[i])
+		}
+	}
+
+	// Failed operations are not reported
+	got = nil
+	if _, _, err := ReadHuffFile(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Fatal("no error for a truncated container")
+	}
+	if len(got) != 0 {
+		t.Errorf("hook called for a failed decode: %+v", got)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import "math"
+
+// FreqModel accumulates symbol frequencies over a long-lived stream and
+// rebuilds its Huffman tree only once the statistics have drifted far
+// enough for the current tree to be noticeably worse than a fresh one
+type FreqModel struct {
+	freq      map[rune]int
+	total     int
+	tree      *HuffmanNode
+	lengths   map[rune]int
+	missing   bool    // a symbol was observed that the tree has no code for
+	threshold float64 // allowed growth in redundancy, in bits per symbol
+	redundant float64 // redundancy of the tree when it was built
+}
+
+// NewFreqModel returns an empty model that considers its tree stale once
+// the tree's average code length exceeds the entropy of the observed data
+// by threshold bits per symbol more than it did when the tree was built
+func NewFreqModel(threshold float64) *FreqModel {
+	return &FreqModel{freq: make(map[rune]int), threshold: threshold}
+}
+
+// Observe adds the symbols of text to the model's frequencies
+func (m *FreqModel) Observe(text string) {
+	for _, char := range text {
+		m.freq[char]++
+		m.total++
+		if m.tree != nil && m.lengths[char] == 0 {
+			m.missing = true
+		}
+	}
+}
+
+// Frequencies returns the frequencies observed so far. The map is owned by
+// the model and must not be modified.
+func (m *FreqModel) Frequencies() map[rune]int {
+	return m.freq
+}
+
+// TreeIfStale returns the model's tree and whether it was rebuilt by this
+// call. The tree is rebuilt when none exists yet, when a symbol without a
+// code has been observed, or when the observed statistics have drifted
+// beyond the threshold; otherwise the existing tree is returned. A model
+// that has observed nothing returns a nil tree.
+func (m *FreqModel) TreeIfStale() (*HuffmanNode, bool) {
+	if m.total == 0 {
+		return nil, false
+	}
+	if m.tree != nil && !m.missing && m.redundancy() <= m.redundant+m.threshold {
+		return m.tree, false
+	}
+	m.tree = BuildHuffmanTree(m.freq)
+	m.lengths = CodeLengths(m.tree)
+	m.missing = false
+	m.redundant = m.redundancy()
+	return m.tree, true
+}
+
+// redundancy returns how many bits per symbol the current tree spends on
+// the observed data beyond its entropy
+func (m *FreqModel) redundancy() float64 {
+	bits, entropy := 0.0, 0.0
+	for char, count := range m.freq {
+		p := float64(count) / float64(m.total)
+		bits += p * float64(m.lengths[char])
+		entropy -= p * math.Log2(p)
+	}
+	return bits - entropy
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFreqModel(t *testing.T) {
+	m := NewFreqModel(0.1)
+	if tree, rebuilt := m.TreeIfStale(); tree != nil || rebuilt {
+		t.Fatalf("empty model: tree %v, rebuilt %v", tree, rebuilt)
+	}
+
+	m.Observe(strings.Repeat("aaaabbc", 100))
+	first, rebuilt := m.TreeIfStale()
+	if first == nil || !rebuilt {
+		t.Fatal("no tree built on first use")
+	}
+
+	// More of the same does not rebuild
+	for i := 0; i < 5; i++ {
+		m.Observe("aaaabbc")
+		if tree, rebuilt := m.TreeIfStale(); rebuilt || tree != first {
+			t.Fatalf("rebuilt after observing the same distribution %d more times", i+1)
+		}
+	}
+
+	// A little drift stays within the threshold
+	m.Observe("cc")
+	if _, rebuilt := m.TreeIfStale(); rebuilt {
+		t.Error("rebuilt after slight drift")
+	}
+
+	// Heavy drift rebuilds, with c now the most frequent symbol
+	m.Observe(strings.Repeat("c", 2000))
+	second, rebuilt := m.TreeIfStale()
+	if !rebuilt || second == first {
+		t.Fatal("not rebuilt after significant drift")
+	}
+	lengths := CodeLengths(second)
+	if lengths['c'] >= lengths['a'] {
+		t.Errorf("after drift c has length %d, a %d", lengths['c'], lengths['a'])
+	}
+	if _, rebuilt := m.TreeIfStale(); rebuilt {
+		t.Error("rebuilt twice without new data")
+	}
+
+	// A symbol without a code always rebuilds
+	m.Observe("z")
+	third, rebuilt := m.TreeIfStale()
+	if !rebuilt {
+		t.Fatal("not rebuilt after observing a new symbol")
+	}
+	if _, ok := BuildCodes(third)['z']; !ok {
+		t.Error("new symbol has no code after the rebuild")
+	}
+	if got := m.Frequencies(); got['a'] != 420 || got['c'] != 2107 || got['z'] != 1 {
+		t.Errorf("Frequencies = %v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NGramCoding is a Huffman coding whose symbols are N-byte sequences
+// rather than single runes. Each distinct sequence is assigned a symbol ID,
+// and the tree is built over those IDs.
+type NGramCoding struct {
+	N       int
+	Symbols []string        // byte sequence for each symbol ID
+	Tree    *HuffmanNode    // leaves carry symbol IDs as their character
+	Codes   map[rune]string // codes keyed by symbol ID
+
+	ids map[string]rune
+}
+
+// SplitNGrams splits text into n-byte chunks; the final chunk holds any
+// trailing bytes and may be shorter than n
+func SplitNGrams(text string, n int) []string {
+	chunks := make([]string, 0, (len(text)+n-1)/n)
+	for len(text) > n {
+		chunks = append(chunks, text[:n])
+		text = text[n:]
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// BuildNGramCoding builds a Huffman coding over the n-byte sequences of text
+func BuildNGramCoding(text string, n int) (*NGramCoding, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid n-gram size %d", n)
+	}
+	counts := make(map[string]int)
+	for _, chunk := range SplitNGrams(text, n) {
+		counts[chunk]++
+	}
+
+	// Number the symbols in sorted order so the IDs are deterministic
+	c := &NGramCoding{N: n, ids: make(map[string]rune), Codes: make(map[rune]string)}
+	for symbol := range counts {
+		c.Symbols = append(c.Symbols, symbol)
+	}
+	sort.Strings(c.Symbols)
+	frequency := make(map[rune]int, len(c.Symbols))
+	for id, symbol := range c.Symbols {
+		c.ids[symbol] = rune(id)
+		frequency[rune(id)] = counts[symbol]
+	}
+
+	c.Tree = BuildHuffmanTree(frequency)
+	GenerateHuffmanCodes(c.Tree, "", c.Codes)
+	return c, nil
+}
+
+// Encode encodes text using the n-gram codes
+func (c *NGramCoding) Encode(text string) (string, error) {
+	var sb strings.Builder
+	for _, chunk := range SplitNGrams(text, c.N) {
+		id, ok := c.ids[chunk]
+		if !ok {
+			return "", fmt.Errorf("n-gram %q is not in the code table", chunk)
+		}
+		sb.WriteString(c.Codes[id])
+	}
+	return sb.String(), nil
+}
+
+// Decode decodes a binary string produced by Encode
+func (c *NGramCoding) Decode(encoded string) (string, error) {
+	var sb strings.Builder
+	ids, errc := DecodeChan(encoded, c.Tree)
+	for id := range ids {
+		sb.WriteString(c.Symbols[id])
+	}
+	if err := <-errc; err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// CompareNGramBits reports the payload size in bits of text coded one rune
+// at a time and coded as n-byte symbols, so callers can tell whether the
+// larger alphabet helped. Header cost is not included; note that the n-gram
+// symbol table grows much faster than the rune table.
+func CompareNGramBits(text string, n int) (runeBits, ngramBits int, err error) {
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+	runeBits = len(Encode(text, codes))
+
+	c, err := BuildNGramCoding(text, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	encoded, err := c.Encode(text)
+	if err != nil {
+		return 0, 0, err
+	}
+	return runeBits, len(encoded), nil
+}
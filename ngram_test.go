@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitNGrams(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want []string
+	}{
+		{"", 2, []string{}},
+		{"abcd", 2, []string{"ab", "cd"}},
+		{"abcde", 2, []string{"ab", "cd", "e"}},
+		{"abc", 5, []string{"abc"}},
+	}
+	for _, tt := range tests {
+		if got := SplitNGrams(tt.text, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitNGrams(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNGramRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		n    int
+	}{
+		{"pairs", strings.Repeat("abab cdcd ", 20), 2},
+		{"odd trailing byte", strings.Repeat("xy", 15) + "z", 2},
+		{"triples", strings.Repeat("the cat ", 12), 3},
+		{"single bytes", "hello", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := BuildNGramCoding(tt.text, tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := c.Encode(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := c.Decode(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != tt.text {
+				t.Errorf("Decode = %q, want %q", decoded, tt.text)
+			}
+		})
+	}
+}
+
+func TestCompareNGramBits(t *testing.T) {
+	text := strings.Repeat("abab", 50)
+	runeBits, ngramBits, err := CompareNGramBits(text, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "ab" is the only pair, so each costs one bit against two per rune
+	if ngramBits >= runeBits {
+		t.Errorf("2-gram coding took %d bits, rune coding %d; want fewer", ngramBits, runeBits)
+	}
+	if _, err := BuildNGramCoding(text, 0); err == nil {
+		t.Error("BuildNGramCoding accepted n = 0")
+	}
+}
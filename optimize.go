@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// OptimizeHuffFile recompresses a .huff container with an optimal table
+// built from its decoded text, keeping whichever of a tree or canonical
+// header is smaller. Every other option recorded in the header carries
+// over: the bit convention and order, byte or run-length coding, the
+// SHA-256 and frequency-ordered lengths, and the shortest code length, as
+// a floor in case the file was built with MinCodeLength. Files coded
+// with the static table usually shrink. If no rebuilt container is smaller
+// than data, data itself is returned. The result is decoded and compared
+// to the original text before it is returned.
+func OptimizeHuffFile(data []byte) ([]byte, error) {
+	_, text, err := ReadHuffFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	h, err := ReadHuffHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	minLength := 0
+	if h.Flags&(FlagStatic|FlagStored) == 0 {
+		for _, length := range CodeLengths(h.Tree) {
+			if minLength == 0 || length < minLength {
+				minLength = length
+			}
+		}
+	}
+
+	best := data
+	for _, compact := range []bool{false, true} {
+		opts := EncodeOptions{
+			LeftOne:        h.Flags&FlagLeftOne != 0,
+			Compact:        compact,
+			FrequencyOrder: h.Flags&FlagFreqOrder != 0,
+			Bytes:          h.Flags&FlagBytes != 0,
+			LSBFirst:       h.Flags&FlagLSBFirst != 0,
+			RLE:            h.Flags&FlagRLE != 0,
+			SHA256:         h.Flags&FlagSHA256 != 0,
+		}
+		if minLength > 1 {
+			opts.MinCodeLength = minLength
+		}
+		var buf bytes.Buffer
+		if err := WriteHuffFileWithOptions(&buf, text, opts); err != nil {
+			// A compact header cannot hold very long codes; the tree
+			// header still applies
+			if compact {
+				continue
+			}
+			return nil, err
+		}
+		if buf.Len() < len(best) {
+			best = buf.Bytes()
+		}
+	}
+
+	if len(best) != len(data) {
+		_, decoded, err := ReadHuffFile(bytes.NewReader(best))
+		if err != nil {
+			return nil, fmt.Errorf("verifying optimized file: %w", err)
+		}
+		if decoded != text {
+			return nil, fmt.Errorf("verifying optimized file: %w", ErrPayloadChecksum)
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOptimizeHuffFile(t *testing.T) {
+	text := strings.Repeat("zzzz qqqq xxxx, optimize me ", 40)
+	tests := []struct {
+		name string
+		opts EncodeOptions
+		keep uint32 // flags that must survive
+	}{
+		{"fast", EncodeOptions{Fast: true}, 0},
+		{"plain", EncodeOptions{}, 0},
+		{"left one", EncodeOptions{LeftOne: true}, FlagLeftOne},
+		{"lsb first", EncodeOptions{Fast: true, LSBFirst: true}, FlagLSBFirst},
+		{"sha256", EncodeOptions{Fast: true, SHA256: true}, FlagSHA256},
+		{"bytes", EncodeOptions{Bytes: true}, FlagBytes},
+		{"rle", EncodeOptions{RLE: true}, FlagRLE},
+		{"frequency order", EncodeOptions{FrequencyOrder: true}, FlagCanonical | FlagFreqOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeContainer(t, text, tt.opts)
+			optimized, err := OptimizeHuffFile(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(optimized) > len(data) {
+				t.Errorf("optimized to %d bytes from %d", len(optimized), len(data))
+			}
+			if tt.opts.Fast && len(optimized) >= len(data) {
+				t.Errorf("fast-mode file did not shrink: %d bytes", len(data))
+			}
+			h, decoded, err := readContainer(optimized)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != text {
+				t.Error("optimized file decodes to different text")
+			}
+			if h.Flags&tt.keep != tt.keep {
+				t.Errorf("flags %#x lost some of %#x", h.Flags, tt.keep)
+			}
+			if h.Flags&FlagSHA256 != 0 && !bytes.Equal(h.SHA256, mustHeader(t, data).SHA256) {
+				t.Error("SHA-256 changed")
+			}
+		})
+	}
+}
+
+func TestOptimizeKeepsMinCodeLength(t *testing.T) {
+	text := strings.Repeat("a", 100) + "bc"
+	data := encodeContainer(t, text, EncodeOptions{MinCodeLength: 3})
+	optimized, err := OptimizeHuffFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for char, length := range CodeLengths(mustHeader(t, optimized).Tree) {
+		if length < 3 {
+			t.Errorf("%q has a %d-bit code, shorter than the original minimum of 3", char, length)
+		}
+	}
+}
+
+// mustHeader returns the header of container data
+func mustHeader(t *testing.T, data []byte) *HuffHeader {
+	t.Helper()
+	h, err := ReadHuffHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// readContainer returns the header and decoded text of container data
+func readContainer(data []byte) (*HuffHeader, string, error) {
+	h, err := ReadHuffHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	_, text, err := ReadHuffFile(bytes.NewReader(data))
+	return h, text, err
+}
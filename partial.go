@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// DecodeBytesPartial decodes a payload that may have been cut short, such
+// as one received over a dropped connection. It decodes every complete
+// symbol in the first bitCount bits of data, or in all of data if that is
+// shorter, and returns the number of trailing bits discarded because they
+// only began a code. Unlike DecodeBytesRecover, truncation is not an error;
+// an invalid code still is.
+func DecodeBytesPartial(data []byte, bitCount int, root *HuffmanNode) (string, int, error) {
+	out := make([]byte, 0, len(data))
+	discarded, err := decodePartial(data, bitCount, root, func(char rune) error {
+		out = utf8.AppendRune(out, char)
+		return nil
+	})
+	return string(out), discarded, err
+}
+
+// decodePartial is DecodeBytesPartial calling emit with each symbol and
+// stopping at the first error emit returns
+func decodePartial(data []byte, bitCount int, root *HuffmanNode, emit func(rune) error) (int, error) {
+	bitCount = min(bitCount, len(data)*8)
+	if root == nil {
+		if bitCount > 0 {
+			return 0, errors.New("cannot decode with an empty tree")
+		}
+		return 0, nil
+	}
+	if root.left == nil && root.right == nil {
+		// A single-symbol tree: every bit is one occurrence
+		for i := 0; i < bitCount; i++ {
+			if err := emit(root.character); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	}
+	for i := 0; i < bitCount; {
+		char, next, err := walkFrom(data, bitCount, root, i)
+		if errors.Is(err, errTruncatedCode) {
+			return bitCount - i, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := emit(char); err != nil {
+			return 0, err
+		}
+		i = next
+	}
+	return 0, nil
+}
+
+// ReadHuffFilePartial reads a .huff container whose payload may be cut
+// short, returning the decoding tree, the text of every complete symbol,
+// and the number of payload bits discarded, counting both the bits of an
+// incomplete final code and any missing from the file. The checksum can
+// only be verified when nothing was discarded; a damaged header is still
+// an error.
+func ReadHuffFilePartial(r io.Reader) (*HuffmanNode, string, int, error) {
+	br := bufio.NewReader(r)
+	h, err := readHuffHeader(br)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if h.Flags&FlagFooter != 0 {
+		return nil, "", 0, errFooterUnsupported
+	}
+	payload, err := io.ReadAll(io.LimitReader(br, int64(h.PayloadSize())))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("reading payload: %w", err)
+	}
+	if h.Flags&FlagLSBFirst != 0 {
+		reverseBitOrder(payload)
+	}
+	tree := h.DecodingTree()
+
+	var out []byte
+	emit := func(char rune) error {
+		if h.Flags&FlagBytes != 0 {
+			out = append(out, byte(char))
+		} else {
+			out = utf8.AppendRune(out, char)
+		}
+		return nil
+	}
+	if h.Flags&FlagRLE != 0 {
+		emit = expandRuns(emit)
+	}
+	discarded, err := decodePartial(payload, int(h.BitCount), tree, emit)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	discarded += max(int(h.BitCount)-len(payload)*8, 0)
+	text := string(out)
+	if discarded == 0 {
+		if err := h.verify(text); err != nil {
+			return nil, "", 0, err
+		}
+	}
+	return tree, text, discarded, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecodeBytesPartial(t *testing.T) {
+	text := "partial decodes keep every complete symbol: ünïcödé"
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	codes := BuildCodes(root)
+	payload, bitCount := PackBits(Encode(text, codes))
+	for cut := 0; cut <= bitCount; cut++ {
+		// The expected text is every symbol whose code ends by the cut
+		want, end := "", 0
+		for _, char := range text {
+			if end+len(codes[char]) > cut {
+				break
+			}
+			want += string(char)
+			end += len(codes[char])
+		}
+		got, discarded, err := DecodeBytesPartial(payload, cut, root)
+		if err != nil {
+			t.Fatalf("cut at bit %d: %v", cut, err)
+		}
+		if got != want || discarded != cut-end {
+			t.Errorf("cut at bit %d: %q, %d discarded; want %q, %d", cut, got, discarded, want, cut-end)
+		}
+	}
+
+	// The data ending before bitCount truncates it too
+	got, discarded, err := DecodeBytesPartial(payload[:3], bitCount, root)
+	if err != nil || !strings.HasPrefix(text, got) || len(Encode(got, codes))+discarded != 24 {
+		t.Errorf("3 bytes of data: %q, %d discarded, %v", got, discarded, err)
+	}
+
+	// An invalid code is still an error
+	incomplete := treeFromSpec(t, map[rune]int{'a': 1, 'b': 2})
+	invalid, n := PackBits("0" + "10" + "11")
+	if _, _, err := DecodeBytesPartial(invalid, n, incomplete); err == nil {
+		t.Error("no error for an invalid code")
+	}
+}
+
+func TestReadHuffFilePartial(t *testing.T) {
+	text := strings.Repeat("a container cut short in transit ", 20)
+	for _, opts := range []EncodeOptions{{}, {Compact: true}, {RLE: true}, {Bytes: true}} {
+		data := encodeContainer(t, text, opts)
+		size := headerSize(t, data)
+		for n := size; n <= len(data); n++ {
+			_, got, discarded, err := ReadHuffFilePartial(bytes.NewReader(data[:n]))
+			if err != nil {
+				t.Fatalf("%+v, %d of %d bytes: %v", opts, n, len(data), err)
+			}
+			if !strings.HasPrefix(text, got) {
+				t.Fatalf("%+v, %d of %d bytes: %q is not a prefix of the text", opts, n, len(data), got)
+			}
+			if n == len(data) && (got != text || discarded != 0) {
+				t.Errorf("%+v, whole file: %d bytes, %d discarded", opts, len(got), discarded)
+			}
+			if n < len(data) && discarded < (len(data)-n)*8-7 {
+				t.Errorf("%+v, %d of %d bytes: only %d bits discarded", opts, n, len(data), discarded)
+			}
+		}
+		for n := 0; n < size; n++ {
+			if _, _, _, err := ReadHuffFilePartial(bytes.NewReader(data[:n])); err == nil {
+				t.Errorf("%+v, %d header bytes: no error", opts, n)
+			}
+		}
+	}
+}
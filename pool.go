@@ -0,0 +1,42 @@
+package main
+
+import "sync"
+
+// nodePool recycles the nodes of trees passed to ReleaseTree, so servers
+// building a tree per message allocate few new nodes
+var nodePool = sync.Pool{
+	New: func() interface{} { return new(HuffmanNode) },
+}
+
+// newNode returns a node from the pool with the given fields
+func newNode(character rune, frequency int, left, right *HuffmanNode) *HuffmanNode {
+	node := nodePool.Get().(*HuffmanNode)
+	*node = HuffmanNode{character: character, frequency: frequency, left: left, right: right}
+	return node
+}
+
+// ReleaseTree returns the nodes of a tree to the pool BuildHuffmanTree
+// allocates from. It is optional; unreleased trees are simply collected.
+// The caller must own the tree outright: it must not be used again, by
+// this or any other goroutine, nor be shared, such as StaticTree, a
+// registered preset, or a tree whose subtrees appear in another tree.
+// Codes generated from the tree remain valid.
+func ReleaseTree(root *HuffmanNode) {
+	if root == nil {
+		return
+	}
+	forgetCodes(root)
+	stack := []*HuffmanNode{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node.left != nil {
+			stack = append(stack, node.left)
+		}
+		if node.right != nil {
+			stack = append(stack, node.right)
+		}
+		*node = HuffmanNode{}
+		nodePool.Put(node)
+	}
+}
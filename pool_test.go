@@ -0,0 +1,67 @@
+package main
+
+import (
+	"maps"
+	"sync"
+	"testing"
+)
+
+func TestReleaseTreeReuse(t *testing.T) {
+	text := "released trees give their nodes to the next build"
+	frequency := BuildFrequencyTable(text)
+	want := BuildCodes(BuildHuffmanTree(frequency))
+	for i := 0; i < 20; i++ {
+		root := BuildHuffmanTree(frequency)
+		codes := BuildCodes(root)
+		if !maps.Equal(codes, want) {
+			t.Fatalf("build %d: codes differ after reusing released nodes", i)
+		}
+		if got := Decode(Encode(text, codes), root); got != text {
+			t.Fatalf("build %d: Decode = %q", i, got)
+		}
+		ReleaseTree(root)
+		if got := Decode(Encode(text, codes), BuildHuffmanTree(frequency)); got != text {
+			t.Fatalf("build %d: codes of a released tree no longer decode", i)
+		}
+	}
+	ReleaseTree(nil)
+}
+
+func TestReleaseTreeConcurrent(t *testing.T) {
+	// Run with -race: each goroutine owns its trees outright
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			text := benchmarkText(200 + g*50)
+			for i := 0; i < 50; i++ {
+				root := BuildHuffmanTree(BuildFrequencyTable(text))
+				if got := Decode(Encode(text, BuildCodes(root)), root); got != text {
+					t.Errorf("goroutine %d: round trip failed", g)
+					return
+				}
+				ReleaseTree(root)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// BenchmarkBuildHuffmanTree builds a tree per iteration, as a server coding
+// each message with its own table would, with and without releasing it
+func BenchmarkBuildHuffmanTree(b *testing.B) {
+	frequency := BuildFrequencyTable(benchmarkText(4 << 10))
+	b.Run("collected", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			BuildHuffmanTree(frequency)
+		}
+	})
+	b.Run("released", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ReleaseTree(BuildHuffmanTree(frequency))
+		}
+	})
+}
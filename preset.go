@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// inlineTreeID marks a message that carries its own tree instead of a preset
+const inlineTreeID = 0
+
+// preset is a registered code table together with its decoding tree
+type preset struct {
+	codes map[rune]string
+	tree  *HuffmanNode
+}
+
+var (
+	presetsMu sync.RWMutex
+	presets   = make(map[byte]preset)
+)
+
+// RegisterPreset registers a named code table that messages can reference
+// by a one-byte ID instead of embedding a tree. ID 0 is reserved for
+// messages with an inline tree. It panics if the ID is 0 or already taken,
+// or if codes is not a valid prefix code.
+func RegisterPreset(id byte, codes map[rune]string) {
+	if id == inlineTreeID {
+		panic("huffman: preset ID 0 is reserved")
+	}
+	tree, err := TreeFromCodes(codes)
+	if err != nil {
+		panic(fmt.Sprintf("huffman: invalid preset %d: %v", id, err))
+	}
+
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	if _, dup := presets[id]; dup {
+		panic(fmt.Sprintf("huffman: preset %d registered twice", id))
+	}
+	copied := make(map[rune]string, len(codes))
+	for char, code := range codes {
+		copied[char] = code
+	}
+	presets[id] = preset{codes: copied, tree: tree}
+}
+
+// lookupPreset returns the preset registered under id
+func lookupPreset(id byte) (preset, error) {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+	p, ok := presets[id]
+	if !ok {
+		return preset{}, fmt.Errorf("unknown preset %d", id)
+	}
+	return p, nil
+}
+
+// EncodeMessage encodes text as a compact self-contained message. With a
+// presetID of 0 the message embeds its own tree; otherwise it references a
+// preset registered with RegisterPreset, which must cover every symbol.
+//
+// The message layout is the preset ID byte, the tree (inline messages
+// only), the payload bit count as a uvarint, and the packed payload.
+func EncodeMessage(text string, presetID byte) ([]byte, error) {
+	msg := []byte{presetID}
+	var codes map[rune]string
+	if presetID == inlineTreeID {
+		root := BuildHuffmanTree(BuildFrequencyTable(text))
+		codes = BuildCodes(root)
+		msg = AppendTree(msg, root)
+	} else {
+		p, err := lookupPreset(presetID)
+		if err != nil {
+			return nil, err
+		}
+		codes = p.codes
+	}
+
+	encoded, err := encodeChecked(text, codes)
+	if err != nil {
+		return nil, err
+	}
+	payload, bitCount := PackBits(encoded)
+	msg = binary.AppendUvarint(msg, uint64(bitCount))
+	return append(msg, payload...), nil
+}
+
+// DecodeMessage decodes a message produced by EncodeMessage
+func DecodeMessage(msg []byte) (string, error) {
+	r := bytes.NewReader(msg)
+	id, err := r.ReadByte()
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	var root *HuffmanNode
+	if id == inlineTreeID {
+		if root, err = ReadTree(r); err != nil {
+			return "", err
+		}
+	} else {
+		p, err := lookupPreset(id)
+		if err != nil {
+			return "", err
+		}
+		root = p.tree
+	}
+
+	bitCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	payload := msg[len(msg)-r.Len():]
+	if bitCount > uint64(len(payload))*8 {
+		return "", fmt.Errorf("message declares %d bits but holds only %d", bitCount, len(payload)*8)
+	}
+	return DecodeBytes(payload, int(bitCount), root)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testPresetID is the preset registered by the tests
+const testPresetID = 200
+
+// registerTestPreset registers, once per process, a preset built from
+// English text
+func registerTestPreset(t *testing.T) {
+	t.Helper()
+	if _, err := lookupPreset(testPresetID); err == nil {
+		return
+	}
+	RegisterPreset(testPresetID, BuildCodes(BuildHuffmanTree(BuildFrequencyTable(benchmarkText(4<<10)))))
+}
+
+func TestPresetMessageSize(t *testing.T) {
+	registerTestPreset(t)
+	text := "the dog ok" // ten bytes
+	inline, err := EncodeMessage(text, inlineTreeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withPreset, err := EncodeMessage(text, testPresetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var container bytes.Buffer
+	if err := WriteHuffFile(&container, text); err != nil {
+		t.Fatal(err)
+	}
+	if len(withPreset) >= len(inline) || len(withPreset) >= container.Len() {
+		t.Errorf("preset message is %d bytes, inline %d, container %d", len(withPreset), len(inline), container.Len())
+	}
+	if len(withPreset) >= len(text) {
+		t.Errorf("preset message is %d bytes, no smaller than the %d byte text", len(withPreset), len(text))
+	}
+	for _, msg := range [][]byte{inline, withPreset} {
+		got, err := DecodeMessage(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != text {
+			t.Errorf("DecodeMessage = %q, want %q", got, text)
+		}
+	}
+}
+
+func TestPresetErrors(t *testing.T) {
+	registerTestPreset(t)
+	if _, err := EncodeMessage("text", 201); err == nil {
+		t.Error("EncodeMessage accepted an unregistered preset")
+	}
+	if _, err := EncodeMessage("é", testPresetID); err == nil {
+		t.Error("EncodeMessage accepted a symbol the preset does not cover")
+	}
+	if _, err := DecodeMessage([]byte{201, 0}); err == nil {
+		t.Error("DecodeMessage accepted an unregistered preset")
+	}
+	for _, tt := range []struct {
+		name  string
+		id    byte
+		codes map[rune]string
+	}{
+		{"reserved ID", inlineTreeID, map[rune]string{'a': "0", 'b': "1"}},
+		{"duplicate ID", testPresetID, map[rune]string{'a': "0", 'b': "1"}},
+		{"not a prefix code", 202, map[rune]string{'a': "0", 'b': "01"}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: RegisterPreset did not panic", tt.name)
+				}
+			}()
+			RegisterPreset(tt.id, tt.codes)
+		}()
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// With FlagRLE, runs are collapsed before Huffman coding: a run of
+// rleMinRun or more copies of a symbol is coded as the symbol followed by
+// run symbols, each repeating the previous symbol 1 to rleMaxRepeat more
+// times. Run symbols are the surrogate code points from rleRunBase, which
+// never occur in valid UTF-8 text or as byte values, so they share one
+// alphabet with the text.
+const (
+	rleRunBase   = 0xD800
+	rleMaxRepeat = 0x800
+	rleMinRun    = 3
+)
+
+// errRunWithoutSymbol is returned when a payload starts with a run symbol
+var errRunWithoutSymbol = errors.New("run-length symbol with no symbol to repeat")
+
+// rleSymbols returns the symbols of text, runes or bytes as byteMode says,
+// with runs collapsed into run symbols
+func rleSymbols(text string, byteMode bool) []rune {
+	var symbols []rune
+	run := func(char rune, n int) {
+		symbols = append(symbols, char)
+		if n < rleMinRun {
+			for i := 1; i < n; i++ {
+				symbols = append(symbols, char)
+			}
+			return
+		}
+		for repeat := n - 1; repeat > 0; repeat -= rleMaxRepeat {
+			symbols = append(symbols, rleRunBase+rune(min(repeat, rleMaxRepeat)-1))
+		}
+	}
+
+	var last rune
+	n := 0
+	for i := 0; i < len(text); {
+		char, size := rune(text[i]), 1
+		if !byteMode {
+			char, size = utf8.DecodeRuneInString(text[i:])
+		}
+		i += size
+		if n > 0 && char == last {
+			n++
+			continue
+		}
+		if n > 0 {
+			run(last, n)
+		}
+		last, n = char, 1
+	}
+	if n > 0 {
+		run(last, n)
+	}
+	return symbols
+}
+
+// runRepeats returns how many times a run symbol repeats the previous
+// symbol, or false if sym is not a run symbol
+func runRepeats(sym rune) (int, bool) {
+	if sym < rleRunBase || sym >= rleRunBase+rleMaxRepeat {
+		return 0, false
+	}
+	return int(sym-rleRunBase) + 1, true
+}
+
+// expandRuns returns an emit function for decodeSymbols that expands run
+// symbols, passing every symbol of the original text to emit
+func expandRuns(emit func(rune) error) func(rune) error {
+	var last rune
+	started := false
+	return func(sym rune) error {
+		repeats, ok := runRepeats(sym)
+		if !ok {
+			last, started = sym, true
+			return emit(sym)
+		}
+		if !started {
+			return errRunWithoutSymbol
+		}
+		for i := 0; i < repeats; i++ {
+			if err := emit(last); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// rleDecoder decodes FlagRLE payloads, expanding runs as it goes
+type rleDecoder struct {
+	root  *HuffmanNode
+	bytes bool // symbols are bytes rather than runes
+}
+
+func (d rleDecoder) Decode(data []byte, bitCount int) (string, error) {
+	out := make([]byte, 0, bitCount/8)
+	err := decodeSymbols(data, bitCount, d.root, expandRuns(func(char rune) error {
+		if d.bytes {
+			out = append(out, byte(char))
+		} else {
+			out = utf8.AppendRune(out, char)
+		}
+		return nil
+	}))
+	return string(out), err
+}
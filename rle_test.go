@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRLESymbols(t *testing.T) {
+	run := func(repeats int) rune { return rleRunBase + rune(repeats-1) }
+	tests := []struct {
+		name  string
+		text  string
+		bytes bool
+		want  []rune
+	}{
+		{"empty", "", false, nil},
+		{"no runs", "abc", false, []rune("abc")},
+		{"short runs stay literal", "aabcc", false, []rune("aabcc")},
+		{"minimum run", "aaa", false, []rune{'a', run(2)}},
+		{"run between literals", "xaaaaay", false, []rune{'x', 'a', run(4), 'y'}},
+		{"adjacent runs", "aaaabbbbb", false, []rune{'a', run(3), 'b', run(4)}},
+		{"multi-byte runs", "日日日日é", false, []rune{'日', run(3), 'é'}},
+		{"byte runs", "\xff\xff\xff\xff", true, []rune{0xff, run(3)}},
+		{"longest run symbol", strings.Repeat(" ", rleMaxRepeat+1), false, []rune{' ', run(rleMaxRepeat)}},
+		{"run split", strings.Repeat(" ", rleMaxRepeat+6), false, []rune{' ', run(rleMaxRepeat), run(5)}},
+		{"long run", strings.Repeat("-", 3*rleMaxRepeat+2), false, []rune{'-', run(rleMaxRepeat), run(rleMaxRepeat), run(rleMaxRepeat), run(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rleSymbols(tt.text, tt.bytes)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("rleSymbols = %U, want %U", got, tt.want)
+			}
+			var out []byte
+			emit := expandRuns(func(char rune) error {
+				if tt.bytes {
+					out = append(out, byte(char))
+				} else {
+					out = append(out, string(char)...)
+				}
+				return nil
+			})
+			for _, sym := range got {
+				if err := emit(sym); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if string(out) != tt.text {
+				t.Errorf("expanded %q, want %q", out, tt.text)
+			}
+		})
+	}
+	if err := expandRuns(func(rune) error { return nil })(run(1)); err != errRunWithoutSymbol {
+		t.Errorf("leading run symbol: error %v, want errRunWithoutSymbol", err)
+	}
+}
+
+func TestRLEContainer(t *testing.T) {
+	text := "header" + strings.Repeat(" ", 5000) + "x" + strings.Repeat("=", 3000) + "yy" + strings.Repeat("\n", 10)
+	plain := encodeContainer(t, text, EncodeOptions{})
+	rle := encodeContainer(t, text, EncodeOptions{RLE: true})
+	if len(rle) >= len(plain)/10 {
+		t.Errorf("run-length coded container is %d bytes, plain %d", len(rle), len(plain))
+	}
+	for _, data := range [][]byte{rle, encodeContainer(t, text, EncodeOptions{RLE: true, Bytes: true})} {
+		_, got, err := ReadHuffFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != text {
+			t.Error("run-length coded container does not decode to the text")
+		}
+	}
+}
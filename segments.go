@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A segmented stream interleaves Huffman-coded segments with stored
+// (uncompressed) ones, for input mixing compressible text with regions
+// such as already-compressed data that would only inflate. Symbols are
+// bytes, so any input is accepted. Its layout is:
+//
+//	tree      AppendTree, over the bytes of the coded segments
+//	count     uvarint, number of segments
+//	segments:
+//	  kind      1 byte, segmentStored or segmentCoded
+//	  size      uvarint, length of the segment's original bytes
+//	  stored:   the original bytes
+//	  coded:    uvarint bit count, then the packed bits
+const (
+	segmentStored = 0
+	segmentCoded  = 1
+)
+
+// Range is a half-open byte range [Start, End) of an input
+type Range struct {
+	Start, End int
+}
+
+// EncodeSegmented compresses data as a segmented stream. The stored ranges
+// are kept verbatim and left out of the frequency table. The rest is split
+// into segments of at most segmentSize bytes, or one segment per gap
+// between stored ranges if segmentSize is 0, and each is stored instead of
+// coded whenever coding would not make it smaller.
+func EncodeSegmented(data []byte, stored []Range, segmentSize int) ([]byte, error) {
+	if segmentSize < 0 {
+		return nil, fmt.Errorf("invalid segment size %d", segmentSize)
+	}
+	stored = append([]Range(nil), stored...)
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Start < stored[j].Start })
+	for i, r := range stored {
+		if r.Start < 0 || r.End > len(data) || r.Start > r.End || (i > 0 && r.Start < stored[i-1].End) {
+			return nil, fmt.Errorf("invalid stored range [%d, %d)", r.Start, r.End)
+		}
+	}
+
+	// Split the input into stored ranges and the gaps between them
+	type segment struct {
+		kind byte
+		data []byte
+	}
+	var segments []segment
+	addCoded := func(gap []byte) {
+		for len(gap) > 0 {
+			n := len(gap)
+			if segmentSize > 0 {
+				n = min(n, segmentSize)
+			}
+			segments = append(segments, segment{segmentCoded, gap[:n]})
+			gap = gap[n:]
+		}
+	}
+	pos := 0
+	for _, r := range stored {
+		addCoded(data[pos:r.Start])
+		if r.End > r.Start {
+			segments = append(segments, segment{segmentStored, data[r.Start:r.End]})
+		}
+		pos = r.End
+	}
+	addCoded(data[pos:])
+
+	frequency := make(map[rune]int)
+	for _, seg := range segments {
+		if seg.kind == segmentCoded {
+			for _, b := range seg.data {
+				frequency[rune(b)]++
+			}
+		}
+	}
+	root := BuildHuffmanTree(frequency)
+	codes := BuildCodes(root)
+
+	out := AppendTree(nil, root)
+	out = binary.AppendUvarint(out, uint64(len(segments)))
+	for _, seg := range segments {
+		if seg.kind == segmentCoded {
+			encoded, err := encodeBytesChecked(string(seg.data), codes)
+			if err != nil {
+				return nil, err
+			}
+			payload, bitCount := PackBits(encoded)
+			header := binary.AppendUvarint([]byte{segmentCoded}, uint64(len(seg.data)))
+			header = binary.AppendUvarint(header, uint64(bitCount))
+			storedSize := len(binary.AppendUvarint([]byte{segmentStored}, uint64(len(seg.data)))) + len(seg.data)
+			if len(header)+len(payload) < storedSize {
+				out = append(append(out, header...), payload...)
+				continue
+			}
+		}
+		out = append(out, segmentStored)
+		out = binary.AppendUvarint(out, uint64(len(seg.data)))
+		out = append(out, seg.data...)
+	}
+	return out, nil
+}
+
+// DecodeSegmented decodes a stream produced by EncodeSegmented
+func DecodeSegmented(data []byte) ([]byte, error) {
+	r := bytes.NewReader(data)
+	root, err := ReadTree(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading tree: %w", err)
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	// Every segment takes at least two bytes, which bounds a corrupt count
+	if count > uint64(r.Len()) {
+		return nil, fmt.Errorf("segment count %d exceeds the remaining %d bytes", count, r.Len())
+	}
+
+	var out []byte
+	for i := uint64(0); i < count; i++ {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %w", i, unexpectedEOF(err))
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %w", i, unexpectedEOF(err))
+		}
+		switch kind {
+		case segmentStored:
+			if size > uint64(r.Len()) {
+				return nil, fmt.Errorf("segment %d: %w", i, io.ErrUnexpectedEOF)
+			}
+			start := len(data) - r.Len()
+			out = append(out, data[start:start+int(size)]...)
+			r.Seek(int64(size), io.SeekCurrent)
+		case segmentCoded:
+			bitCount, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("segment %d: %w", i, unexpectedEOF(err))
+			}
+			if (bitCount+7)/8 > uint64(r.Len()) {
+				return nil, fmt.Errorf("segment %d: %w", i, io.ErrUnexpectedEOF)
+			}
+			start := len(data) - r.Len()
+			payload := data[start : start+int((bitCount+7)/8)]
+			r.Seek(int64(len(payload)), io.SeekCurrent)
+			before := len(out)
+			err = decodeSymbols(payload, int(bitCount), root, func(char rune) error {
+				if char > 0xff {
+					return fmt.Errorf("symbol %q out of range for a byte", char)
+				}
+				out = append(out, byte(char))
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("segment %d: %w", i, err)
+			}
+			if uint64(len(out)-before) != size {
+				return nil, fmt.Errorf("segment %d: decoded %d bytes, expected %d", i, len(out)-before, size)
+			}
+		default:
+			return nil, fmt.Errorf("segment %d: unknown kind %d", i, kind)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("unexpected data after the last segment")
+	}
+	return out, nil
+}
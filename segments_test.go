@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// segmentKinds returns the kind of each segment of a segmented stream
+func segmentKinds(t *testing.T, data []byte) []byte {
+	t.Helper()
+	r := bytes.NewReader(data)
+	if _, err := ReadTree(r); err != nil {
+		t.Fatal(err)
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []byte
+	for i := uint64(0); i < count; i++ {
+		kind, _ := r.ReadByte()
+		size, _ := binary.ReadUvarint(r)
+		if kind == segmentCoded {
+			bitCount, _ := binary.ReadUvarint(r)
+			size = (bitCount + 7) / 8
+		}
+		r.Seek(int64(size), io.SeekCurrent)
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+func TestSegmentedRoundTrip(t *testing.T) {
+	text := []byte(benchmarkText(1000))
+	noise := make([]byte, 300)
+	rand.New(rand.NewSource(1)).Read(noise)
+	mixed := slices.Concat(text[:400], noise, text[400:])
+
+	const c, s = segmentCoded, segmentStored
+	tests := []struct {
+		name        string
+		data        []byte
+		stored      []Range
+		segmentSize int
+		kinds       []byte
+	}{
+		{"empty", nil, nil, 0, nil},
+		{"one coded segment", text, nil, 0, []byte{c}},
+		{"stored range", mixed, []Range{{400, 700}}, 0, []byte{c, s, c}},
+		{"stored ranges out of order", mixed, []Range{{700, 710}, {0, 10}}, 0, []byte{s, c, s, c}},
+		{"empty stored range", text, []Range{{500, 500}}, 0, []byte{c, c}},
+		{"whole input stored", text, []Range{{0, len(text)}}, 0, []byte{s}},
+		{"split", text, nil, 256, []byte{c, c, c, c}},
+		{"split around a stored range", mixed, []Range{{400, 700}}, 300, []byte{c, c, s, c, c}},
+		// A one-byte segment, or noise coded with a table built mostly
+		// from text, would be no smaller coded, so is stored
+		{"stored fallback", text[:257], nil, 256, []byte{c, s}},
+		{"noise fallback", mixed, nil, 100, []byte{c, c, c, c, s, s, s, c, c, c, c, c, c}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeSegmented(tt.data, tt.stored, tt.segmentSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kinds := segmentKinds(t, data); !slices.Equal(kinds, tt.kinds) {
+				t.Errorf("segment kinds %v, want %v", kinds, tt.kinds)
+			}
+			got, err := DecodeSegmented(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("DecodeSegmented returned %d bytes that differ from the %d byte input", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestSegmentedErrors(t *testing.T) {
+	data := []byte("some input to split into segments")
+	for _, stored := range [][]Range{{{-1, 2}}, {{5, 4}}, {{0, len(data) + 1}}, {{0, 10}, {5, 15}}} {
+		if _, err := EncodeSegmented(data, stored, 0); err == nil {
+			t.Errorf("stored ranges %v: no error", stored)
+		}
+	}
+	if _, err := EncodeSegmented(data, nil, -1); err == nil {
+		t.Error("no error for a negative segment size")
+	}
+	encoded, err := EncodeSegmented(slices.Concat(data, data), []Range{{10, 20}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < len(encoded); n++ {
+		if _, err := DecodeSegmented(encoded[:n]); err == nil {
+			t.Errorf("%d of %d bytes: no error", n, len(encoded))
+		}
+	}
+	if _, err := DecodeSegmented(append(bytes.Clone(encoded), 0)); err == nil {
+		t.Error("no error for data after the last segment")
+	}
+}
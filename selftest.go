@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// selfTestCase is one input of the self-test battery
+type selfTestCase struct {
+	name string
+	text string
+}
+
+// selfTestCases returns the inputs checked by "huffman selftest". The
+// random inputs use fixed seeds so every run checks the same data.
+func selfTestCases() []selfTestCase {
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []rune("abcdefghijklmnopqrstuvwxyz ,.\néü€日本")
+	var random strings.Builder
+	for i := 0; i < 10000; i++ {
+		random.WriteRune(alphabet[rng.Intn(len(alphabet))])
+	}
+	binary := make([]byte, 10000)
+	rng.Read(binary)
+
+	return []selfTestCase{
+		{"empty", ""},
+		{"single symbol", strings.Repeat("a", 1000)},
+		{"two symbols", strings.Repeat("ab", 300) + "b"},
+		{"long runs", strings.Repeat("x", 5000) + strings.Repeat("yz", 50) + strings.Repeat("€", 3000)},
+		{"ascii", strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 100)},
+		{"random text", random.String()},
+		{"binary data", string(binary)},
+	}
+}
+
+// selfTestModes returns every combination of the container options that
+// select a coding mode, so modes that pass alone are also checked
+// together. Fast cannot be combined with RLE and is left out there.
+func selfTestModes() []EncodeOptions {
+	var modes []EncodeOptions
+	for bits := 0; bits < 1<<8; bits++ {
+		opts := EncodeOptions{
+			LeftOne:        bits&1 != 0,
+			Compact:        bits&2 != 0,
+			Fast:           bits&4 != 0,
+			Bytes:          bits&8 != 0,
+			LSBFirst:       bits&16 != 0,
+			RLE:            bits&32 != 0,
+			FrequencyOrder: bits&128 != 0,
+		}
+		if bits&64 != 0 {
+			// Little but long runs under RLE compresses this well,
+			// so the input is mostly stored
+			opts.MinRatio = 100
+		}
+		if opts.Fast && opts.RLE || opts.FrequencyOrder && !opts.Compact {
+			// FrequencyOrder implies Compact, so is only tried with it
+			continue
+		}
+		modes = append(modes, opts)
+	}
+	return modes
+}
+
+// checkRoundTrip compresses text under every mode and decompresses it in
+// one piece, as a stream and, where the payload is plain rune codes, with
+// each table decoder, returning the first mismatch or error
+func checkRoundTrip(text string) error {
+	for _, opts := range selfTestModes() {
+		var buf bytes.Buffer
+		err := WriteHuffFileWithOptions(&buf, text, opts)
+		if opts.Fast && errors.Is(err, ErrNotStatic) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%+v: encode: %w", opts, err)
+		}
+		encoded := buf.Bytes()
+
+		_, decoded, err := ReadHuffFile(bytes.NewReader(encoded))
+		if err != nil {
+			return fmt.Errorf("%+v: decode: %w", opts, err)
+		}
+		if decoded != text {
+			return fmt.Errorf("%+v: decode returned %d bytes that differ from the %d byte input", opts, len(decoded), len(text))
+		}
+
+		d, err := NewContainerDecoder(bytes.NewReader(encoded))
+		if err != nil {
+			return fmt.Errorf("%+v: stream decode: %w", opts, err)
+		}
+		if err := compareStream([]byte(text), d); err != nil {
+			return fmt.Errorf("%+v: stream decode: %w", opts, err)
+		}
+
+		if err := checkTableDecoders(encoded, text); err != nil {
+			return fmt.Errorf("%+v: %w", opts, err)
+		}
+	}
+	return checkGzipRoundTrip(text)
+}
+
+// checkGzipRoundTrip pipes a container, written both whole and in one pass
+// with a footer, through gzip and back, which checks that the encode and
+// decode entry points need nothing beyond io.Writer and io.Reader. The
+// footer writer codes UTF-8 text only, so other input is sent whole only.
+func checkGzipRoundTrip(text string) error {
+	var whole bytes.Buffer
+	zw := gzip.NewWriter(&whole)
+	if err := WriteHuffFile(zw, text); err != nil {
+		return fmt.Errorf("gzip: encode: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("gzip: encode: %w", err)
+	}
+	containers := [][]byte{whole.Bytes()}
+	if !utf8.ValidString(text) {
+		return checkGzipDecode(containers, text)
+	}
+
+	var footer bytes.Buffer
+	zw = gzip.NewWriter(&footer)
+	fw, err := NewFooterWriter(zw, BuildHuffmanTree(BuildFrequencyTable(text)))
+	if err != nil {
+		return fmt.Errorf("gzip: footer encode: %w", err)
+	}
+	if _, err := io.WriteString(fw, text); err != nil {
+		return fmt.Errorf("gzip: footer encode: %w", err)
+	}
+	if err := fw.Close(); err != nil {
+		return fmt.Errorf("gzip: footer encode: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("gzip: footer encode: %w", err)
+	}
+	return checkGzipDecode(append(containers, footer.Bytes()), text)
+}
+
+// checkGzipDecode decompresses each gzip-wrapped container both in one
+// piece and as a stream, comparing the result with text
+func checkGzipDecode(containers [][]byte, text string) error {
+	for _, compressed := range containers {
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return fmt.Errorf("gzip: decode: %w", err)
+		}
+		_, decoded, err := ReadHuffFile(zr)
+		if err != nil {
+			return fmt.Errorf("gzip: decode: %w", err)
+		}
+		if decoded != text {
+			return fmt.Errorf("gzip: decode returned %d bytes that differ from the %d byte input", len(decoded), len(text))
+		}
+
+		if zr, err = gzip.NewReader(bytes.NewReader(compressed)); err != nil {
+			return fmt.Errorf("gzip: stream decode: %w", err)
+		}
+		d, err := NewContainerDecoder(zr)
+		if err != nil {
+			return fmt.Errorf("gzip: stream decode: %w", err)
+		}
+		if err := compareStream([]byte(text), d); err != nil {
+			return fmt.Errorf("gzip: stream decode: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkTableDecoders decodes the payload of a container with the tree and
+// both lookup tables, which ReadHuffFile only picks for large payloads,
+// and compares each result with text. Byte-coded and run-length coded
+// payloads are skipped, as the tables decode plain rune codes only.
+func checkTableDecoders(encoded []byte, text string) error {
+	r := bufio.NewReader(bytes.NewReader(encoded))
+	h, err := readHuffHeader(r)
+	if err != nil {
+		return err
+	}
+	if h.Flags&(FlagBytes|FlagRLE|FlagFooter) != 0 {
+		return nil
+	}
+	payload := make([]byte, h.PayloadSize())
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return unexpectedEOF(err)
+	}
+	if h.Flags&FlagLSBFirst != 0 {
+		reverseBitOrder(payload)
+	}
+	tree := h.DecodingTree()
+	decoders := []struct {
+		name    string
+		decoder PayloadDecoder
+	}{
+		{"tree", tree},
+		{"table", NewDecodeTable(tree)},
+		{"two-level table", NewTwoLevelTable(tree)},
+	}
+	for _, d := range decoders {
+		decoded, err := d.decoder.Decode(payload, int(h.BitCount))
+		if err != nil {
+			return fmt.Errorf("%s decode: %w", d.name, err)
+		}
+		if decoded != text {
+			return fmt.Errorf("%s decode returned %d bytes that differ from the %d byte input", d.name, len(decoded), len(text))
+		}
+	}
+	return nil
+}
+
+// VerifyRoundTrip reads r to the end, compresses it in memory and
+// decompresses the result as a stream, comparing it to the input as it
+// goes so no second full copy is held. A difference is reported with the
+// offset of the first differing byte.
+func VerifyRoundTrip(r io.Reader) error {
+	original, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var compressed bytes.Buffer
+	if err := WriteHuffFile(&compressed, string(original)); err != nil {
+		return fmt.Errorf("compressing: %w", err)
+	}
+	d, err := NewContainerDecoder(&compressed)
+	if err != nil {
+		return fmt.Errorf("decompressing: %w", err)
+	}
+	return compareStream(original, d)
+}
+
+// CheckFile checks the .huff container or archive at path: the header
+// checksum of every container, and with full also the payload against the
+// checksum of the original, decoding it as a stream without keeping it
+func CheckFile(path string, full bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	check := func(d *Decoder) error {
+		if !full {
+			return nil
+		}
+		_, err := io.Copy(io.Discard, d)
+		return err
+	}
+	if magic, _ := br.Peek(len(archiveMagic)); string(magic) == archiveMagic {
+		return ReadBlocks(br, func(_ int, block *Decoder) error {
+			return check(block)
+		})
+	}
+	d, err := NewContainerDecoder(br)
+	if err != nil {
+		return err
+	}
+	return check(d)
+}
+
+// compareStream reads r to the end and compares it with want, returning
+// an error naming the first differing offset
+func compareStream(want []byte, r io.Reader) error {
+	buf := make([]byte, 32<<10)
+	offset := 0
+	for {
+		n, err := r.Read(buf)
+		got := buf[:n]
+		rest := want[offset:]
+		for i := range got {
+			if i == len(rest) || got[i] != rest[i] {
+				return fmt.Errorf("round trip differs at byte %d", offset+i)
+			}
+		}
+		offset += n
+		if err == io.EOF {
+			if offset != len(want) {
+				return fmt.Errorf("round trip differs at byte %d: output ends early", offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decompressing: %w", err)
+		}
+	}
+}
+
+// runSelfTestCases runs the battery, printing PASS or FAIL for each case
+// to w, and reports whether every case passed
+func runSelfTestCases(w io.Writer) bool {
+	ok := true
+	for _, c := range selfTestCases() {
+		if err := checkRoundTrip(c.text); err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", c.name, err)
+			ok = false
+		} else {
+			fmt.Fprintf(w, "PASS %s\n", c.name)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSelfTest(t *testing.T) {
+	for _, c := range selfTestCases() {
+		t.Run(c.name, func(t *testing.T) {
+			if err := checkRoundTrip(c.text); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		if err := VerifyRoundTrip(strings.NewReader(tt.text)); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+	errRead := errors.New("read failed")
+	if err := VerifyRoundTrip(iotest.ErrReader(errRead)); !errors.Is(err, errRead) {
+		t.Errorf("failing reader: error %v, want %v", err, errRead)
+	}
+}
+
+func TestVerifyRoundTripMismatch(t *testing.T) {
+	want := strings.Repeat("the original input ", 4000)
+	tests := []struct {
+		name   string
+		output string
+		offset string // as reported in the error
+	}{
+		{"first byte", "T" + want[1:], "at byte 0"},
+		{"changed byte", want[:50000] + "X" + want[50001:], "at byte 50000"},
+		{"output ends early", want[:len(want)-3], fmt.Sprintf("at byte %d: output ends early", len(want)-3)},
+		{"extra output", want + "!", fmt.Sprintf("at byte %d", len(want))},
+		{"empty output", "", "at byte 0: output ends early"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One byte at a time crosses every read boundary
+			err := compareStream([]byte(want), iotest.OneByteReader(strings.NewReader(tt.output)))
+			if err == nil || !strings.HasSuffix(err.Error(), tt.offset) {
+				t.Errorf("error %v, want one ending %q", err, tt.offset)
+			}
+			err = compareStream([]byte(want), strings.NewReader(tt.output))
+			if err == nil || !strings.HasSuffix(err.Error(), tt.offset) {
+				t.Errorf("whole reads: error %v, want one ending %q", err, tt.offset)
+			}
+		})
+	}
+	if err := compareStream([]byte(want), strings.NewReader(want)); err != nil {
+		t.Errorf("identical output: %v", err)
+	}
+}
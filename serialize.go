@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Tree serialization tags. A tree is written in pre-order: an internal node
+// is its tag followed by its left and right subtrees, and a leaf is its tag
+// followed by the symbol's 32 bits as a uvarint. Symbols are not checked
+// to be valid code points, so any rune round-trips.
+const (
+	tagEmpty    = 0
+	tagLeaf     = 1
+	tagInternal = 2
+)
+
+// maxTreeDepth bounds the depth of deserialized trees so corrupt input
+// cannot recurse without limit
+const maxTreeDepth = 256
+
+// AppendTree appends the serialized form of the tree to dst
+func AppendTree(dst []byte, root *HuffmanNode) []byte {
+	if root == nil {
+		return append(dst, tagEmpty)
+	}
+	if root.left == nil && root.right == nil {
+		// As uint32, so a negative symbol in a hand-built tree takes five
+		// bytes rather than ten and reads back as itself
+		dst = append(dst, tagLeaf)
+		return binary.AppendUvarint(dst, uint64(uint32(root.character)))
+	}
+	// A child may be missing in a tree built from an incomplete code table
+	dst = append(dst, tagInternal)
+	dst = AppendTree(dst, root.left)
+	return AppendTree(dst, root.right)
+}
+
+// ReadTree reads a tree written by AppendTree
+func ReadTree(r io.ByteReader) (*HuffmanNode, error) {
+	return readTree(r, 0)
+}
+
+func readTree(r io.ByteReader, depth int) (*HuffmanNode, error) {
+	if depth > maxTreeDepth {
+		return nil, errors.New("serialized tree is too deep")
+	}
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	switch tag {
+	case tagEmpty:
+		return nil, nil
+	case tagLeaf:
+		char, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if char > math.MaxUint32 {
+			return nil, fmt.Errorf("serialized symbol %d is out of range", char)
+		}
+		return &HuffmanNode{character: rune(uint32(char))}, nil
+	case tagInternal:
+		left, err := readTree(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		right, err := readTree(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if left == nil && right == nil {
+			return nil, errors.New("serialized tree has an internal node without children")
+		}
+		return &HuffmanNode{left: left, right: right}, nil
+	}
+	return nil, fmt.Errorf("invalid tree tag %d", tag)
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF for truncated input
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
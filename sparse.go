@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A sparse file is an experimental format for text dominated by one
+// background symbol, such as mostly spaces with occasional letters. Rather
+// than a code per occurrence of the background, it codes each other
+// symbol together with the length of the gap of background symbols before
+// it. Its layout is:
+//
+//	magic     "HUFS"
+//	mode      1 byte: sparseStandard, followed by a .huff container, or
+//	          sparseGaps, followed by:
+//	background  uvarint, the background symbol
+//	symbols     uvarint, number of runes of the original text
+//	checksum    uint32 big-endian, CRC-32 (IEEE) of the original text
+//	tree        the tree of the other symbols (AppendTree)
+//	gaps        the tree of the gap lengths, as symbols (AppendTree)
+//	bits        uvarint bit count and the packed codes of the other symbols
+//	gap bits    uvarint bit count and the packed codes of their gaps
+//
+// A background run at the end of the text is coded as a gap before one
+// more background symbol, so the gaps account for every symbol.
+const (
+	sparseMagic = "HUFS"
+
+	sparseStandard = 0
+	sparseGaps     = 1
+)
+
+// EncodeSparse compresses UTF-8 text into a sparse file. Gap coding is
+// only kept if it is smaller than a standard .huff container; otherwise
+// the container is stored with the sparseStandard mode.
+func EncodeSparse(text string) ([]byte, error) {
+	if !utf8.ValidString(text) {
+		return nil, errors.New("input is not valid UTF-8")
+	}
+	var standard bytes.Buffer
+	if err := WriteHuffFile(&standard, text); err != nil {
+		return nil, err
+	}
+	gaps := encodeGaps(text)
+	if len(gaps) >= standard.Len() {
+		data := append([]byte(sparseMagic), sparseStandard)
+		return append(data, standard.Bytes()...), nil
+	}
+	data := append([]byte(sparseMagic), sparseGaps)
+	return append(data, gaps...), nil
+}
+
+// encodeGaps returns the body of a sparseGaps file for text
+func encodeGaps(text string) []byte {
+	frequency := BuildFrequencyTable(text)
+	var background rune
+	if histogram := FrequencyHistogram(frequency); len(histogram) > 0 {
+		background = histogram[0].Symbol
+	}
+
+	var others []rune
+	var gaps []rune
+	gap := 0
+	total := 0
+	for _, char := range text {
+		total++
+		if char == background {
+			gap++
+			continue
+		}
+		others = append(others, char)
+		gaps = append(gaps, rune(gap))
+		gap = 0
+	}
+	if gap > 0 {
+		others = append(others, background)
+		gaps = append(gaps, rune(gap-1))
+	}
+
+	data := binary.AppendUvarint(nil, uint64(background))
+	data = binary.AppendUvarint(data, uint64(total))
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE([]byte(text)))
+	for _, symbols := range [][]rune{others, gaps} {
+		counts := make(map[rune]int)
+		for _, sym := range symbols {
+			counts[sym]++
+		}
+		root := BuildHuffmanTree(counts)
+		codes := BuildCodes(root)
+		var encoded strings.Builder
+		for _, sym := range symbols {
+			encoded.WriteString(codes[sym])
+		}
+		payload, bitCount := PackBits(encoded.String())
+		data = AppendTree(data, root)
+		data = binary.AppendUvarint(data, uint64(bitCount))
+		data = append(data, payload...)
+	}
+	return data
+}
+
+// DecodeSparse decodes a sparse file written by EncodeSparse
+func DecodeSparse(data []byte) (string, error) {
+	if len(data) <= len(sparseMagic) || string(data[:len(sparseMagic)]) != sparseMagic {
+		return "", errors.New("not a sparse file")
+	}
+	mode, body := data[len(sparseMagic)], data[len(sparseMagic)+1:]
+	switch mode {
+	case sparseStandard:
+		_, text, err := ReadHuffFile(bytes.NewReader(body))
+		return text, err
+	case sparseGaps:
+		return decodeGaps(body)
+	}
+	return "", fmt.Errorf("unknown sparse mode %d", mode)
+}
+
+// decodeGaps decodes the body of a sparseGaps file
+func decodeGaps(data []byte) (string, error) {
+	r := bytes.NewReader(data)
+	background, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if background > utf8.MaxRune {
+		return "", fmt.Errorf("invalid background symbol %#x", background)
+	}
+	total, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return "", unexpectedEOF(err)
+	}
+
+	var streams [2][]rune
+	for i := range streams {
+		root, err := ReadTree(r)
+		if err != nil {
+			return "", fmt.Errorf("reading tree: %w", err)
+		}
+		bitCount, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", unexpectedEOF(err)
+		}
+		if (bitCount+7)/8 > uint64(r.Len()) {
+			return "", io.ErrUnexpectedEOF
+		}
+		payload := make([]byte, (bitCount+7)/8)
+		r.Read(payload)
+		err = decodeSymbols(payload, int(bitCount), root, func(sym rune) error {
+			streams[i] = append(streams[i], sym)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if r.Len() != 0 {
+		return "", errors.New("unexpected data after the gap codes")
+	}
+	others, gaps := streams[0], streams[1]
+	if len(others) != len(gaps) {
+		return "", fmt.Errorf("%d symbols but %d gaps", len(others), len(gaps))
+	}
+
+	// The coded symbols and gaps cover the whole text
+	coded := uint64(0)
+	for _, gap := range gaps {
+		if gap < 0 {
+			return "", fmt.Errorf("invalid gap %d", gap)
+		}
+		coded += uint64(gap) + 1
+	}
+	if coded != total {
+		return "", fmt.Errorf("symbol count %d does not match the %d coded symbols", total, coded)
+	}
+
+	var sb strings.Builder
+	for i, char := range others {
+		for j := rune(0); j < gaps[i]; j++ {
+			sb.WriteRune(rune(background))
+		}
+		sb.WriteRune(char)
+	}
+	text := sb.String()
+	if crc32.ChecksumIEEE([]byte(text)) != binary.BigEndian.Uint32(sum[:]) {
+		return "", ErrPayloadChecksum
+	}
+	return text, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+// withSymbolCount returns a sparseGaps body with its symbol count and
+// checksum replaced by those of text
+func withSymbolCount(t *testing.T, body []byte, total uint64, text string) []byte {
+	t.Helper()
+	background, n := binary.Uvarint(body)
+	_, m := binary.Uvarint(body[n:])
+	if n <= 0 || m <= 0 {
+		t.Fatal("malformed sparse body")
+	}
+	data := binary.AppendUvarint(nil, background)
+	data = binary.AppendUvarint(data, total)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE([]byte(text)))
+	return append(data, body[n+m+4:]...)
+}
+
+func TestSparseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"single symbol", "x"},
+		{"all background", strings.Repeat(" ", 5000)},
+		{"sparse", strings.Repeat(" ", 300) + "a" + strings.Repeat(" ", 700) + "bc" + strings.Repeat(" ", 40)},
+		{"trailing run", "ab" + strings.Repeat(" ", 10000)},
+		{"dense", "no background to speak of here"},
+		{"unicode", strings.Repeat("·", 500) + "日本" + strings.Repeat("·", 500)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeSparse(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeSparse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.text {
+				t.Errorf("DecodeSparse returned %d bytes that differ from the %d byte input", len(got), len(tt.text))
+			}
+			got, err = decodeGaps(encodeGaps(tt.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.text {
+				t.Errorf("decodeGaps returned %d bytes that differ from the %d byte input", len(got), len(tt.text))
+			}
+		})
+	}
+}
+
+func TestSparseUncodedFinalRun(t *testing.T) {
+	// A final background run must be coded as a trailing gap
+	head := strings.Repeat(" ", 100) + "ab"
+	text := head + strings.Repeat(" ", 20)
+	body := withSymbolCount(t, encodeGaps(head), uint64(len(text)), text)
+	if _, err := decodeGaps(body); err == nil {
+		t.Error("decodeGaps accepted an uncoded final run")
+	}
+}
+
+func TestSparseCorruptSymbolCount(t *testing.T) {
+	text := strings.Repeat(" ", 100) + "ab" + strings.Repeat(" ", 50) + "c"
+	body := encodeGaps(text)
+	for _, total := range []uint64{0, uint64(len(text)) - 1, 1 << 40, 1<<64 - 1} {
+		if _, err := decodeGaps(withSymbolCount(t, body, total, text)); err == nil {
+			t.Errorf("symbol count %d: no error", total)
+		}
+	}
+	if _, err := DecodeSparse(append([]byte(sparseMagic+"\x01"), withSymbolCount(t, body, 1<<40, text)...)); err == nil {
+		t.Error("DecodeSparse accepted a huge symbol count")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// englishLetterFrequencies are approximate per-mille frequencies of letters
+// in English text
+var englishLetterFrequencies = map[rune]int{
+	'e': 127, 't': 91, 'a': 82, 'o': 75, 'i': 70, 'n': 67, 's': 63, 'h': 61,
+	'r': 60, 'd': 43, 'l': 40, 'c': 28, 'u': 28, 'm': 24, 'w': 24, 'f': 22,
+	'g': 20, 'y': 20, 'p': 19, 'b': 15, 'v': 10, 'k': 8, 'j': 2, 'x': 2,
+	'q': 1, 'z': 1,
+}
+
+// StaticFrequencies returns the fixed frequency table used by fast mode. It
+// covers all of ASCII, weighted toward English prose.
+func StaticFrequencies() map[rune]int {
+	frequency := make(map[rune]int, 128)
+	for char := rune(0); char < 128; char++ {
+		frequency[char] = 1
+	}
+	for char, freq := range englishLetterFrequencies {
+		frequency[char] = freq * 10
+		frequency[char-'a'+'A'] = max(freq/2, 1)
+	}
+	frequency[' '] = 1800
+	frequency['\n'] = 40
+	for _, char := range ".,'\"-" {
+		frequency[char] = 60
+	}
+	for char := '0'; char <= '9'; char++ {
+		frequency[char] = 30
+	}
+	return frequency
+}
+
+var (
+	staticOnce  sync.Once
+	staticTree  *HuffmanNode
+	staticCodes map[rune]string
+)
+
+// StaticTree returns the tree built from StaticFrequencies, which is the
+// same in every process, so fast-mode files need not store it
+func StaticTree() (*HuffmanNode, map[rune]string) {
+	staticOnce.Do(func() {
+		staticTree = BuildHuffmanTree(StaticFrequencies())
+		staticCodes = BuildCodes(staticTree)
+	})
+	return staticTree, staticCodes
+}
+
+// ErrNotStatic is returned when fast mode is asked to encode a symbol the
+// static table does not cover
+var ErrNotStatic = errors.New("input has symbols outside the static table")
+
+var (
+	storedOnce sync.Once
+	storedTree *HuffmanNode
+)
+
+// StoredTree returns the tree of FlagStored containers: every byte value
+// has an 8-bit code equal to its own bits, so the payload is the original
+// bytes unchanged
+func StoredTree() *HuffmanNode {
+	storedOnce.Do(func() {
+		lengths := make(map[rune]int, 256)
+		for b := 0; b < 256; b++ {
+			lengths[rune(b)] = 8
+		}
+		// Equal 8-bit codes for all 256 bytes always form a prefix code
+		storedTree, _ = CanonicalTree(lengths)
+	})
+	return storedTree
+}
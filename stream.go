@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"unicode/utf8"
+)
+
+// Decoder decodes a packed Huffman payload read from an io.Reader,
+// exposing the decoded text as an io.Reader. A Decoder is not safe for
+// concurrent use, but many Decoders may share one tree.
+type Decoder struct {
+	bits    *bitReader
+	root    *HuffmanNode
+	pending []byte // encoded bytes of the last rune not yet returned
+	scratch [utf8.UTFMax]byte
+	err     error
+	bytes   bool      // symbols are bytes rather than runes
+	lsb     bool      // the payload is packed least significant bit first
+	pads    []Padding // Flush padding still to be skipped, in order
+
+	base        int64 // input offset of the payload, for checkpoints
+	outputBytes int64 // bytes returned by Read
+
+	// Set for FlagRLE payloads, to expand run symbols
+	rle     bool
+	last    rune // last symbol that was not a run symbol
+	started bool // last is set
+	repeat  int  // copies of last still to be returned
+
+	// Set when decoding a container, to verify the output at EOF
+	header  *HuffHeader
+	crc     uint32
+	size    uint64
+	symbols uint64
+}
+
+// NewDecoder returns a Decoder reading bitCount bits of packed payload from r
+func NewDecoder(r io.Reader, root *HuffmanNode, bitCount int) *Decoder {
+	return &Decoder{bits: newBitReader(r, bitCount), root: root}
+}
+
+// NewContainerDecoder reads a .huff header from r and returns a Decoder for
+// its payload. The decoded text is checked against the sizes and checksum in
+// the header, or in the footer of a FlagFooter container, when the payload
+// ends; a mismatch is reported by Read in place of io.EOF.
+func NewContainerDecoder(r io.Reader) (*Decoder, error) {
+	br := bufio.NewReader(r)
+	h, err := readHuffHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	return newContainerDecoder(br, h), nil
+}
+
+// newContainerDecoder returns a Decoder for the payload following header h
+func newContainerDecoder(br *bufio.Reader, h *HuffHeader) *Decoder {
+	if h.Flags&FlagFooter != 0 {
+		return newFooterDecoder(br, h)
+	}
+	var r io.Reader = br
+	if h.Flags&FlagLSBFirst != 0 {
+		r = lsbFirstReader{br}
+	}
+	d := NewDecoder(r, h.DecodingTree(), int(h.BitCount))
+	d.header = h
+	d.bytes = h.Flags&FlagBytes != 0
+	d.lsb = h.Flags&FlagLSBFirst != 0
+	d.rle = h.Flags&FlagRLE != 0
+	d.base = int64(h.Size())
+	return d
+}
+
+// Header returns the container header, or nil if the Decoder was not
+// created by NewContainerDecoder
+func (d *Decoder) Header() *HuffHeader {
+	return d.header
+}
+
+// Read reads decoded UTF-8 text, or raw bytes for a byte-coded container,
+// into p
+func (d *Decoder) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(d.pending) > 0 {
+			c := copy(p[n:], d.pending)
+			d.pending = d.pending[c:]
+			n += c
+			continue
+		}
+		if d.err != nil {
+			break
+		}
+		char, err := d.nextSymbol()
+		if err == io.EOF && d.header != nil {
+			err = d.verify()
+		}
+		if err != nil {
+			d.err = err
+			break
+		}
+		if d.bytes {
+			d.pending = append(d.scratch[:0], byte(char))
+		} else {
+			d.pending = utf8.AppendRune(d.scratch[:0], char)
+		}
+		if d.header != nil {
+			d.crc = crc32.Update(d.crc, crc32.IEEETable, d.pending)
+			d.size += uint64(len(d.pending))
+			d.symbols++
+		}
+	}
+	d.outputBytes += int64(n)
+	if n > 0 {
+		return n, nil
+	}
+	return 0, d.err
+}
+
+// WriteTo decodes the rest of the payload to w, implementing io.WriterTo
+// so io.Copy needs no intermediate buffer of its own. A container's
+// checksum is verified before WriteTo returns nil.
+func (d *Decoder) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, copyBufferSize)
+	var written int64
+	for {
+		n, err := d.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			if m < n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// verify checks the decoded output against the container header, returning
+// io.EOF if it matches
+func (d *Decoder) verify() error {
+	if err := d.header.check(d.size, d.symbols, d.crc); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// nextSymbol returns the next symbol of the text, expanding run symbols
+// of a FlagRLE payload
+func (d *Decoder) nextSymbol() (rune, error) {
+	if d.repeat > 0 {
+		d.repeat--
+		return d.last, nil
+	}
+	char, err := d.next()
+	if err != nil || !d.rle {
+		return char, err
+	}
+	if repeats, ok := runRepeats(char); ok {
+		if !d.started {
+			return 0, errRunWithoutSymbol
+		}
+		d.repeat = repeats - 1
+		return d.last, nil
+	}
+	d.last, d.started = char, true
+	return char, nil
+}
+
+// next decodes a single symbol, returning io.EOF at the end of the payload
+func (d *Decoder) next() (rune, error) {
+	for len(d.pads) > 0 && d.bits.consumed >= d.pads[0].Offset {
+		for i := d.bits.consumed - d.pads[0].Offset; i < d.pads[0].Bits; i++ {
+			if _, err := d.bits.readBit(); err != nil {
+				return 0, unexpectedEOF(err)
+			}
+		}
+		d.pads = d.pads[1:]
+	}
+	if d.root == nil {
+		if _, err := d.bits.readBit(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("cannot decode with an empty tree")
+	}
+	node := d.root
+	for started := false; ; started = true {
+		bit, err := d.bits.readBit()
+		if err == io.EOF && started {
+			return 0, decodeErrorAt(d.bits.consumed, errTruncatedCode)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if d.root.left == nil && d.root.right == nil {
+			// A single-symbol tree: every bit is one occurrence
+		} else if bit == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+		if node == nil {
+			return 0, decodeErrorAt(d.bits.consumed-1, errInvalidCode)
+		}
+		if node.left == nil && node.right == nil {
+			return node.character, nil
+		}
+	}
+}
+
+// SkipPadding makes the Decoder skip the pad bits an Encoder's Flush calls
+// added, as reported by Encoder.Padding, so a payload flushed mid-stream
+// decodes whole. Without it the pad bits are read as codes.
+func (d *Decoder) SkipPadding(pads []Padding) {
+	d.pads = slices.Clone(pads)
+}
+
+// decodeToBufferSize is how many decoded bytes DecodeTo accumulates
+// before each Write
+const decodeToBufferSize = 4096
+
+// DecodeTo decodes bitCount bits of packed payload and writes the text to w
+// in chunks as it goes, rather than building the whole output first. Every
+// Write is checked, so a failing or short-writing destination stops the
+// decode promptly with its error.
+func DecodeTo(w io.Writer, data []byte, bitCount int, root *HuffmanNode) error {
+	return DecodeChunked(data, bitCount, root, decodeToBufferSize, func(chunk []byte) error {
+		n, err := w.Write(chunk)
+		if err == nil && n < len(chunk) {
+			err = io.ErrShortWrite
+		}
+		return err
+	})
+}
+
+// DecodeChunked decodes like DecodeBytes but passes the text to fn in
+// chunks of at most chunkSize bytes as decoding proceeds, so the whole
+// output is never held at once. Chunks always end on a rune boundary; only
+// a chunkSize smaller than one encoded rune yields longer chunks. The
+// slice is reused after fn returns, and an error from fn stops decoding.
+func DecodeChunked(data []byte, bitCount int, root *HuffmanNode, chunkSize int, fn func([]byte) error) error {
+	if chunkSize < 1 {
+		return fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	buf := make([]byte, 0, chunkSize+utf8.UTFMax)
+	err := decodeSymbols(data, bitCount, root, func(char rune) error {
+		if len(buf) > 0 && len(buf)+utf8.RuneLen(char) > chunkSize {
+			if err := fn(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+		buf = utf8.AppendRune(buf, char)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(buf) > 0 {
+		return fn(buf)
+	}
+	return nil
+}
+
+// copyBufferSize is the buffer size of Encoder.ReadFrom and
+// Decoder.WriteTo
+const copyBufferSize = 32 << 10
+
+// encoderBufferSize is how many packed bytes the Encoder accumulates before
+// writing them to the underlying writer, unless SetWatermark changes it
+const encoderBufferSize = 4096
+
+// Encoder Huffman-codes UTF-8 text written to it and writes the packed
+// payload, most significant bit first, to an underlying io.Writer
+type Encoder struct {
+	w        io.Writer
+	codes    map[rune]string
+	buf      []byte // packed bytes not yet written to w
+	flushAt  int    // length of buf that triggers a write to w
+	cur      byte   // partial byte being filled
+	curBits  uint   // bits used in cur
+	bitCount int    // bits emitted, including Flush padding
+	partial  []byte // leading bytes of a rune split across Writes
+	pads     []Padding
+	err      error
+
+	symbols     int64  // runes encoded
+	inputBytes  int64  // bytes accepted by Write
+	outputBytes int64  // bytes written to w
+	crc         uint32 // CRC-32 (IEEE) of the input accepted by Write
+
+	stats         func(EncoderStats)
+	statsInterval int64
+	nextStats     int64 // input offset of the next stats emission
+}
+
+// EncoderStats is a snapshot of an Encoder's progress
+type EncoderStats struct {
+	InputBytes  int64
+	OutputBits  int     // payload bits emitted
+	OutputBytes int64   // OutputBits rounded up to whole bytes
+	Ratio       float64 // OutputBytes / InputBytes, or 0 before any input
+}
+
+// NewEncoder returns an Encoder writing to w using the given codes
+func NewEncoder(w io.Writer, codes map[rune]string) *Encoder {
+	return &Encoder{w: w, codes: codes, buf: make([]byte, 0, encoderBufferSize), flushAt: encoderBufferSize}
+}
+
+// SetWatermark makes the Encoder write to the underlying writer whenever n
+// packed bytes have accumulated, instead of the default 4096. A higher
+// watermark means fewer and larger Writes, and so fewer syscalls when
+// writing to a file or connection; a lower one hands data on sooner, down
+// to one Write per byte at n = 1, which suits latency-sensitive streams.
+// The output is the same either way. Values below 1 are treated as 1. Any
+// bytes already buffered beyond the new watermark are written at once.
+func (e *Encoder) SetWatermark(n int) error {
+	e.flushAt = max(n, 1)
+	if len(e.buf) >= e.flushAt {
+		return e.writeBuffered()
+	}
+	return nil
+}
+
+// SetStatsCallback arranges for fn to receive statistics from the first
+// Write after each further interval bytes of input, and once more from
+// Close, after the final partial byte has been flushed
+func (e *Encoder) SetStatsCallback(interval int64, fn func(EncoderStats)) {
+	e.stats, e.statsInterval, e.nextStats = fn, interval, e.inputBytes+interval
+}
+
+// Stats returns the Encoder's progress so far
+func (e *Encoder) Stats() EncoderStats {
+	s := EncoderStats{InputBytes: e.inputBytes, OutputBits: e.bitCount, OutputBytes: int64(e.bitCount+7) / 8}
+	if s.InputBytes > 0 {
+		s.Ratio = float64(s.OutputBytes) / float64(s.InputBytes)
+	}
+	return s
+}
+
+// ReadFrom encodes everything read from r until io.EOF, implementing
+// io.ReaderFrom so io.Copy to an Encoder reads straight into one buffer.
+// It does not Close the Encoder.
+func (e *Encoder) ReadFrom(r io.Reader) (int64, error) {
+	buf := make([]byte, copyBufferSize)
+	var read int64
+	for {
+		n, err := r.Read(buf)
+		read += int64(n)
+		if n > 0 {
+			if _, werr := e.Write(buf[:n]); werr != nil {
+				return read, werr
+			}
+		}
+		if err == io.EOF {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+}
+
+// errEncoderClosed is returned when writing to a closed Encoder
+var errEncoderClosed = errors.New("write to closed Encoder")
+
+// Write encodes the UTF-8 text in p. A rune split across two Writes is
+// held back until it is complete.
+func (e *Encoder) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n := len(p)
+	e.inputBytes += int64(n)
+	e.crc = crc32.Update(e.crc, crc32.IEEETable, p)
+
+	// Complete a rune split across Writes, one byte at a time
+	for len(e.partial) > 0 && len(p) > 0 {
+		e.partial = append(e.partial, p[0])
+		p = p[1:]
+		tail, err := e.encodeRunes(e.partial)
+		if err != nil {
+			return 0, err
+		}
+		e.partial = append(e.partial[:0], tail...)
+	}
+
+	tail, err := e.encodeRunes(p)
+	if err != nil {
+		return 0, err
+	}
+	e.partial = append(e.partial, tail...)
+	if e.stats != nil && e.inputBytes >= e.nextStats {
+		e.stats(e.Stats())
+		e.nextStats = e.inputBytes + e.statsInterval
+	}
+	return n, nil
+}
+
+// encodeRunes encodes every complete rune in p and returns the bytes of a
+// trailing incomplete rune
+func (e *Encoder) encodeRunes(p []byte) ([]byte, error) {
+	for len(p) > 0 && utf8.FullRune(p) {
+		char, size := utf8.DecodeRune(p)
+		p = p[size:]
+		code, ok := e.codes[char]
+		if !ok {
+			e.err = fmt.Errorf("symbol %q is not in the code table", char)
+			return nil, e.err
+		}
+		if err := e.writeCode(code); err != nil {
+			return nil, err
+		}
+		e.symbols++
+	}
+	return p, nil
+}
+
+// writeCode appends the bits of one code
+func (e *Encoder) writeCode(code string) error {
+	for i := 0; i < len(code); i++ {
+		e.cur = e.cur<<1 | (code[i] - '0')
+		e.curBits++
+		e.bitCount++
+		if e.curBits == 8 {
+			e.buf = append(e.buf, e.cur)
+			e.cur, e.curBits = 0, 0
+			if len(e.buf) >= e.flushAt {
+				if err := e.writeBuffered(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeBuffered writes the packed bytes accumulated so far to w
+func (e *Encoder) writeBuffered() error {
+	if len(e.buf) == 0 {
+		return nil
+	}
+	n, err := e.w.Write(e.buf)
+	e.outputBytes += int64(n)
+	if err != nil {
+		e.err = err
+		return err
+	}
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// Padding is a run of zero bits that Flush added to reach a byte boundary
+type Padding struct {
+	Offset int // payload bit offset of the first pad bit
+	Bits   int
+}
+
+// Flush pads the current partial byte with zero bits to a byte boundary and
+// writes everything buffered to w, returning the number of pad bits added.
+// Bits written after a Flush start on a fresh byte, so the data after each
+// Flush can be decoded on its own. The pad bits are part of the payload and
+// count toward BitCount; a decoder of the whole payload must skip them, by
+// passing Padding to Decoder.SkipPadding.
+func (e *Encoder) Flush() (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	pad := 0
+	if e.curBits > 0 {
+		pad = int(8 - e.curBits)
+		e.buf = append(e.buf, e.cur<<pad)
+		e.cur, e.curBits = 0, 0
+		e.pads = append(e.pads, Padding{Offset: e.bitCount, Bits: pad})
+		e.bitCount += pad
+	}
+	return pad, e.writeBuffered()
+}
+
+// Checksum returns the CRC-32 (IEEE) of the input written so far, as
+// stored in a .huff header, so callers need not checksum the input
+// separately
+func (e *Encoder) Checksum() uint32 {
+	return e.crc
+}
+
+// Padding returns the pad bits added by each Flush that was not already on
+// a byte boundary, in payload order
+func (e *Encoder) Padding() []Padding {
+	return slices.Clone(e.pads)
+}
+
+// BitCount returns the number of bits emitted so far, including any
+// padding added by Flush
+func (e *Encoder) BitCount() int {
+	return e.bitCount
+}
+
+// Close writes the final partial byte, padded with zero bits, and any
+// buffered data. Unlike Flush, the final padding is not counted in BitCount,
+// since it only fills out the last byte of the payload.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if len(e.partial) > 0 {
+		e.err = errors.New("input ends with an incomplete UTF-8 sequence")
+		return e.err
+	}
+	if e.curBits > 0 {
+		e.buf = append(e.buf, e.cur<<(8-e.curBits))
+		e.cur, e.curBits = 0, 0
+	}
+	if err := e.writeBuffered(); err != nil {
+		return err
+	}
+	if e.stats != nil {
+		e.stats(e.Stats())
+	}
+	e.err = errEncoderClosed
+	return nil
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+// shortReader returns at most max bytes per Read, and every other call
+// returns none at all, as a slow network connection may
+type shortReader struct {
+	r     io.Reader
+	max   int
+	calls int
+}
+
+func (s *shortReader) Read(p []byte) (int, error) {
+	s.calls++
+	if s.calls%2 == 0 {
+		return 0, nil
+	}
+	if len(p) > s.max {
+		p = p[:s.max]
+	}
+	return s.r.Read(p)
+}
+
+func TestDecoderShortReads(t *testing.T) {
+	text := strings.Repeat("streaming decoders must survive short reads; ", 40)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	want, err := DecodeBytes(payload, bitCount, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readers := []struct {
+		name string
+		r    func() io.Reader
+	}{
+		{"full buffer", func() io.Reader { return bytes.NewReader(payload) }},
+		{"one byte", func() io.Reader { return iotest.OneByteReader(bytes.NewReader(payload)) }},
+		{"two bytes with empty reads", func() io.Reader { return &shortReader{r: bytes.NewReader(payload), max: 2} }},
+		{"half reads", func() io.Reader { return iotest.HalfReader(bytes.NewReader(payload)) }},
+		{"eof with data", func() io.Reader { return iotest.DataErrReader(bytes.NewReader(payload)) }},
+	}
+	for _, tt := range readers {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := io.ReadAll(NewDecoder(tt.r(), root, bitCount))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("decoded %d bytes that differ from the full-buffer decode", len(got))
+			}
+		})
+	}
+}
+
+func TestContainerDecoderShortReads(t *testing.T) {
+	text := strings.Repeat("container over a trickle ", 30)
+	var buf bytes.Buffer
+	if err := WriteHuffFile(&buf, text); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewContainerDecoder(&shortReader{r: bytes.NewReader(buf.Bytes()), max: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != text {
+		t.Error("container decoded over short reads differs from the original")
+	}
+}
+
+func TestDecoderTruncatedInput(t *testing.T) {
+	text := "truncated payloads are reported"
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	d := NewDecoder(bytes.NewReader(payload[:len(payload)/2]), root, bitCount)
+	if _, err := io.ReadAll(d); err != io.ErrUnexpectedEOF {
+		t.Errorf("error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// writeCounter records the size of each Write it receives
+type writeCounter struct {
+	buf   bytes.Buffer
+	sizes []int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.sizes = append(w.sizes, len(p))
+	return w.buf.Write(p)
+}
+
+func TestEncoderWatermark(t *testing.T) {
+	text := strings.Repeat("small watermarks must not change the output ", 30)
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+	want, _ := PackBits(Encode(text, codes))
+	for _, watermark := range []int{-1, 1, 2, 3, 7, 100, encoderBufferSize, 1 << 20} {
+		t.Run(fmt.Sprint(watermark), func(t *testing.T) {
+			var w writeCounter
+			e := NewEncoder(&w, codes)
+			if err := e.SetWatermark(watermark); err != nil {
+				t.Fatal(err)
+			}
+			// Unaligned Writes split runes and codes across calls
+			for rest := text; len(rest) > 0; rest = rest[min(13, len(rest)):] {
+				if _, err := e.Write([]byte(rest[:min(13, len(rest))])); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(w.buf.Bytes(), want) {
+				t.Fatal("output differs from PackBits")
+			}
+			// Every Write but the last from Close is exactly one watermark
+			for i, size := range w.sizes[:len(w.sizes)-1] {
+				if size != max(watermark, 1) {
+					t.Fatalf("Write %d of %d bytes, want %d", i, size, max(watermark, 1))
+				}
+			}
+		})
+	}
+}
+
+func TestSetWatermarkFlushesBuffered(t *testing.T) {
+	text := strings.Repeat("lowering the watermark hands buffered bytes on ", 10)
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+	var w writeCounter
+	e := NewEncoder(&w, codes)
+	if _, err := e.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.sizes) != 0 {
+		t.Fatalf("%d Writes below the default watermark", len(w.sizes))
+	}
+	if err := e.SetWatermark(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.sizes) != 1 || w.sizes[0] != e.BitCount()/8 {
+		t.Errorf("SetWatermark(1) made Writes of %v bytes, want one of %d", w.sizes, e.BitCount()/8)
+	}
+}
+
+// BenchmarkEncoderWatermark encodes a 4 MiB stream at several watermarks,
+// reporting the Writes reaching the underlying writer per operation
+func BenchmarkEncoderWatermark(b *testing.B) {
+	text := benchmarkText(4 << 20)
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+	input := []byte(text)
+	for _, watermark := range []int{1, 64, 512, encoderBufferSize, 64 << 10} {
+		b.Run(fmt.Sprint(watermark), func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			var w writeCounter
+			for i := 0; i < b.N; i++ {
+				w.buf.Reset()
+				w.sizes = w.sizes[:0]
+				e := NewEncoder(&w, codes)
+				e.SetWatermark(watermark)
+				e.Write(input)
+				if err := e.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(w.sizes)), "writes/op")
+		})
+	}
+}
+
+// BenchmarkEnglishDecode decodes testdata/english.txt, about 14 KB of
+// plain English prose, with the streaming Decoder and with one-shot Decode.
+// Real prose is more skewed than benchmarkText's even word draws. Decode
+// concatenates strings, so its MB/s falls as the corpus grows, while the
+// Decoder's does not; compare results across machines at this size.
+func BenchmarkEnglishDecode(b *testing.B) {
+	data, err := os.ReadFile(filepath.Join("testdata", "english.txt"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	text := string(data)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	encoded := Encode(text, BuildCodes(root))
+	payload, bitCount := PackBits(encoded)
+
+	b.Run("Decoder", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			n, err := io.Copy(io.Discard, NewDecoder(bytes.NewReader(payload), root, bitCount))
+			if err != nil || n != int64(len(data)) {
+				b.Fatalf("decoded %d bytes, %v", n, err)
+			}
+		}
+	})
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if Decode(encoded, root) != text {
+				b.Fatal("Decode differs from the corpus")
+			}
+		}
+	})
+}
+
+func TestEncoderFlushResync(t *testing.T) {
+	first, second := "the first message", " and then the second"
+	text := first + second
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	codes := BuildCodes(root)
+
+	var out bytes.Buffer
+	e := NewEncoder(&out, codes)
+	if _, err := e.Write([]byte(first)); err != nil {
+		t.Fatal(err)
+	}
+	firstBits := e.BitCount()
+	pad, err := e.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstBits%8 == 0 {
+		t.Fatalf("the first message codes to %d bits, so Flush has nothing to pad", firstBits)
+	}
+	if want := 8 - firstBits%8; pad != want {
+		t.Fatalf("Flush added %d pad bits after %d bits, want %d", pad, firstBits, want)
+	}
+	if out.Len()*8 != firstBits+pad {
+		t.Fatalf("Flush wrote %d bytes for %d bits", out.Len(), firstBits)
+	}
+	// A second Flush on a byte boundary adds nothing
+	if pad, err := e.Flush(); err != nil || pad != 0 {
+		t.Fatalf("Flush on a boundary = %d, %v", pad, err)
+	}
+	if _, err := e.Write([]byte(second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	payload, bitCount := out.Bytes(), e.BitCount()
+	if want := []Padding{{Offset: firstBits, Bits: pad}}; !slices.Equal(e.Padding(), want) {
+		t.Errorf("Padding = %v, want %v", e.Padding(), want)
+	}
+
+	// The whole payload decodes once the pad bits are skipped
+	d := NewDecoder(bytes.NewReader(payload), root, bitCount)
+	d.SkipPadding(e.Padding())
+	got, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != text {
+		t.Errorf("whole decode = %q, want %q", got, text)
+	}
+
+	// Each side of the boundary decodes on its own
+	boundary := (firstBits + pad) / 8
+	got, err = io.ReadAll(NewDecoder(bytes.NewReader(payload[:boundary]), root, firstBits))
+	if err != nil || string(got) != first {
+		t.Errorf("decode before the Flush = %q, %v; want %q", got, err, first)
+	}
+	got, err = io.ReadAll(NewDecoder(bytes.NewReader(payload[boundary:]), root, bitCount-firstBits-pad))
+	if err != nil || string(got) != second {
+		t.Errorf("decode after the Flush = %q, %v; want %q", got, err, second)
+	}
+}
+
+// failingWriter accepts ok Writes and fails every one after them
+type failingWriter struct {
+	ok     int
+	short  bool // fail by writing less instead of returning an error
+	writes int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes <= w.ok {
+		return len(p), nil
+	}
+	if w.short {
+		return len(p) / 2, nil
+	}
+	return 0, errWriteFailed
+}
+
+func TestDecodeToFailingWriter(t *testing.T) {
+	text := benchmarkText(10 * decodeToBufferSize)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+
+	var out bytes.Buffer
+	if err := DecodeTo(&out, payload, bitCount, root); err != nil || out.String() != text {
+		t.Fatalf("DecodeTo = %d bytes, %v; want the %d byte text", out.Len(), err, len(text))
+	}
+
+	tests := []struct {
+		name string
+		w    *failingWriter
+		want error
+	}{
+		{"first write", &failingWriter{}, errWriteFailed},
+		{"later write", &failingWriter{ok: 3}, errWriteFailed},
+		{"short write", &failingWriter{ok: 2, short: true}, io.ErrShortWrite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := DecodeTo(tt.w, payload, bitCount, root); !errors.Is(err, tt.want) {
+				t.Errorf("DecodeTo error %v, want %v", err, tt.want)
+			}
+			if tt.w.writes != tt.w.ok+1 {
+				t.Errorf("%d writes, want decoding to stop after write %d", tt.w.writes, tt.w.ok+1)
+			}
+		})
+	}
+}
+
+func TestDecodeChunked(t *testing.T) {
+	text := strings.Repeat("chunks end on rune boundaries: 日本語 ünïcödé 🙂 ", 40)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	for _, chunkSize := range []int{1, 2, 3, 5, 64, 4096, len(text), 2 * len(text)} {
+		t.Run(fmt.Sprint(chunkSize), func(t *testing.T) {
+			var sb strings.Builder
+			chunks, short := 0, 0
+			err := DecodeChunked(payload, bitCount, root, chunkSize, func(chunk []byte) error {
+				chunks++
+				if !utf8.Valid(chunk) {
+					t.Fatalf("chunk %d splits a rune: %q", chunks, chunk)
+				}
+				// Only a single rune may exceed the chunk size
+				if len(chunk) > chunkSize && utf8.RuneCount(chunk) > 1 {
+					t.Fatalf("chunk %d is %d bytes, over the %d byte size", chunks, len(chunk), chunkSize)
+				}
+				if len(chunk)+utf8.UTFMax <= chunkSize {
+					short++
+				}
+				sb.Write(chunk)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sb.String() != text {
+				t.Error("reassembled chunks differ from the text")
+			}
+			if short > 1 {
+				t.Errorf("%d chunks had room for another rune, want only the last", short)
+			}
+		})
+	}
+
+	if err := DecodeChunked(payload, bitCount, root, 0, func([]byte) error { return nil }); err == nil {
+		t.Error("no error for a chunk size of 0")
+	}
+	calls := 0
+	err := DecodeChunked(payload, bitCount, root, 16, func([]byte) error {
+		calls++
+		return errWriteFailed
+	})
+	if !errors.Is(err, errWriteFailed) || calls != 1 {
+		t.Errorf("callback error: %v after %d calls, want errWriteFailed after 1", err, calls)
+	}
+}
+
+func TestEncoderStatsCallback(t *testing.T) {
+	text := benchmarkText(500)
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+	var got []EncoderStats
+	e := NewEncoder(io.Discard, codes)
+	e.SetStatsCallback(100, func(s EncoderStats) { got = append(got, s) })
+	for i := 0; i < len(text); i += 10 {
+		if _, err := e.Write([]byte(text[i : i+10])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// One per 100 bytes of input, then one from Close
+	wantInput := []int64{100, 200, 300, 400, 500, 500}
+	if len(got) != len(wantInput) {
+		t.Fatalf("callback ran %d times, want %d: %+v", len(got), len(wantInput), got)
+	}
+	for i, s := range got {
+		bits := len(Encode(text[:s.InputBytes], codes))
+		if s.InputBytes != wantInput[i] || s.OutputBits != bits || s.OutputBytes != int64(bits+7)/8 {
+			t.Errorf("call %d: %+v, want %d input bytes and %d bits", i, s, wantInput[i], bits)
+		}
+		if want := float64(s.OutputBytes) / float64(s.InputBytes); s.Ratio != want {
+			t.Errorf("call %d: ratio %v, want %v", i, s.Ratio, want)
+		}
+	}
+	if last := got[len(got)-1]; last != e.Stats() {
+		t.Errorf("final callback %+v, Stats %+v", last, e.Stats())
+	}
+}
+
+func TestEncoderChecksum(t *testing.T) {
+	text := strings.Repeat("checksum of everything written, ünïcödé ", 300)
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+	e := NewEncoder(io.Discard, codes)
+	if e.Checksum() != crc32.ChecksumIEEE(nil) {
+		t.Errorf("Checksum before any input = %08x", e.Checksum())
+	}
+	// Uneven writes split runes across calls
+	for i, n := 0, 1; i < len(text); i, n = i+n, n%97+1 {
+		end := min(i+n, len(text))
+		if _, err := e.Write([]byte(text[i:end])); err != nil {
+			t.Fatal(err)
+		}
+		if want := crc32.ChecksumIEEE([]byte(text[:end])); e.Checksum() != want {
+			t.Fatalf("after %d bytes: Checksum = %08x, want %08x", end, e.Checksum(), want)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := crc32.ChecksumIEEE([]byte(text)); e.Checksum() != want {
+		t.Errorf("Checksum = %08x, want %08x", e.Checksum(), want)
+	}
+}
+
+func TestEncoderReadFrom(t *testing.T) {
+	text := benchmarkText(3 * copyBufferSize)
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(text)))
+	want, _ := PackBits(Encode(text, codes))
+
+	readers := []struct {
+		name string
+		r    func() io.Reader
+	}{
+		{"full buffer", func() io.Reader { return strings.NewReader(text) }},
+		{"one byte", func() io.Reader { return iotest.OneByteReader(strings.NewReader(text)) }},
+		{"eof with data", func() io.Reader { return iotest.DataErrReader(strings.NewReader(text)) }},
+	}
+	for _, tt := range readers {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			e := NewEncoder(&out, codes)
+			n, err := io.Copy(e, tt.r())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(text)) {
+				t.Errorf("read %d bytes, want %d", n, len(text))
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Error("ReadFrom output differs from Encode")
+			}
+		})
+	}
+
+	t.Run("read error", func(t *testing.T) {
+		errRead := errors.New("read failed")
+		r := io.MultiReader(strings.NewReader(text[:100]), iotest.ErrReader(errRead))
+		n, err := NewEncoder(io.Discard, codes).ReadFrom(r)
+		if err != errRead {
+			t.Errorf("error = %v, want %v", err, errRead)
+		}
+		if n != 100 {
+			t.Errorf("read %d bytes before the error, want 100", n)
+		}
+	})
+	t.Run("closed", func(t *testing.T) {
+		e := NewEncoder(io.Discard, codes)
+		e.Close()
+		if _, err := e.ReadFrom(strings.NewReader(text)); err != errEncoderClosed {
+			t.Errorf("error = %v, want %v", err, errEncoderClosed)
+		}
+	})
+}
+
+func TestDecoderWriteTo(t *testing.T) {
+	text := benchmarkText(3 * copyBufferSize)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+
+	var out bytes.Buffer
+	n, err := io.Copy(&out, NewDecoder(bytes.NewReader(payload), root, bitCount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(text)) || out.String() != text {
+		t.Errorf("WriteTo wrote %d bytes, want the %d-byte original", n, len(text))
+	}
+
+	tests := []struct {
+		name string
+		w    *failingWriter
+		want error
+	}{
+		{"error", &failingWriter{ok: 1}, errWriteFailed},
+		{"short write", &failingWriter{ok: 1, short: true}, io.ErrShortWrite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := NewDecoder(bytes.NewReader(payload), root, bitCount).WriteTo(tt.w)
+			if err != tt.want {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+			if n <= 0 || n >= int64(len(text)) {
+				t.Errorf("wrote %d bytes, want a partial count", n)
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		d := NewDecoder(bytes.NewReader(payload[:len(payload)/2]), root, bitCount)
+		if _, err := d.WriteTo(io.Discard); err != io.ErrUnexpectedEOF {
+			t.Errorf("error = %v, want io.ErrUnexpectedEOF", err)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PayloadDecoder decodes a packed payload of bitCount bits. The tree
+// (*HuffmanNode), the byte-at-a-time *DecodeTable and *TwoLevelTable all
+// implement it, so callers can switch decoders without changing call sites.
+// It is not named Decoder because that is the streaming io.Reader type.
+type PayloadDecoder interface {
+	Decode(data []byte, bitCount int) (string, error)
+}
+
+// Decode decodes a packed payload by walking the tree bit by bit
+func (n *HuffmanNode) Decode(data []byte, bitCount int) (string, error) {
+	return DecodeBytes(data, bitCount, n)
+}
+
+// tableEntry is the result of feeding one byte to the decoder in one state
+type tableEntry struct {
+	symbols []rune
+	next    int32 // state after the byte, or -1 if the byte holds an invalid code
+	badBit  int8  // bit within the byte at which the invalid code was found
+}
+
+// DecodeTable decodes a packed payload a whole byte at a time. Each internal
+// node of the tree is a state, and for every state and byte value the table
+// holds the symbols emitted and the state reached.
+type DecodeTable struct {
+	root    *HuffmanNode
+	nodes   []*HuffmanNode // internal nodes, indexed by state
+	entries [][256]tableEntry
+}
+
+// NewDecodeTable builds a lookup table for the tree
+func NewDecodeTable(root *HuffmanNode) *DecodeTable {
+	t := &DecodeTable{root: root}
+	if root == nil || (root.left == nil && root.right == nil) {
+		return t
+	}
+
+	index := make(map[*HuffmanNode]int32)
+	var collect func(node *HuffmanNode)
+	collect = func(node *HuffmanNode) {
+		if node == nil || (node.left == nil && node.right == nil) {
+			return
+		}
+		index[node] = int32(len(t.nodes))
+		t.nodes = append(t.nodes, node)
+		collect(node.left)
+		collect(node.right)
+	}
+	collect(root)
+
+	t.entries = make([][256]tableEntry, len(t.nodes))
+	for state, start := range t.nodes {
+		for b := 0; b < 256; b++ {
+			entry := &t.entries[state][b]
+			node := start
+			for bit := 7; bit >= 0; bit-- {
+				if b&(1<<bit) == 0 {
+					node = node.left
+				} else {
+					node = node.right
+				}
+				if node == nil {
+					entry.next, entry.badBit = -1, int8(7-bit)
+					break
+				}
+				if node.left == nil && node.right == nil {
+					entry.symbols = append(entry.symbols, node.character)
+					node = root
+				}
+			}
+			if entry.next != -1 {
+				entry.next = index[node]
+			}
+		}
+	}
+	return t
+}
+
+// Thresholds for ReadHuffFile to decode by table rather than by tree walk:
+// the table holds 256 entries per internal node, so it only pays off for
+// small alphabets and payloads large enough to amortize building it
+const (
+	tableMinPayload = 64 << 10
+	tableMaxSymbols = 257
+)
+
+// PrewarmDecodeTable starts building the lookup table for root in a
+// background goroutine, so the work overlaps with reading the payload. The
+// returned function waits for the table; it may be called more than once.
+func PrewarmDecodeTable(root *HuffmanNode) func() *DecodeTable {
+	done := make(chan struct{})
+	var t *DecodeTable
+	go func() {
+		t = NewDecodeTable(root)
+		close(done)
+	}()
+	return func() *DecodeTable {
+		<-done
+		return t
+	}
+}
+
+// Decode decodes a packed payload using the lookup table
+func (t *DecodeTable) Decode(data []byte, bitCount int) (string, error) {
+	if bitCount > len(data)*8 {
+		return "", fmt.Errorf("bit count %d exceeds the %d bits of data", bitCount, len(data)*8)
+	}
+	if t.root == nil {
+		if bitCount > 0 {
+			return "", errors.New("cannot decode with an empty tree")
+		}
+		return "", nil
+	}
+	if t.nodes == nil {
+		// A single-symbol tree: every bit is one occurrence
+		return strings.Repeat(string(t.root.character), bitCount), nil
+	}
+
+	var sb strings.Builder
+	state := int32(0)
+	full := bitCount / 8
+	for i := 0; i < full; i++ {
+		entry := &t.entries[state][data[i]]
+		if entry.next < 0 {
+			return "", decodeErrorAt(i*8+int(entry.badBit), errInvalidCode)
+		}
+		for _, char := range entry.symbols {
+			sb.WriteRune(char)
+		}
+		state = entry.next
+	}
+
+	// Walk the bits of a trailing partial byte one at a time
+	node := t.nodes[state]
+	for i := full * 8; i < bitCount; i++ {
+		if data[i/8]&(0x80>>(i%8)) == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+		if node == nil {
+			return "", decodeErrorAt(i, errInvalidCode)
+		}
+		if node.left == nil && node.right == nil {
+			sb.WriteRune(node.character)
+			node = t.root
+		}
+	}
+	if node != t.root {
+		return "", decodeErrorAt(bitCount, errTruncatedCode)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sizes of the TwoLevelTable stages. Codes of up to primaryBits bits
+// decode with one lookup and codes of up to primaryBits+secondaryBits bits
+// with two; longer codes finish with a tree walk.
+const (
+	primaryBits   = 9
+	secondaryBits = 8
+)
+
+// Kinds of levelEntry
+const (
+	entryInvalid = iota // the bits match no code
+	entryLeaf           // a code ends within the bits
+	entryNode           // the bits end inside a longer code
+)
+
+// levelEntry is the result of looking up a group of bits in one stage
+type levelEntry struct {
+	kind    uint8
+	length  uint8 // bits consumed for a leaf; bits before the bad one if invalid
+	subBits uint8 // width of the secondary table, for primary node entries
+	symbol  rune
+	sub     int32        // start of the secondary table, for primary node entries
+	node    *HuffmanNode // node reached, for node entries
+}
+
+// TwoLevelTable decodes a packed payload with a primaryBits-wide lookup
+// table for short codes and a small secondary table under each longer
+// prefix. Unlike DecodeTable, whose size grows with every internal node,
+// it needs at most 2^primaryBits secondary tables of 2^secondaryBits
+// entries, so memory stays bounded however large the alphabet is.
+type TwoLevelTable struct {
+	root      *HuffmanNode
+	primary   []levelEntry
+	secondary []levelEntry
+}
+
+// NewTwoLevelTable builds a two-level lookup table for the tree
+func NewTwoLevelTable(root *HuffmanNode) *TwoLevelTable {
+	t := &TwoLevelTable{root: root}
+	if root == nil || (root.left == nil && root.right == nil) {
+		return t
+	}
+	t.primary = fillLevel(nil, root, primaryBits)
+	for i := range t.primary {
+		e := &t.primary[i]
+		if e.kind != entryNode {
+			continue
+		}
+		e.subBits = uint8(min(edgeDepth(e.node), secondaryBits))
+		e.sub = int32(len(t.secondary))
+		t.secondary = fillLevel(t.secondary, e.node, uint(e.subBits))
+	}
+	return t
+}
+
+// fillLevel appends the 2^bits entries for lookups starting at node
+func fillLevel(dst []levelEntry, node *HuffmanNode, bits uint) []levelEntry {
+	for v := 0; v < 1<<bits; v++ {
+		n := node
+		e := levelEntry{kind: entryNode}
+		for i := uint(0); i < bits; i++ {
+			if v&(1<<(bits-1-i)) == 0 {
+				n = n.left
+			} else {
+				n = n.right
+			}
+			if n == nil {
+				e = levelEntry{kind: entryInvalid, length: uint8(i)}
+				break
+			}
+			if n.left == nil && n.right == nil {
+				e = levelEntry{kind: entryLeaf, length: uint8(i + 1), symbol: n.character}
+				break
+			}
+		}
+		if e.kind == entryNode {
+			e.node = n
+		}
+		dst = append(dst, e)
+	}
+	return dst
+}
+
+// peekBits returns the n bits of data starting at bit offset i, which the
+// caller guarantees are all in range
+func peekBits(data []byte, i int, n uint) int {
+	var v uint64
+	for b := i / 8; b < len(data) && b < i/8+8; b++ {
+		v |= uint64(data[b]) << (56 - 8*(b-i/8))
+	}
+	return int(v << (i % 8) >> (64 - n))
+}
+
+// walkFrom decodes one symbol by walking the tree from node starting at
+// bit offset i, returning the symbol and the offset after its code
+func walkFrom(data []byte, bitCount int, node *HuffmanNode, i int) (rune, int, error) {
+	for {
+		if i == bitCount {
+			return 0, i, decodeErrorAt(bitCount, errTruncatedCode)
+		}
+		if data[i/8]&(0x80>>(i%8)) == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+		if node == nil {
+			return 0, i, decodeErrorAt(i, errInvalidCode)
+		}
+		i++
+		if node.left == nil && node.right == nil {
+			return node.character, i, nil
+		}
+	}
+}
+
+// Decode decodes the first bitCount bits of data
+func (t *TwoLevelTable) Decode(data []byte, bitCount int) (string, error) {
+	if bitCount > len(data)*8 {
+		return "", fmt.Errorf("bit count %d exceeds the %d bits of data", bitCount, len(data)*8)
+	}
+	if t.root == nil {
+		if bitCount > 0 {
+			return "", errors.New("cannot decode with an empty tree")
+		}
+		return "", nil
+	}
+	if t.primary == nil {
+		// A single-symbol tree: every bit is one occurrence
+		return strings.Repeat(string(t.root.character), bitCount), nil
+	}
+
+	var sb strings.Builder
+	i := 0
+	// Table lookups need every bit they peek at to be real, so the last
+	// few symbols are decoded by walking the tree
+	for bitCount-i >= primaryBits+secondaryBits {
+		e := &t.primary[peekBits(data, i, primaryBits)]
+		switch e.kind {
+		case entryLeaf:
+			sb.WriteRune(e.symbol)
+			i += int(e.length)
+			continue
+		case entryInvalid:
+			return "", decodeErrorAt(i+int(e.length), errInvalidCode)
+		}
+		i += primaryBits
+		se := &t.secondary[int(e.sub)+peekBits(data, i, uint(e.subBits))]
+		switch se.kind {
+		case entryLeaf:
+			sb.WriteRune(se.symbol)
+			i += int(se.length)
+		case entryInvalid:
+			return "", decodeErrorAt(i+int(se.length), errInvalidCode)
+		default:
+			char, next, err := walkFrom(data, bitCount, se.node, i+int(e.subBits))
+			if err != nil {
+				return "", err
+			}
+			sb.WriteRune(char)
+			i = next
+		}
+	}
+	for i < bitCount {
+		char, next, err := walkFrom(data, bitCount, t.root, i)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(char)
+		i = next
+	}
+	return sb.String(), nil
+}
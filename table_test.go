@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// payloadDecoders returns every PayloadDecoder implementation for root
+func payloadDecoders(root *HuffmanNode) []struct {
+	name    string
+	decoder PayloadDecoder
+} {
+	return []struct {
+		name    string
+		decoder PayloadDecoder
+	}{
+		{"tree", root},
+		{"table", NewDecodeTable(root)},
+		{"two-level table", NewTwoLevelTable(root)},
+	}
+}
+
+func TestPayloadDecoders(t *testing.T) {
+	for _, tt := range roundTripTexts {
+		root := BuildHuffmanTree(BuildFrequencyTable(tt.text))
+		payload, bitCount := PackBits(Encode(tt.text, BuildCodes(root)))
+		for _, d := range payloadDecoders(root) {
+			got, err := d.decoder.Decode(payload, bitCount)
+			if err != nil {
+				t.Errorf("%s, %s: %v", tt.name, d.name, err)
+			} else if got != tt.text {
+				t.Errorf("%s, %s: decoded %q, want %q", tt.name, d.name, got, tt.text)
+			}
+		}
+	}
+}
+
+func TestPayloadDecodersErrors(t *testing.T) {
+	text := "abcdefgh"
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	tests := []struct {
+		name     string
+		data     []byte
+		bitCount int
+	}{
+		{"truncated code", payload, bitCount - 1},
+		{"bit count past the data", payload, len(payload)*8 + 1},
+	}
+	for _, tt := range tests {
+		for _, d := range payloadDecoders(root) {
+			if _, err := d.decoder.Decode(tt.data, tt.bitCount); err == nil {
+				t.Errorf("%s, %s: no error", tt.name, d.name)
+			}
+		}
+	}
+}
+
+func TestPayloadDecodersLongCodes(t *testing.T) {
+	// Fibonacci counts give a maximally skewed tree with codes longer than
+	// a byte, which the tables must resolve across bytes
+	frequency := make(map[rune]int)
+	a, b := 1, 1
+	var sb strings.Builder
+	for char := 'a'; char < 'a'+20; char++ {
+		frequency[char] = a
+		sb.WriteString(strings.Repeat(string(char), a))
+		a, b = b, a+b
+	}
+	text := sb.String()
+	root := BuildHuffmanTree(frequency)
+	if TreeDepth(root) <= 8 {
+		t.Fatalf("tree depth %d, want codes longer than a byte", TreeDepth(root))
+	}
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	for _, d := range payloadDecoders(root) {
+		got, err := d.decoder.Decode(payload, bitCount)
+		if err != nil || got != text {
+			t.Errorf("%s: decode failed: %v", d.name, err)
+		}
+	}
+}
+
+func TestPrewarmDecodeTable(t *testing.T) {
+	text := benchmarkText(4 << 10)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	wait := PrewarmDecodeTable(root)
+	for i := 0; i < 2; i++ {
+		got, err := wait().Decode(payload, bitCount)
+		if err != nil || got != text {
+			t.Fatalf("call %d: prewarmed table decode failed: %v", i, err)
+		}
+	}
+}
+
+// BenchmarkTableConstruction measures the latency of reading a payload and
+// decoding it by table, with the table built before the payload is read
+// (eager) or in the background while it is read (prewarm)
+func BenchmarkTableConstruction(b *testing.B) {
+	text := benchmarkText(tableMinPayload * 2)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	read := func() []byte {
+		var buf bytes.Buffer
+		io.Copy(&buf, bytes.NewReader(payload))
+		return buf.Bytes()
+	}
+
+	b.Run("eager", func(b *testing.B) {
+		b.SetBytes(int64(len(text)))
+		for i := 0; i < b.N; i++ {
+			table := NewDecodeTable(root)
+			if _, err := table.Decode(read(), bitCount); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("prewarm", func(b *testing.B) {
+		b.SetBytes(int64(len(text)))
+		for i := 0; i < b.N; i++ {
+			wait := PrewarmDecodeTable(root)
+			data := read()
+			if _, err := wait().Decode(data, bitCount); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestLargeAlphabetTables(t *testing.T) {
+	text := largeAlphabetText(2000)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	for _, d := range payloadDecoders(root) {
+		if got, err := d.decoder.Decode(payload, bitCount); err != nil || got != text {
+			t.Errorf("%s: decode failed: %v", d.name, err)
+		}
+	}
+}
+
+// BenchmarkLargeAlphabetTables compares building and decoding with the
+// single-level and two-level tables on a large alphabet; the build
+// benchmarks' B/op is the memory each table takes
+func BenchmarkLargeAlphabetTables(b *testing.B) {
+	text := largeAlphabetText(2000)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	payload, bitCount := PackBits(Encode(text, BuildCodes(root)))
+	tables := []struct {
+		name  string
+		build func() PayloadDecoder
+	}{
+		{"table", func() PayloadDecoder { return NewDecodeTable(root) }},
+		{"two-level", func() PayloadDecoder { return NewTwoLevelTable(root) }},
+	}
+	for _, tt := range tables {
+		b.Run(tt.name+"/build", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tt.build()
+			}
+		})
+		b.Run(tt.name+"/decode", func(b *testing.B) {
+			d := tt.build()
+			b.ReportAllocs()
+			b.SetBytes(int64(len(text)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := d.Decode(payload, bitCount); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentDecode(t *testing.T) {
+	// Run with -race: every goroutine shares one tree, one codes map and
+	// one of each table
+	text := benchmarkText(2000)
+	root := BuildHuffmanTree(BuildFrequencyTable(text))
+	codes := BuildCodes(root)
+	encoded := Encode(text, codes)
+	payload, bitCount := PackBits(encoded)
+	decoders := payloadDecoders(root)
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if got := Decode(Encode(text, codes), root); got != text {
+					t.Errorf("goroutine %d: Decode differs from the input", g)
+					return
+				}
+				d := decoders[(g+i)%len(decoders)]
+				got, err := d.decoder.Decode(payload, bitCount)
+				if err != nil || got != text {
+					t.Errorf("goroutine %d, %s: decoded %d bytes, error %v", g, d.name, len(got), err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if Encode(text, codes) != encoded {
+		t.Error("concurrent use changed the codes")
+	}
+}
@@ -0,0 +1,110 @@
+#!/usr/bin/env python3
+"""Writes the interop fixtures: .huff containers produced by this
+independent canonical Huffman encoder, which shares no code with the Go
+package, next to the originals they must decode to.
+
+The containers use FlagCanonical: the header stores code lengths in the
+AppendCodeLengths layout and the payload is coded with canonical codes,
+assigned in order of code length and then code point.
+
+Run it from this directory with python3 to regenerate the fixtures.
+"""
+
+import heapq
+import struct
+import zlib
+
+FLAG_CANONICAL = 2
+
+FIXTURES = {
+    "ascii": "Hello, interop! The quick brown fox jumps over the lazy dog.\n" * 3,
+    "unicode": "Grüße aus Zürich, 日本語のテキスト, Ελληνικά and emoji 🙂🙂🙂\n",
+    "single": "zzzzzzzz",
+    "empty": "",
+}
+
+
+def uvarint(n):
+    out = bytearray()
+    while n >= 0x80:
+        out.append(n & 0x7F | 0x80)
+        n >>= 7
+    out.append(n)
+    return bytes(out)
+
+
+def code_lengths(freq):
+    """Returns a Huffman code length per symbol; a lone symbol gets 1."""
+    if len(freq) == 1:
+        return {sym: 1 for sym in freq}
+    heap = [(count, i, [sym]) for i, (sym, count) in enumerate(sorted(freq.items()))]
+    heapq.heapify(heap)
+    lengths = {sym: 0 for sym in freq}
+    seq = len(heap)
+    while len(heap) > 1:
+        c1, _, s1 = heapq.heappop(heap)
+        c2, _, s2 = heapq.heappop(heap)
+        for sym in s1 + s2:
+            lengths[sym] += 1
+        heapq.heappush(heap, (c1 + c2, seq, s1 + s2))
+        seq += 1
+    return lengths
+
+
+def canonical_codes(lengths):
+    codes = {}
+    code = 0
+    prev = 0
+    for sym in sorted(lengths, key=lambda s: (lengths[s], s)):
+        code <<= lengths[sym] - prev
+        prev = lengths[sym]
+        codes[sym] = format(code, "0%db" % prev)
+        code += 1
+    return codes
+
+
+def append_code_lengths(lengths):
+    symbols = sorted(lengths)
+    out = bytearray(uvarint(len(symbols)))
+    prev = -1
+    for sym in symbols:
+        out += uvarint(sym - prev - 1)
+        prev = sym
+    i = 0
+    while i < len(symbols):
+        run = 1
+        while i + run < len(symbols) and lengths[symbols[i + run]] == lengths[symbols[i]]:
+            run += 1
+        if run == 1:
+            out.append(lengths[symbols[i]])
+        else:
+            out.append(lengths[symbols[i]] | 0x80)
+            out += uvarint(run)
+        i += run
+    return bytes(out)
+
+
+def container(text):
+    data = text.encode("utf-8")
+    symbols = [ord(c) for c in text]
+    freq = {}
+    for sym in symbols:
+        freq[sym] = freq.get(sym, 0) + 1
+    lengths = code_lengths(freq)
+    codes = canonical_codes(lengths)
+    bits = "".join(codes[sym] for sym in symbols)
+    padded = bits + "0" * (-len(bits) % 8)
+    payload = bytes(int(padded[i:i + 8], 2) for i in range(0, len(padded), 8))
+
+    body = bytes([FLAG_CANONICAL]) + uvarint(len(data)) + uvarint(len(symbols))
+    body += struct.pack(">I", zlib.crc32(data))
+    body += append_code_lengths(lengths) + uvarint(len(bits))
+    header = b"HUFF" + bytes([1]) + uvarint(len(body)) + body
+    return header + struct.pack(">I", zlib.crc32(header)) + payload
+
+
+for name, text in FIXTURES.items():
+    with open(name + ".txt", "wb") as f:
+        f.write(text.encode("utf-8"))
+    with open(name + ".huff", "wb") as f:
+        f.write(container(text))
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// A connection starts with a handshake in which the server either
+// announces the ID of a code table the client already has or sends the
+// table itself:
+//
+//	kind   byte, handshakeID or handshakeTable
+//	ID     uint32 big-endian, TableID of the table (handshakeID)
+//	table  uvarint length followed by MarshalCodes JSON (handshakeTable)
+//
+// Every later frame is a uvarint body length followed by an
+// EncodeHeaderless body coded with that table.
+const (
+	handshakeID    = 0
+	handshakeTable = 1
+)
+
+// maxFrameSize bounds the length prefixes accepted by ReadFrame and
+// ReadHandshake, so corrupt input cannot force a huge allocation
+const maxFrameSize = 64 << 20
+
+// TableID returns a 32-bit identifier for a code table, equal for equal
+// tables, for announcing a table both sides already hold
+func TableID(codes map[rune]string) uint32 {
+	data, _ := MarshalCodes(codes)
+	return crc32.ChecksumIEEE(data)
+}
+
+// WriteHandshake starts a connection using codes, sending the whole table
+// when sendTable is set and only its TableID otherwise
+func WriteHandshake(w io.Writer, codes map[rune]string, sendTable bool) error {
+	if !sendTable {
+		_, err := w.Write(binary.BigEndian.AppendUint32([]byte{handshakeID}, TableID(codes)))
+		return err
+	}
+	table, err := MarshalCodes(codes)
+	if err != nil {
+		return err
+	}
+	msg := binary.AppendUvarint([]byte{handshakeTable}, uint64(len(table)))
+	_, err = w.Write(append(msg, table...))
+	return err
+}
+
+// ReadHandshake reads a handshake from r and returns the code table it
+// selects. An announced ID is looked up in known, which maps TableID values
+// to tables and may be nil if the server always sends its table.
+func ReadHandshake(r io.Reader, known map[uint32]map[rune]string) (map[rune]string, error) {
+	br := byteReader{r: r}
+	kind, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case handshakeID:
+		var id [4]byte
+		if _, err := io.ReadFull(r, id[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		codes, ok := known[binary.BigEndian.Uint32(id[:])]
+		if !ok {
+			return nil, fmt.Errorf("unknown code table %#08x", binary.BigEndian.Uint32(id[:]))
+		}
+		return codes, nil
+	case handshakeTable:
+		table, err := readPrefixed(r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		codes, err := UnmarshalCodes(table)
+		if err != nil {
+			return nil, fmt.Errorf("invalid code table: %w", err)
+		}
+		if _, err := TreeFromCodes(codes); err != nil {
+			return nil, fmt.Errorf("invalid code table: %w", err)
+		}
+		return codes, nil
+	default:
+		return nil, fmt.Errorf("unknown handshake kind %d", kind)
+	}
+}
+
+// WriteFrame codes the UTF-8 text in payload with codes and writes it to w
+// as one length-prefixed frame
+func WriteFrame(w io.Writer, payload []byte, codes map[rune]string) error {
+	body, err := EncodeHeaderless(string(payload), codes)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(binary.AppendUvarint(nil, uint64(len(body))), body...))
+	return err
+}
+
+// ReadFrame reads one frame written by WriteFrame from r and decodes it
+// with codes. It reads only the bytes of the frame, however r splits them,
+// and returns io.EOF if r ends cleanly before the next frame.
+func ReadFrame(r io.Reader, codes map[rune]string) ([]byte, error) {
+	body, err := readPrefixed(r)
+	if err != nil {
+		return nil, err
+	}
+	text, err := DecodeHeaderless(body, codes)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(text), nil
+}
+
+// readPrefixed reads a uvarint length and that many bytes from r. It
+// returns io.EOF only if r ends before the length.
+func readPrefixed(r io.Reader) ([]byte, error) {
+	br := byteReader{r: r}
+	n, err := binary.ReadUvarint(&br)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("frame length %d exceeds the %d byte limit", n, maxFrameSize)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return data, nil
+}
+
+// byteReader reads single bytes from r without buffering, so nothing past
+// a length prefix is consumed
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(b.r, b.buf[:]); err != nil {
+		return 0, err
+	}
+	return b.buf[0], nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"testing"
+)
+
+func TestWireRoundTrip(t *testing.T) {
+	codes := BuildCodes(BuildHuffmanTree(BuildFrequencyTable(benchmarkText(4 << 10))))
+	known := map[uint32]map[rune]string{TableID(codes): codes}
+	frames := []string{"the first frame", "", "and one more", "the last of them"}
+	for _, sendTable := range []bool{false, true} {
+		pr, pw := io.Pipe()
+		go func() {
+			if err := WriteHandshake(pw, codes, sendTable); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			for _, frame := range frames {
+				if err := WriteFrame(pw, []byte(frame), codes); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			}
+			pw.Close()
+		}()
+
+		// The pipe hands over each Write as it comes, so reads must not
+		// run past the frame they are in
+		got, err := ReadHandshake(pr, known)
+		if err != nil {
+			t.Fatalf("send table %v: ReadHandshake: %v", sendTable, err)
+		}
+		if !maps.Equal(got, codes) {
+			t.Errorf("send table %v: handshake selected another table", sendTable)
+		}
+		for i, want := range frames {
+			frame, err := ReadFrame(pr, got)
+			if err != nil {
+				t.Fatalf("send table %v: frame %d: %v", sendTable, i, err)
+			}
+			if string(frame) != want {
+				t.Errorf("send table %v: frame %d = %q, want %q", sendTable, i, frame, want)
+			}
+		}
+		if _, err := ReadFrame(pr, got); err != io.EOF {
+			t.Errorf("send table %v: after the last frame: error %v, want io.EOF", sendTable, err)
+		}
+	}
+}
+
+func TestWireErrors(t *testing.T) {
+	codes := map[rune]string{'a': "0", 'b': "1"}
+	var id bytes.Buffer
+	if err := WriteHandshake(&id, codes, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHandshake(bytes.NewReader(id.Bytes()), nil); err == nil {
+		t.Error("ReadHandshake accepted an unknown table ID")
+	}
+	if _, err := ReadHandshake(bytes.NewReader([]byte{7}), nil); err == nil {
+		t.Error("ReadHandshake accepted an unknown handshake kind")
+	}
+	var table bytes.Buffer
+	if err := WriteHandshake(&table, codes, true); err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n < table.Len(); n++ {
+		if _, err := ReadHandshake(bytes.NewReader(table.Bytes()[:n]), nil); err != io.ErrUnexpectedEOF {
+			t.Errorf("%d of %d handshake bytes: error %v, want io.ErrUnexpectedEOF", n, table.Len(), err)
+		}
+	}
+
+	var frame bytes.Buffer
+	if err := WriteFrame(&frame, []byte("abba"), codes); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFrame(bytes.NewReader(frame.Bytes()[:frame.Len()-1]), codes); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated frame: error %v, want io.ErrUnexpectedEOF", err)
+	}
+	if err := WriteFrame(io.Discard, []byte("abc"), codes); err == nil {
+		t.Error("WriteFrame accepted a symbol missing from the table")
+	}
+}